@@ -25,6 +25,9 @@ type AggregateOperation interface {
 
 	// withCombiningAccumulateFn return the copy of this aggregate operation, but with the accumulate primitive replaced with one that expects to find accumulator objects in the input items and combines them all into a single accumulator of same type
 	withCombiningAccumulateFn(getAccFn ApplyFn) AggregateOperation
+
+	// withIdentityFinish return the copy of this aggregate operation, but with the finish primitive replaced with one that returns the accumulator itself
+	withIdentityFinish() AggregateOperation
 }
 
 // AggregateOperation1 extensive AggregateOperation to the arity-1 case
@@ -81,6 +84,12 @@ func (a *AggregateOperationImpl) withCombiningAccumulateFn(getAccFn ApplyFn) Agg
 	)
 }
 
+func (a *AggregateOperationImpl) withIdentityFinish() AggregateOperation {
+	return NewAggregateOperationImpl(a.createFn, a.accumulateFns, a.combineFn, a.deductFn, a.exportFn, func(acc interface{}) interface{} {
+		return acc
+	})
+}
+
 func (a *AggregateOperationImpl) getCombineFn() BiAcceptFn {
 	return a.combineFn
 }
@@ -2,9 +2,15 @@ package stream_processing
 
 import (
 	"github.com/stretchr/testify/assert"
+	"reflect"
 	"testing"
 )
 
+// assertSameFn asserts that both functions are the same function, assert.Same can't compare function values
+func assertSameFn(t *testing.T, expected, actual interface{}) {
+	assert.Equal(t, reflect.ValueOf(expected).Pointer(), reflect.ValueOf(actual).Pointer())
+}
+
 func TestAggregateOperation1_when_build_then_allPartsThere(t *testing.T) {
 
 	createFn := func() interface{} {
@@ -35,12 +41,12 @@ func TestAggregateOperation1_when_build_then_allPartsThere(t *testing.T) {
 		andExport(exportFn).
 		andFinish(finishFn)
 
-	assert.Same(t, createFn, aggOp.getCreateFn())
-	assert.Same(t, accFn0, aggOp.accumulateFn(0))
-	assert.Same(t, combineFn, aggOp.getCombineFn())
-	assert.Same(t, deductFn, aggOp.getDeductFn())
-	assert.Same(t, exportFn, aggOp.getExportFn())
-	assert.Same(t, finishFn, aggOp.getFinishFn())
+	assertSameFn(t, createFn, aggOp.getCreateFn())
+	assertSameFn(t, accFn0, aggOp.accumulateFn(0))
+	assertSameFn(t, combineFn, aggOp.getCombineFn())
+	assertSameFn(t, deductFn, aggOp.getDeductFn())
+	assertSameFn(t, exportFn, aggOp.getExportFn())
+	assertSameFn(t, finishFn, aggOp.getFinishFn())
 
 }
 
@@ -67,8 +73,8 @@ func TestAggregateOperation1_accumulate0_synonymFor_accumulate(t *testing.T) {
 			return t.(*LongAccumulator).get()
 		})
 
-	assert.Same(t, accFn, aggOp1.accumulateFn(0))
-	assert.Same(t, accFn, aggOp2.accumulateFn(0))
+	assertSameFn(t, accFn, aggOp1.accumulateFn(0))
+	assertSameFn(t, accFn, aggOp2.accumulateFn(0))
 
 }
 
@@ -238,3 +244,13 @@ func TestAggregateOperation3_when_andThen_then_exportAndFinishChanged(t *testing
 	assert.Equal(t, int64(14), exported)
 	assert.Equal(t, int64(14), finished)
 }
+
+func TestAggregateOperation1_when_withIdentityFinish_then_accumulatorFinished(t *testing.T) {
+	aggOp := counting().withIdentityFinish()
+	acc := aggOp.getCreateFn()()
+	aggOp.accumulateFn(0)(acc, "a")
+
+	assert.Same(t, acc, aggOp.getFinishFn()(acc))
+	assert.Equal(t, int64(1), aggOp.getExportFn()(acc))
+	assert.NotNil(t, aggOp.getCombineFn())
+}
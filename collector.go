@@ -0,0 +1,160 @@
+package stream_processing
+
+type OutboundCollector interface {
+
+	// offer an item to this collector, if the collector cannot complete the operation, the call must be retried later
+	offer(item interface{}) *ProgressState
+
+	// offerBroadcast offers an item to all the downstream processors reachable through this collector,
+	// if the collector cannot complete the operation, the call must be retried later
+	offerBroadcast(item interface{}) *ProgressState
+
+	// getPartitions return the list of partitions handled by this collector
+	getPartitions() []int
+}
+
+// ConveyorCollector an OutboundCollector that offers the items to a single queue towards one downstream processor
+type ConveyorCollector struct {
+	queue      Queue
+	partitions []int
+}
+
+func NewConveyorCollector(queue Queue, partitions []int) *ConveyorCollector {
+	return &ConveyorCollector{queue: queue, partitions: partitions}
+}
+
+func (c *ConveyorCollector) offer(item interface{}) *ProgressState {
+	if c.queue.offer(item) {
+		return DONE
+	}
+	return NO_PROGRESS
+}
+
+func (c *ConveyorCollector) offerBroadcast(item interface{}) *ProgressState {
+	return c.offer(item)
+}
+
+func (c *ConveyorCollector) getPartitions() []int {
+	return c.partitions
+}
+
+// compositeCollector the common part of the collectors that route items to several downstream collectors
+type compositeCollector struct {
+	collectors       []OutboundCollector
+	broadcastTracker []bool
+}
+
+func newCompositeCollector(collectors []OutboundCollector) compositeCollector {
+	return compositeCollector{collectors: collectors, broadcastTracker: make([]bool, len(collectors))}
+}
+
+// offerBroadcast offers the item to every downstream processor of every collector
+func (c *compositeCollector) offerBroadcast(item interface{}) *ProgressState {
+	return c.offerToAll(item, OutboundCollector.offerBroadcast)
+}
+
+// offerToAll offers the item to every collector using offerFn. the collectors that accepted the item are remembered, so
+// a retried call only offers it to the remaining ones
+func (c *compositeCollector) offerToAll(item interface{}, offerFn func(OutboundCollector, interface{}) *ProgressState) *ProgressState {
+	tracker := NewProgressTracker()
+	for i, collector := range c.collectors {
+		if c.broadcastTracker[i] {
+			continue
+		}
+		result := offerFn(collector, item)
+		if result.isDone {
+			c.broadcastTracker[i] = true
+		}
+		tracker.mergeWith(result)
+	}
+	if tracker.isDone {
+		for i := range c.broadcastTracker {
+			c.broadcastTracker[i] = false
+		}
+	}
+	return tracker.toProgressState()
+}
+
+func (c *compositeCollector) getPartitions() []int {
+	var partitions []int
+	for _, collector := range c.collectors {
+		partitions = append(partitions, collector.getPartitions()...)
+	}
+	return partitions
+}
+
+// RoundRobinCollector an OutboundCollector for the UNICAST routing policy, it offers each item to the next collector
+// that accepts it
+type RoundRobinCollector struct {
+	compositeCollector
+	index int
+}
+
+func NewRoundRobinCollector(collectors []OutboundCollector) *RoundRobinCollector {
+	return &RoundRobinCollector{compositeCollector: newCompositeCollector(collectors)}
+}
+
+func (c *RoundRobinCollector) offer(item interface{}) *ProgressState {
+	for range c.collectors {
+		collector := c.collectors[c.index]
+		c.index = (c.index + 1) % len(c.collectors)
+		if result := collector.offer(item); result.isDone {
+			return result
+		}
+	}
+	return NO_PROGRESS
+}
+
+// BroadcastCollector an OutboundCollector for the BROADCAST routing policy, it offers each item to all collectors
+type BroadcastCollector struct {
+	compositeCollector
+}
+
+func NewBroadcastCollector(collectors []OutboundCollector) *BroadcastCollector {
+	return &BroadcastCollector{compositeCollector: newCompositeCollector(collectors)}
+}
+
+func (c *BroadcastCollector) offer(item interface{}) *ProgressState {
+	return c.offerBroadcast(item)
+}
+
+// FanOutCollector an OutboundCollector for the FANOUT routing policy. it gets one collector per member and offers each
+// item to all of them, every member collector passes the item to one of its processors
+type FanOutCollector struct {
+	compositeCollector
+}
+
+func NewFanOutCollector(memberCollectors []OutboundCollector) *FanOutCollector {
+	return &FanOutCollector{compositeCollector: newCompositeCollector(memberCollectors)}
+}
+
+func (c *FanOutCollector) offer(item interface{}) *ProgressState {
+	return c.offerToAll(item, OutboundCollector.offer)
+}
+
+// PartitionedCollector an OutboundCollector for the PARTITIONED routing policy, it offers each item to the
+// collector that handles the item's partition
+type PartitionedCollector struct {
+	compositeCollector
+	partitioner     Partitioner
+	partitionLookup []OutboundCollector
+}
+
+func NewPartitionedCollector(partitioner Partitioner, partitionCount int, collectors []OutboundCollector) *PartitionedCollector {
+	c := &PartitionedCollector{
+		compositeCollector: newCompositeCollector(collectors),
+		partitioner:        partitioner,
+		partitionLookup:    make([]OutboundCollector, partitionCount),
+	}
+	for _, collector := range collectors {
+		for _, partition := range collector.getPartitions() {
+			c.partitionLookup[partition] = collector
+		}
+	}
+	return c
+}
+
+func (c *PartitionedCollector) offer(item interface{}) *ProgressState {
+	partition := c.partitioner.getPartition(item, len(c.partitionLookup))
+	return c.partitionLookup[int(floorMod(int64(partition), int64(len(c.partitionLookup))))].offer(item)
+}
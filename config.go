@@ -1,3 +1,212 @@
 package stream_processing
 
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"time"
+)
 
+// DEFAULT_COOPERATIVE_CALL_BUDGET the default time a call of a cooperative tasklet may take before the watchdog logs it
+const DEFAULT_COOPERATIVE_CALL_BUDGET = 100 * time.Millisecond
+
+// DEFAULT_PARTITION_COUNT the default number of partitions the keys of a partitioned edge are hashed into
+const DEFAULT_PARTITION_COUNT = 271
+
+// InstanceConfig general configuration of the execution engine
+type InstanceConfig struct {
+	// cooperativeThreadCount the number of worker goroutines that run the cooperative tasklets
+	cooperativeThreadCount int
+
+	// partitionCount the number of partitions of a partitioned edge, each partition is assigned to one downstream processor
+	partitionCount int
+
+	// cooperativeCallBudget the time a call of a cooperative tasklet may take, the longer calls are logged
+	cooperativeCallBudget time.Duration
+
+	// logOutput where the loggers of the processors and the execution service write to
+	logOutput io.Writer
+
+	// snapshotStore where the snapshots of the jobs are kept
+	snapshotStore SnapshotStore
+
+	// serializerRegistry encodes the items sent to the other members
+	serializerRegistry *SerializerRegistry
+}
+
+func NewInstanceConfig() *InstanceConfig {
+	return &InstanceConfig{
+		cooperativeThreadCount: runtime.NumCPU(),
+		partitionCount:         DEFAULT_PARTITION_COUNT,
+		cooperativeCallBudget:  DEFAULT_COOPERATIVE_CALL_BUDGET,
+		logOutput:              os.Stderr,
+		snapshotStore:          NewInMemorySnapshotStore(DEFAULT_RETAINED_SNAPSHOT_COUNT),
+		serializerRegistry:     NewSerializerRegistry(),
+	}
+}
+
+// setCooperativeThreadCount sets the number of worker goroutines that run the cooperative tasklets, it is also the default local parallelism of vertices
+func (c *InstanceConfig) setCooperativeThreadCount(count int) *InstanceConfig {
+	if count <= 0 {
+		panic("Cooperative thread count must be positive")
+	}
+	c.cooperativeThreadCount = count
+	return c
+}
+
+// setPartitionCount sets the number of partitions of a partitioned edge
+func (c *InstanceConfig) setPartitionCount(count int) *InstanceConfig {
+	if count <= 0 {
+		panic("Partition count must be positive")
+	}
+	c.partitionCount = count
+	return c
+}
+
+// setCooperativeCallBudget sets the time a call of a cooperative tasklet may take before the watchdog logs it
+func (c *InstanceConfig) setCooperativeCallBudget(budget time.Duration) *InstanceConfig {
+	if budget <= 0 {
+		panic("Cooperative call budget must be positive")
+	}
+	c.cooperativeCallBudget = budget
+	return c
+}
+
+// setLogOutput sets where the loggers of the processors write to
+func (c *InstanceConfig) setLogOutput(w io.Writer) *InstanceConfig {
+	c.logOutput = w
+	return c
+}
+
+// setSnapshotStore sets where the snapshots of the jobs are kept, by default they are kept in memory
+func (c *InstanceConfig) setSnapshotStore(store SnapshotStore) *InstanceConfig {
+	c.snapshotStore = store
+	return c
+}
+
+// setSerializerRegistry sets the serializers of the items sent to the other members, all members must have the same serializers
+func (c *InstanceConfig) setSerializerRegistry(registry *SerializerRegistry) *InstanceConfig {
+	c.serializerRegistry = registry
+	return c
+}
+
+// ProcessingGuarantee the guarantee a job gives for the effects of the items on the state of the processors when it is
+// restarted after a failure
+type ProcessingGuarantee int
+
+const (
+	// NONE no snapshots are taken, the state is lost on restart
+	NONE ProcessingGuarantee = iota
+
+	// AT_LEAST_ONCE the state is restored from a snapshot, some items may be processed again after a restart
+	AT_LEAST_ONCE
+
+	// EXACTLY_ONCE the state is restored from a snapshot, each item affects the state exactly once. a job with a vertex
+	// whose inbound edges have different priorities is rejected with it
+	EXACTLY_ONCE
+)
+
+func (g ProcessingGuarantee) String() string {
+	switch g {
+	case NONE:
+		return "NONE"
+	case AT_LEAST_ONCE:
+		return "AT_LEAST_ONCE"
+	case EXACTLY_ONCE:
+		return "EXACTLY_ONCE"
+	}
+	return fmt.Sprintf("ProcessingGuarantee(%d)", int(g))
+}
+
+// DEFAULT_SNAPSHOT_INTERVAL_MILLIS the default time between two snapshots of a job
+const DEFAULT_SNAPSHOT_INTERVAL_MILLIS = 10000
+
+// JobConfig the configuration of a single job
+type JobConfig struct {
+	// name identifies the job across processes, the snapshots of the job are stored under it
+	name string
+
+	processingGuarantee ProcessingGuarantee
+
+	// snapshotIntervalMillis the time between the start of a snapshot and the previous one, unless it took longer
+	snapshotIntervalMillis int64
+
+	// restartPolicy decides whether the job is restarted after a failure, nil if it isn't
+	restartPolicy *RestartPolicy
+}
+
+func NewJobConfig() *JobConfig {
+	return &JobConfig{processingGuarantee: NONE, snapshotIntervalMillis: DEFAULT_SNAPSHOT_INTERVAL_MILLIS}
+}
+
+// setName sets the name the snapshots of the job are stored under. a job is restored from the snapshots of an earlier
+// job only if both have the same name, a job without a name is restored only from its own snapshots
+func (c *JobConfig) setName(name string) *JobConfig {
+	if name == "" {
+		panic("Job name must not be empty")
+	}
+	c.name = name
+	return c
+}
+
+// getName return the name of the job, empty if it has none
+func (c *JobConfig) getName() string {
+	return c.name
+}
+
+// setRestartPolicy sets how the job is restarted after a failure, by default a failed job isn't restarted
+func (c *JobConfig) setRestartPolicy(policy *RestartPolicy) *JobConfig {
+	c.restartPolicy = policy
+	return c
+}
+
+// setSnapshotIntervalMillis sets the time between the snapshots, it has no effect with the NONE guarantee
+func (c *JobConfig) setSnapshotIntervalMillis(interval int64) *JobConfig {
+	if interval <= 0 {
+		panic("Snapshot interval must be positive")
+	}
+	c.snapshotIntervalMillis = interval
+	return c
+}
+
+// setProcessingGuarantee sets the processing guarantee of the job, the default is NONE
+func (c *JobConfig) setProcessingGuarantee(guarantee ProcessingGuarantee) *JobConfig {
+	c.processingGuarantee = guarantee
+	return c
+}
+
+// RestartPolicy restarts a failed job from its latest snapshot up to maxAttempts times in a row. the n-th restart waits
+// initialBackoff * 2^(n-1), at most maxBackoff. the attempts are counted again once the restarted job took a snapshot
+type RestartPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+func NewRestartPolicy(maxAttempts int, initialBackoff, maxBackoff time.Duration) *RestartPolicy {
+	if maxAttempts <= 0 {
+		panic("Max restart attempts must be positive")
+	}
+	if initialBackoff < 0 || maxBackoff < initialBackoff {
+		panic("Restart backoff must not be negative and not exceed the max backoff")
+	}
+	return &RestartPolicy{maxAttempts: maxAttempts, initialBackoff: initialBackoff, maxBackoff: maxBackoff}
+}
+
+// shouldRestart tells whether the job may be restarted after it failed attempts times in a row
+func (p *RestartPolicy) shouldRestart(attempts int) bool {
+	return attempts < p.maxAttempts
+}
+
+// backoff return the time to wait before the restart that follows the given number of failures in a row
+func (p *RestartPolicy) backoff(attempts int) time.Duration {
+	backoff := p.initialBackoff
+	for i := 1; i < attempts && backoff < p.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.maxBackoff {
+		backoff = p.maxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,100 @@
+package stream_processing
+
+import "sync/atomic"
+
+// cacheLinePad separates the fields written by the producer from those written by the consumer, so they don't share a cache line
+type cacheLinePad [64]byte
+
+// Conveyor a lock-free single-producer, single-consumer Queue backed by a ring buffer.
+// there is one conveyor for each pair of upstream and downstream processors of an edge
+type Conveyor struct {
+	buffer []interface{}
+	mask   int64
+	_      cacheLinePad
+
+	// head the index of the next item to poll, written only by the consumer
+	head int64
+	// tailCache the consumer's last observed value of tail
+	tailCache int64
+	_         cacheLinePad
+
+	// tail the index of the next slot to fill, written only by the producer
+	tail int64
+	// headCache the producer's last observed value of head
+	headCache int64
+	_         cacheLinePad
+}
+
+// NewConveyor creates a conveyor that holds at least capacity items, the capacity is rounded up to a power of two
+func NewConveyor(capacity int) *Conveyor {
+	if capacity <= 0 {
+		panic("Conveyor capacity must be positive")
+	}
+	size := nextPowerOfTwo(capacity)
+	return &Conveyor{buffer: make([]interface{}, size), mask: int64(size - 1)}
+}
+
+func (c *Conveyor) offer(item interface{}) bool {
+	tail := c.tail
+	if tail-c.headCache >= int64(len(c.buffer)) {
+		c.headCache = atomic.LoadInt64(&c.head)
+		if tail-c.headCache >= int64(len(c.buffer)) {
+			return false
+		}
+	}
+	c.buffer[tail&c.mask] = item
+	atomic.StoreInt64(&c.tail, tail+1)
+	return true
+}
+
+func (c *Conveyor) poll() interface{} {
+	head := c.head
+	if head >= c.tailCache {
+		c.tailCache = atomic.LoadInt64(&c.tail)
+		if head >= c.tailCache {
+			return nil
+		}
+	}
+	index := head & c.mask
+	item := c.buffer[index]
+	c.buffer[index] = nil
+	atomic.StoreInt64(&c.head, head+1)
+	return item
+}
+
+func (c *Conveyor) drain(dest TestFn) int {
+	head := c.head
+	tail := atomic.LoadInt64(&c.tail)
+	c.tailCache = tail
+	count := 0
+	for head < tail {
+		index := head & c.mask
+		item := c.buffer[index]
+		c.buffer[index] = nil
+		head++
+		count++
+		if !dest(item) {
+			break
+		}
+	}
+	atomic.StoreInt64(&c.head, head)
+	return count
+}
+
+func (c *Conveyor) size() int {
+	return int(atomic.LoadInt64(&c.tail) - atomic.LoadInt64(&c.head))
+}
+
+// capacity return the number of items the conveyor can hold
+func (c *Conveyor) capacity() int {
+	return len(c.buffer)
+}
+
+// nextPowerOfTwo return the smallest power of two greater than or equal to value
+func nextPowerOfTwo(value int) int {
+	result := 1
+	for result < value {
+		result <<= 1
+	}
+	return result
+}
@@ -0,0 +1,98 @@
+package stream_processing
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ConveyorTest struct {
+	conveyor *Conveyor
+}
+
+func ConveyorTestSetup(tb testing.TB) (func(tb testing.TB), ConveyorTest) {
+	ct := ConveyorTest{}
+	ct.conveyor = NewConveyor(3)
+
+	return func(tb testing.TB) {
+		tb.Log("ConveyorTestSetup teardown")
+	}, ct
+}
+
+func TestConveyor_when_created_then_capacityRoundedUpToPowerOfTwo(t *testing.T) {
+	teardownTest, ct := ConveyorTestSetup(t)
+	defer teardownTest(t)
+
+	assert.Equal(t, 4, ct.conveyor.capacity())
+	assert.Equal(t, 1, NewConveyor(1).capacity())
+	assert.Panics(t, func() {
+		NewConveyor(0)
+	})
+}
+
+func TestConveyor_when_full_then_offerRejected(t *testing.T) {
+	teardownTest, ct := ConveyorTestSetup(t)
+	defer teardownTest(t)
+
+	for i := 0; i < 4; i++ {
+		assert.True(t, ct.conveyor.offer(i))
+	}
+	assert.False(t, ct.conveyor.offer(4))
+	assert.Equal(t, 4, ct.conveyor.size())
+
+	assert.Equal(t, 0, ct.conveyor.poll())
+	assert.True(t, ct.conveyor.offer(4))
+}
+
+func TestConveyor_when_drainStopped_then_restRemains(t *testing.T) {
+	teardownTest, ct := ConveyorTestSetup(t)
+	defer teardownTest(t)
+
+	for i := 0; i < 4; i++ {
+		ct.conveyor.offer(i)
+	}
+	var drained []interface{}
+	count := ct.conveyor.drain(func(t interface{}) bool {
+		drained = append(drained, t)
+		return t != 1
+	})
+	assert.Equal(t, 2, count)
+	assert.Equal(t, []interface{}{0, 1}, drained)
+	assert.Equal(t, 2, ct.conveyor.poll())
+	assert.Equal(t, 3, ct.conveyor.poll())
+	assert.Nil(t, ct.conveyor.poll())
+}
+
+func TestConveyor_when_producerAndConsumerConcurrent_then_itemsInOrder(t *testing.T) {
+	teardownTest, ct := ConveyorTestSetup(t)
+	defer teardownTest(t)
+
+	const count = 100000
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < count; {
+			if ct.conveyor.offer(i) {
+				i++
+			} else {
+				runtime.Gosched()
+			}
+		}
+	}()
+	next := 0
+	for next < count {
+		drained := ct.conveyor.drain(func(item interface{}) bool {
+			assert.Equal(t, next, item)
+			next++
+			return true
+		})
+		if drained == 0 {
+			runtime.Gosched()
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, 0, ct.conveyor.size())
+}
@@ -1,7 +1,5 @@
 package stream_processing
 
-
-
 // Vertex represents a unit of data processing in a computation job.
 // Vertex receives data items over its inbound Edge and pushes data items to its outbound Edge
 // a single Vertex  is represented by a set of instances of Processor
@@ -19,6 +17,33 @@ func NewVertex(name string, processorSupplier ProcessorSupplier) *Vertex {
 	}
 }
 
+// NewVertexFromMetaSupplier creates a vertex whose processors are created by the ProcessorSupplier the meta-supplier
+// returns for each member
+func NewVertexFromMetaSupplier(name string, metaSupplier ProcessorMetaSupplier) *Vertex {
+	return &Vertex{
+		localParallelism: -1,
+		name:             name,
+		metaSupplier:     metaSupplier,
+	}
+}
+
+// setLocalParallelism sets the number of processors corresponding to this vertex that will be created on each member
+func (v *Vertex) setLocalParallelism(localParallelism int) *Vertex {
+	v.localParallelism = checkLocalParallelism(localParallelism)
+	return v
+}
+
+// determineLocalParallelism return the local parallelism set on this vertex, or the one preferred by its supplier, or the given default
+func (v *Vertex) determineLocalParallelism(defaultParallelism int) int {
+	if v.localParallelism != LOCAL_PARALLELISM_USE_DEFAULT {
+		return v.localParallelism
+	}
+	if preferred := v.metaSupplier.getPreferredLocalParallelism(); preferred != LOCAL_PARALLELISM_USE_DEFAULT {
+		return preferred
+	}
+	return defaultParallelism
+}
+
 // Sources contains factory methods for various types of pipeline sources
 type Sources struct {
 }
@@ -27,7 +52,55 @@ func NewSources() Sources {
 	return Sources{}
 }
 
+// batchFromProcessor returns a bounded source whose processors are created by the given meta-supplier
 func (s Sources) batchFromProcessor(sourceName string, metaSupplier ProcessorMetaSupplier) BatchSource {
-	//return NewBatchSource(s)
-	return nil
+	return NewBatchSourceTransform(sourceName, metaSupplier)
+}
+
+// items returns a bounded source that emits the given items once, from a single processor of the cluster
+func (s Sources) items(items ...interface{}) BatchSource {
+	return s.batchFromProcessor("items", NewMetaSupplierFromProcessorSupplier(1, NewProcessorSupplierFromGetFn(func() interface{} {
+		return NewItemsSourceP(items)
+	})))
+}
+
+// streamFromProcessor returns an unbounded source whose processors are created by the given meta-supplier.
+// the processors don't emit watermarks, the pipeline adds them according to the timestamps declared on the source stage
+func (s Sources) streamFromProcessor(sourceName string, metaSupplier ProcessorMetaSupplier) StreamSource {
+	return NewStreamSourceTransform(sourceName, metaSupplier, false)
+}
+
+// SinkImpl a sink whose processors are created by a meta-supplier
+type SinkImpl struct {
+	sinkName          string
+	metaSupplier      ProcessorMetaSupplier
+	isAssignedToStage bool
+}
+
+func NewSinkImpl(sinkName string, metaSupplier ProcessorMetaSupplier) *SinkImpl {
+	return &SinkImpl{sinkName: sinkName, metaSupplier: metaSupplier}
+}
+
+func (s *SinkImpl) name() string {
+	return s.sinkName
+}
+
+// Sinks contains factory methods for various types of pipeline sinks
+type Sinks struct {
+}
+
+func NewSinks() Sinks {
+	return Sinks{}
+}
+
+// fromProcessor returns a sink whose processors are created by the given meta-supplier
+func (s Sinks) fromProcessor(sinkName string, metaSupplier ProcessorMetaSupplier) Sink {
+	return NewSinkImpl(sinkName, metaSupplier)
+}
+
+// writeFn returns a sink that passes each received item to writeFn, it is called concurrently from all the sink processors
+func (s Sinks) writeFn(sinkName string, writeFn AcceptFn) Sink {
+	return s.fromProcessor(sinkName, NewMetaSupplierFromProcessorSupplier(LOCAL_PARALLELISM_USE_DEFAULT, NewProcessorSupplierFromGetFn(func() interface{} {
+		return NewWriteFnSinkP(writeFn)
+	})))
 }
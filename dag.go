@@ -24,12 +24,12 @@ func NewDAG() *DAG {
 
 // newVertex creates a vertex from processor supplier and adds it to this DAG
 func (d *DAG) newVertex(name string, simpleSupplier GetFn) *Vertex {
-	return d.addVertex(NewVertex(name, simpleSupplier))
+	return d.addVertex(NewVertex(name, NewProcessorSupplierFromGetFn(simpleSupplier)))
 }
 
 // newUniqueVertex creates a vertex from processor supplier and adds it to this DAG. the vertex will be given a unique name created from namePrefix
 func (d *DAG) newUniqueVertex(namePrefix string, simpleSupplier GetFn) *Vertex {
-	return d.addVertex(NewVertex(d.uniqueName(namePrefix), simpleSupplier))
+	return d.addVertex(NewVertex(d.uniqueName(namePrefix), NewProcessorSupplierFromGetFn(simpleSupplier)))
 }
 
 // vertex add a vertex to this DAG. the vertex name must be unique
@@ -50,7 +50,7 @@ func (d *DAG) addVertex(vertex *Vertex) *Vertex {
 // edge add an edge to this DAG, the vertices it connects must already be present in the DAG.
 // it is an error to connect an edge to a vertex at the same ordinal as another exsiting edge.
 // However , inbound and outbound ordinals are independent, so there can be two edges at the same ordinal,
-// one inbound and one outbound
+// one inbound and one outbound. an edge from a vertex to itself is rejected only when the DAG is sorted
 func (d *DAG) edge(edge *Edge) *DAG {
 	if edge.destination == nil {
 		panic("Edge has no destination")
@@ -86,10 +86,6 @@ func (d *DAG) edge(edge *Edge) *DAG {
 		panic(fmt.Sprintf("Vertex %s already has an outbound edge at ordinal", edge.destName))
 	}
 
-	if edge.source == edge.destination {
-		panic(fmt.Sprintf("Attempt to add an edge from %s to itself", edge.sourceName))
-	}
-
 	d.edges.Add(edge)
 	return d
 }
@@ -37,3 +37,13 @@ type Tuple3 struct {
 func NewTuple3(f0, f1, f2 interface{}) Tuple3 {
 	return Tuple3{f0: f0, f1: f1, f2: f2}
 }
+
+// TimestampedItem an item of a stream stage with timestamps together with its event timestamp
+type TimestampedItem struct {
+	item      interface{}
+	timestamp int64
+}
+
+func NewTimestampedItem(item interface{}, timestamp int64) TimestampedItem {
+	return TimestampedItem{item: item, timestamp: timestamp}
+}
@@ -23,10 +23,14 @@ const (
 	// BROADCAST this policy sends each item to all candidate processors
 	BROADCAST
 
-	// FANOUT TODO
+	// FANOUT this policy sends each item to all members, but only to one processor on each member.
+	// it is a combination of BROADCAST between the members and UNICAST within a member
 	FANOUT
 )
 
+// DEFAULT_QUEUE_SIZE the default capacity of the queue between an upstream and a downstream processor
+const DEFAULT_QUEUE_SIZE = 1024
+
 type Edge struct {
 	source        *Vertex
 	sourceName    string
@@ -39,6 +43,10 @@ type Edge struct {
 
 	partitioner   Partitioner
 	routingPolicy RoutingPolicy
+	queueSize     int
+
+	// isDistributed whether the edge connects the processors on all members, otherwise only the processors on the same member
+	isDistributed bool
 }
 
 func NewEdge(source, destination *Vertex, sourceOrdinal, destOrdinal int) *Edge {
@@ -46,6 +54,7 @@ func NewEdge(source, destination *Vertex, sourceOrdinal, destOrdinal int) *Edge
 		source:        source,
 		sourceName:    source.name,
 		sourceOrdinal: sourceOrdinal,
+		queueSize:     DEFAULT_QUEUE_SIZE,
 	}
 
 	e.destOrdinal = destOrdinal
@@ -76,6 +85,21 @@ func (e *Edge) setPriority(priority int) *Edge {
 	return e
 }
 
+// setQueueSize sets the capacity of the conveyor between each upstream and downstream processor of this edge,
+// it is rounded up to a power of two. a larger queue smooths out bursts at the cost of memory
+func (e *Edge) setQueueSize(size int) *Edge {
+	if size <= 0 {
+		panic("queueSize must be positive")
+	}
+	e.queueSize = size
+	return e
+}
+
+// getQueueSize ...
+func (e *Edge) getQueueSize() int {
+	return e.queueSize
+}
+
 // partitioned ...
 func (e *Edge) partitioned(extractKeyFn ApplyFn, partitioner Partitioner) *Edge {
 	e.routingPolicy = PARTITIONED
@@ -83,6 +107,12 @@ func (e *Edge) partitioned(extractKeyFn ApplyFn, partitioner Partitioner) *Edge
 	return e
 }
 
+// partitionedByKey activates the PARTITIONED routing policy with the default partitioner, the items with equal keys
+// go to the same processor
+func (e *Edge) partitionedByKey(extractKeyFn ApplyFn) *Edge {
+	return e.partitioned(extractKeyFn, NewDefaultPartitioner())
+}
+
 // allToOne ...
 func (e *Edge) allToOne(key interface{}) *Edge {
 	return e.partitioned(func(t interface{}) interface{} {
@@ -96,6 +126,39 @@ func (e *Edge) broadcast() *Edge {
 	return e
 }
 
+// isolated activates the ISOLATED routing policy, it keeps the order of the items emitted by each upstream processor
+func (e *Edge) isolated() *Edge {
+	e.routingPolicy = ISOLATED
+	return e
+}
+
+// fanout activates the FANOUT routing policy
+func (e *Edge) fanout() *Edge {
+	e.routingPolicy = FANOUT
+	return e
+}
+
+// distributed makes the edge connect the upstream processors with the downstream processors on all members,
+// the items for the other members travel over the Transport
+func (e *Edge) distributed() *Edge {
+	e.isDistributed = true
+	return e
+}
+
+// isConnected tells whether the upstream processor with index upstream sends items to the downstream processor with
+// index downstream. all pairs are connected except on an ISOLATED edge, where each downstream processor receives
+// from a single upstream processor if upstreamParallelism <= downstreamParallelism, and each upstream processor sends
+// to a single downstream processor otherwise
+func (e *Edge) isConnected(upstream, downstream, upstreamParallelism, downstreamParallelism int) bool {
+	if e.routingPolicy != ISOLATED {
+		return true
+	}
+	if upstreamParallelism <= downstreamParallelism {
+		return downstream%upstreamParallelism == upstream
+	}
+	return upstream%downstreamParallelism == downstream
+}
+
 // unicast ...
 func (e *Edge) unicast() *Edge {
 	e.routingPolicy = UNICAST
@@ -0,0 +1,138 @@
+package stream_processing
+
+import "fmt"
+
+// doneItem the item a processor emits to all its outbound edges after it completed
+type doneItem struct {
+}
+
+// DONE_ITEM signals the downstream processor that the upstream processor will emit no more items
+var DONE_ITEM = &doneItem{}
+
+// isBroadcastItem tells whether the item must reach all downstream processors regardless of the routing policy
+func isBroadcastItem(item interface{}) bool {
+	switch item.(type) {
+	case *Watermark, *doneItem, *SnapshotBarrier:
+		return true
+	}
+	return false
+}
+
+// InboundEdgeStream the inbound side of an Edge for a single downstream processor.
+// it drains the queues from all the upstream processors and reports their watermarks to the WatermarkCoalescer
+type InboundEdgeStream struct {
+	ordinal  int
+	priority int
+	queues   []Queue
+
+	// coalescer is shared by all the inbound streams of the processor, this stream's queues start at queueOffset
+	coalescer   *WatermarkCoalescer
+	queueOffset int
+	doneQueues  []bool
+
+	// barrierQueues the queues that delivered the barrier of the pending snapshot. if waitForAlignment is set they
+	// are not drained until the barrier is released, so no item emitted after the barrier is processed before the snapshot
+	pendingSnapshotId int64
+	barrierQueues     []bool
+	waitForAlignment  bool
+}
+
+func NewInboundEdgeStream(ordinal, priority int, queues []Queue, coalescer *WatermarkCoalescer, queueOffset int) *InboundEdgeStream {
+	return &InboundEdgeStream{
+		ordinal:     ordinal,
+		priority:    priority,
+		queues:      queues,
+		coalescer:   coalescer,
+		queueOffset: queueOffset,
+		doneQueues:  make([]bool, len(queues)),
+
+		pendingSnapshotId: NO_SNAPSHOT,
+		barrierQueues:     make([]bool, len(queues)),
+	}
+}
+
+// setWaitForAlignment sets whether the queues that delivered the barrier are blocked until it is released, it is
+// needed for the EXACTLY_ONCE guarantee
+func (s *InboundEdgeStream) setWaitForAlignment(wait bool) *InboundEdgeStream {
+	s.waitForAlignment = wait
+	return s
+}
+
+// drainTo passes the items available in the queues to dest. the draining stops at the first watermark that makes the
+// coalesced watermark advance, which is returned together with the progress. if there is no such watermark NO_NEW_WM is returned.
+// the draining of a queue also stops at a snapshot barrier, see receivedBarrier
+func (s *InboundEdgeStream) drainTo(dest AcceptFn) (*ProgressState, int64) {
+	tracker := NewProgressTracker()
+	newWm := NO_NEW_WM
+	for i, queue := range s.queues {
+		if s.doneQueues[i] || s.waitForAlignment && s.barrierQueues[i] {
+			continue
+		}
+		queueIndex := s.queueOffset + i
+		var wm *Watermark
+		drained := queue.drain(func(item interface{}) bool {
+			switch v := item.(type) {
+			case *doneItem:
+				s.doneQueues[i] = true
+				return false
+			case *Watermark:
+				wm = v
+				return false
+			case *SnapshotBarrier:
+				s.observeBarrier(i, v.snapshotId)
+				return false
+			}
+			s.coalescer.observeEvent(queueIndex)
+			dest(item)
+			return true
+		})
+		if drained > 0 {
+			tracker.madeProgress()
+		}
+		if wm != nil {
+			newWm = s.coalescer.observeWm(queueIndex, wm.timestamp)
+		} else if s.doneQueues[i] {
+			newWm = s.coalescer.queueDone(queueIndex)
+		}
+		if newWm != NO_NEW_WM {
+			break
+		}
+	}
+	for _, done := range s.doneQueues {
+		if !done {
+			tracker.notDone()
+			break
+		}
+	}
+	return tracker.toProgressState(), newWm
+}
+
+func (s *InboundEdgeStream) observeBarrier(queueIndex int, snapshotId int64) {
+	if s.pendingSnapshotId != NO_SNAPSHOT && s.pendingSnapshotId != snapshotId {
+		panic(fmt.Sprintf("Barrier of snapshot %d arrived while waiting for the barrier of snapshot %d", snapshotId, s.pendingSnapshotId))
+	}
+	s.pendingSnapshotId = snapshotId
+	s.barrierQueues[queueIndex] = true
+}
+
+// receivedBarrier return the id of the snapshot whose barrier arrived on all the queues that are not done,
+// NO_SNAPSHOT if it is still missing on some of them
+func (s *InboundEdgeStream) receivedBarrier() int64 {
+	if s.pendingSnapshotId == NO_SNAPSHOT {
+		return NO_SNAPSHOT
+	}
+	for i := range s.queues {
+		if !s.doneQueues[i] && !s.barrierQueues[i] {
+			return NO_SNAPSHOT
+		}
+	}
+	return s.pendingSnapshotId
+}
+
+// releaseBarrier called after the snapshot was taken, the queues are drained past the barrier again
+func (s *InboundEdgeStream) releaseBarrier() {
+	s.pendingSnapshotId = NO_SNAPSHOT
+	for i := range s.barrierQueues {
+		s.barrierQueues[i] = false
+	}
+}
@@ -57,10 +57,11 @@ func TestEdge_whenPartitionedByKey_thenPartitionerExtractsKey(t *testing.T) {
 	}, NewDefaultPartitioner())
 	partitioner := e.partitioner
 	assert.NotNil(t, partitioner)
-	partitioner.init(DefaultPartitionStrategyImpl{})
+	strategy := NewDefaultPartitionStrategy(DEFAULT_PARTITION_COUNT)
+	partitioner.init(strategy)
 
 	assert.Equal(t, PARTITIONED, e.routingPolicy)
-	assert.Equal(t, partitioningKey, partitioner.getPartition(13, 0))
+	assert.Equal(t, strategy.getPartition(partitioningKey), partitioner.getPartition(13, DEFAULT_PARTITION_COUNT))
 }
 
 func TestEdge_whenPartitionedByCustom_thenCustomPartitioned(t *testing.T) {
@@ -92,3 +93,49 @@ func TestEdge_whenAllToOne_thenAlwaysSamePartition(t *testing.T) {
 	assert.Equal(t, PARTITIONED, e.routingPolicy)
 	assert.Equal(t, partitioner.getPartition(17, mockPartitionCount), partitioner.getPartition(13, mockPartitionCount))
 }
+
+func TestEdge_whenSetQueueSize_thenQueueSizeSet(t *testing.T) {
+	teardownTest, et := EdgeTestSetup(t)
+	defer teardownTest(t)
+	e := Between(et.a, et.b)
+	assert.Equal(t, DEFAULT_QUEUE_SIZE, e.getQueueSize())
+	e.setQueueSize(16)
+	assert.Equal(t, 16, e.getQueueSize())
+	assert.Panics(t, func() {
+		e.setQueueSize(0)
+	})
+}
+
+func TestEdge_whenIsolated_thenEachDownstreamConnectedToOneUpstream(t *testing.T) {
+	teardownTest, et := EdgeTestSetup(t)
+	defer teardownTest(t)
+	e := Between(et.a, et.b).isolated()
+	assert.Equal(t, ISOLATED, e.routingPolicy)
+
+	for downstream := 0; downstream < 5; downstream++ {
+		connected := 0
+		for upstream := 0; upstream < 2; upstream++ {
+			if e.isConnected(upstream, downstream, 2, 5) {
+				connected++
+			}
+		}
+		assert.Equal(t, 1, connected)
+	}
+	for upstream := 0; upstream < 5; upstream++ {
+		connected := 0
+		for downstream := 0; downstream < 2; downstream++ {
+			if e.isConnected(upstream, downstream, 5, 2) {
+				connected++
+			}
+		}
+		assert.Equal(t, 1, connected)
+	}
+}
+
+func TestEdge_whenFanout_thenPolicySetAndAllConnected(t *testing.T) {
+	teardownTest, et := EdgeTestSetup(t)
+	defer teardownTest(t)
+	e := Between(et.a, et.b).fanout()
+	assert.Equal(t, FANOUT, e.routingPolicy)
+	assert.True(t, e.isConnected(0, 1, 2, 2))
+}
@@ -35,6 +35,48 @@ func NewEventTimePolicyNoWrapping(timestampFn ApplyAsLongFn, newWmPolicyFn GetFn
 	}, idleTimeoutMillis: idleTimeoutMillis, watermarkThrottlingFrameSize: watermarkThrottlingFrameSize, watermarkThrottlingFrameOffset: watermarkThrottlingFrameOffset}
 }
 
+// InsertWatermarksP assigns the timestamps to the items and inserts watermarks into the stream according to the
+// EventTimePolicy, the watermarks coming from upstream are replaced by its own
+type InsertWatermarksP struct {
+	*AbstractProcessor
+	eventTimeMapper *EventTimeMapper
+	traverser       Traverser
+}
+
+func NewInsertWatermarksP(eventTimePolicy EventTimePolicy) *InsertWatermarksP {
+	p := &InsertWatermarksP{eventTimeMapper: NewEventTimeMapper(eventTimePolicy)}
+	p.AbstractProcessor = NewAbstractProcessor(p)
+	p.eventTimeMapper.addPartitions(time.Now().UnixNano(), 1)
+	return p
+}
+
+func (p *InsertWatermarksP) tryProcess(ordinal int, item interface{}) bool {
+	if p.traverser == nil {
+		p.traverser = p.eventTimeMapper.flatMapEvent(time.Now().UnixNano(), item, 0, p.eventTimeMapper.NO_NATIVE_TIME)
+	}
+	if p.emitFromTraverser(-1, p.traverser) {
+		p.traverser = nil
+		return true
+	}
+	return false
+}
+
+// tryProcessIdle a policy may advance the watermark while no items arrive
+func (p *InsertWatermarksP) tryProcessIdle() bool {
+	if p.traverser == nil {
+		p.traverser = p.eventTimeMapper.flatMapIdle()
+	}
+	if p.emitFromTraverser(-1, p.traverser) {
+		p.traverser = nil
+		return true
+	}
+	return false
+}
+
+func (p *InsertWatermarksP) tryProcessWatermark(watermark Watermark) bool {
+	return true
+}
+
 // EventTimeMapper a utility that helps a source emit events according to a given EventTimePolicy. Generally this struct should be used if a source needs emit Watermark
 type EventTimeMapper struct {
 	NO_NATIVE_TIME int64
@@ -90,12 +132,16 @@ func (m *EventTimeMapper) flatMapEvent(now int64, event interface{}, partitionIn
 			panic("Neither timestampFn nor nativeEventTime specified")
 		}
 	}
-	m.handleEventInternal(now, partitionIndex, eventTime)
+	m.handleEventInternal(now, partitionIndex, event, eventTime)
 	return m.traverser.append(m.wrapFn(event, eventTime))
 }
 
-func (m *EventTimeMapper) handleEventInternal(now int64, partitionIndex int, eventTime int64) {
-	m.wmPolicies[partitionIndex].reportEvent(eventTime)
+func (m *EventTimeMapper) handleEventInternal(now int64, partitionIndex int, event interface{}, eventTime int64) {
+	if policy, ok := m.wmPolicies[partitionIndex].(eventWatermarkPolicy); ok {
+		policy.reportEventItem(event, eventTime)
+	} else {
+		m.wmPolicies[partitionIndex].reportEvent(eventTime)
+	}
 	m.markIdleAt[partitionIndex] = now + m.idleTimeoutNanos
 	m.allAreIdle = false
 	m.handleNoEventInternal(now, eventTime)
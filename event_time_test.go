@@ -1,6 +1,7 @@
 package stream_processing
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"time"
@@ -82,9 +83,7 @@ func TestEventTime_zeroPartitions(t *testing.T) {
 	teardownTest, et := EventTimeTestSetup(t)
 	defer teardownTest(t)
 
-	eventTimeMapper := NewEventTimeMapper(NewEventTimePolicyNoWrapping(func(t interface{}) int64 {
-		return 0
-	}, func() interface{} {
+	eventTimeMapper := NewEventTimeMapper(NewEventTimePolicyNoWrapping(longValueFunc, func() interface{} {
 		return newLimitingLag(et.Lag)
 	}, 0, 1, 0))
 
@@ -223,3 +222,44 @@ func TestEventTime_when_twowhen_threePartitions_laggingOneRemoved_secondLaggingO
 func ns(ms int64) int64 {
 	return time.UnixMilli(ms).UnixNano()
 }
+
+func TestEventTime_when_punctuatedPolicy_then_wmAdvancedByMarkersOnly(t *testing.T) {
+	teardownTest, et := EventTimeTestSetup(t)
+	defer teardownTest(t)
+
+	eventTimeMapper := NewEventTimeMapper(NewEventTimePolicyNoWrapping(longValueFunc, func() interface{} {
+		return newPunctuated(func(t interface{}) bool {
+			return t.(int64)%10 == 0
+		})
+	}, 0, 1, 0))
+	eventTimeMapper.addPartitions(0, 1)
+
+	et.assertTraverser(t, eventTimeMapper.flatMapEvent(ns(0), int64(7), 0, Min_Value), int64(7), nil)
+	et.assertTraverser(t, eventTimeMapper.flatMapEvent(ns(0), int64(10), 0, Min_Value), NewWatermark(10), int64(10))
+	et.assertTraverser(t, eventTimeMapper.flatMapEvent(ns(0), int64(15), 0, Min_Value), int64(15), nil)
+	et.assertTraverser(t, eventTimeMapper.flatMapEvent(ns(0), int64(20), 0, Min_Value), NewWatermark(20), int64(20))
+}
+
+func TestInsertWatermarksP_when_idle_then_wmAdvancedByRealTimeLag(t *testing.T) {
+	teardownTest, _ := EventTimeTestSetup(t)
+	defer teardownTest(t)
+
+	now := int64(0)
+	p := NewInsertWatermarksP(NewEventTimePolicyNoWrapping(longValueFunc, func() interface{} {
+		policy := newLimitingRealTimeLag(0, 0)
+		policy.nowFn = func() int64 {
+			return now
+		}
+		return policy
+	}, 0, 1, 0))
+	outbox := NewTestOutbox(10)
+	p.init(context.Background(), outbox)
+
+	assert.True(t, p.tryProcess(0, int64(10)))
+	assert.Equal(t, []interface{}{NewWatermark(10), int64(10)}, outbox.drainQueueAndReset(0))
+	assert.True(t, p.tryProcessIdle())
+	assert.Empty(t, outbox.drainQueueAndReset(0))
+	now += 5
+	assert.True(t, p.tryProcessIdle())
+	assert.Equal(t, []interface{}{NewWatermark(15)}, outbox.drainQueueAndReset(0))
+}
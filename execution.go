@@ -1,10 +1,428 @@
 package stream_processing
 
-type OutboundCollector interface {
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
-	// offer an item to this collector, if the collector cannot complete the operation, the call must be retried later
-	offer(item interface{}) ProgressState
+const (
+	// MAX_IDLE_PARK the longest time an idle cooperative worker sleeps before it calls its tasklets again
+	MAX_IDLE_PARK = time.Millisecond
 
-	// getPartitions return the list of partitions handled by this collector
-	getPartitions() []int
-}
\ No newline at end of file
+	// MIN_IDLE_PARK the shortest time an idle cooperative worker sleeps
+	MIN_IDLE_PARK = 25 * time.Microsecond
+
+	// IDLE_YIELD_COUNT how many times an idle worker yields before it starts to sleep
+	IDLE_YIELD_COUNT = 10
+)
+
+// ErrServiceShutdown the cause of the executions whose tasklets were still running when the service was shut down
+var ErrServiceShutdown = errors.New("execution service was shut down")
+
+// ExecutionService runs the cooperative tasklets on a fixed pool of worker goroutines and each non-cooperative tasklet
+// on a goroutine of its own. a watchdog logs the cooperative calls that take longer than the budget.
+// the service is a member of a cluster if it has a Transport, otherwise it runs the jobs standalone
+type ExecutionService struct {
+	config    *InstanceConfig
+	workers   []*cooperativeWorker
+	address   Address
+	transport Transport
+	logger    *log.Logger
+
+	mu         sync.Mutex
+	started    bool
+	stopped    bool
+	stop       chan struct{}
+	nextWorker int
+	lastJobId  int64
+
+	handlersMu     sync.RWMutex
+	packetHandlers map[packetKey]PacketHandler
+}
+
+func NewExecutionService(config *InstanceConfig) *ExecutionService {
+	s := &ExecutionService{
+		config:         config,
+		address:        LOCAL_ADDRESS,
+		logger:         log.New(config.logOutput, "", log.LstdFlags),
+		stop:           make(chan struct{}),
+		packetHandlers: make(map[packetKey]PacketHandler),
+	}
+	for i := 0; i < config.cooperativeThreadCount; i++ {
+		s.workers = append(s.workers, newCooperativeWorker())
+	}
+	return s
+}
+
+// newJob submits the DAG for execution and returns the Job representing it, the job is cancelled together with the context
+func (s *ExecutionService) newJob(ctx context.Context, dag *DAG) *Job {
+	return s.newJobWithConfig(ctx, dag, NewJobConfig())
+}
+
+// newJobWithConfig submits the DAG for execution with the given job configuration
+func (s *ExecutionService) newJobWithConfig(ctx context.Context, dag *DAG, config *JobConfig) *Job {
+	job := NewJob(ctx, atomic.AddInt64(&s.lastJobId, 1), dag, config, []*ExecutionService{s})
+	job.start()
+	return job
+}
+
+// newPipelineJob plans the pipeline into a DAG and submits it for execution with the given job configuration
+func (s *ExecutionService) newPipelineJob(ctx context.Context, pipeline Pipeline, config *JobConfig) *Job {
+	return s.newJobWithConfig(ctx, pipeline.toDag(), config)
+}
+
+// executePipeline runs the pipeline and blocks until it is done
+func (s *ExecutionService) executePipeline(ctx context.Context, pipeline Pipeline) error {
+	return s.newPipelineJob(ctx, pipeline, NewJobConfig()).Join()
+}
+
+// execute runs the DAG and blocks until all its processors are done or the context is cancelled
+func (s *ExecutionService) execute(ctx context.Context, dag *DAG) error {
+	return s.newJob(ctx, dag).Join()
+}
+
+// beginExecute initializes the tasklets and distributes them among the workers. cancel cancels ctx, it is called as
+// soon as one of the tasklets fails so that the others stop too
+func (s *ExecutionService) beginExecute(ctx context.Context, cancel context.CancelFunc, tasklets []Tasklet) *executionTracker {
+	execution := newExecutionTracker(ctx, cancel, len(tasklets))
+	for _, t := range tasklets {
+		t.init(ctx)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		for range tasklets {
+			execution.taskletDone(ErrServiceShutdown)
+		}
+		return execution
+	}
+	if !s.started {
+		for _, w := range s.workers {
+			go w.run()
+		}
+		go s.watchdog()
+		s.started = true
+	}
+	for _, t := range tasklets {
+		tracker := &taskletTracker{tasklet: t, execution: execution}
+		if !t.isCooperative() {
+			go s.runNonCooperative(tracker)
+			continue
+		}
+		s.workers[s.nextWorker].add(tracker)
+		s.nextWorker = (s.nextWorker + 1) % len(s.workers)
+	}
+	return execution
+}
+
+// runNonCooperative calls a non-cooperative tasklet on a goroutine of its own until it is done, it may block in the calls
+func (s *ExecutionService) runNonCooperative(t *taskletTracker) {
+	idleCount := 0
+	for {
+		select {
+		case <-s.stop:
+			t.execution.taskletDone(ErrServiceShutdown)
+			return
+		default:
+		}
+		if err := t.execution.ctx.Err(); err != nil {
+			t.execution.taskletDone(err)
+			return
+		}
+		result, err := callTasklet(t.tasklet)
+		if err != nil || result.isDone {
+			t.execution.taskletDone(err)
+			return
+		}
+		if result.madeProgress {
+			idleCount = 0
+		} else {
+			idle(idleCount)
+			idleCount++
+		}
+	}
+}
+
+// watchdog periodically checks the cooperative workers and logs the calls that exceed the cooperative call budget
+func (s *ExecutionService) watchdog() {
+	budget := s.config.cooperativeCallBudget
+	ticker := time.NewTicker(budget / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			for _, w := range s.workers {
+				w.checkCallDuration(now, budget, s.logger)
+			}
+		}
+	}
+}
+
+// setTransport makes this service a cluster member reachable through the transport
+func (s *ExecutionService) setTransport(transport Transport) {
+	s.transport = transport
+	s.address = transport.localAddress()
+	transport.setPacketHandler(s.handlePacket)
+}
+
+// handlePacket passes the packet to the tasklet it is addressed to. the packets of a job that is not running anymore are dropped
+func (s *ExecutionService) handlePacket(packet *Packet) {
+	key := packetKey{packetType: packet.packetType, jobId: packet.jobId, vertexName: packet.vertexName, ordinal: packet.ordinal, peer: packet.sender}
+	s.handlersMu.RLock()
+	handler, ok := s.packetHandlers[key]
+	s.handlersMu.RUnlock()
+	if ok {
+		handler(packet)
+	}
+}
+
+// registerPacketHandler routes the packets matching the key to the handler
+func (s *ExecutionService) registerPacketHandler(key packetKey, handler PacketHandler) {
+	s.handlersMu.Lock()
+	defer s.handlersMu.Unlock()
+	s.packetHandlers[key] = handler
+}
+
+// unregisterJob removes the packet handlers of the job
+func (s *ExecutionService) unregisterJob(jobId int64) {
+	s.handlersMu.Lock()
+	defer s.handlersMu.Unlock()
+	for key := range s.packetHandlers {
+		if key.jobId == jobId {
+			delete(s.packetHandlers, key)
+		}
+	}
+}
+
+// shutdown stops the worker goroutines and the watchdog, the tasklets that are still running are done with ErrServiceShutdown
+func (s *ExecutionService) shutdown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+	s.stopped = true
+	close(s.stop)
+	for _, w := range s.workers {
+		close(w.stop)
+	}
+}
+
+// TaskletPanicError the failure of a tasklet whose call panicked, typically because its processor panicked in process or complete
+type TaskletPanicError struct {
+	taskletName string
+	value       interface{}
+	stack       []byte
+}
+
+func (e *TaskletPanicError) Error() string {
+	return fmt.Sprintf("tasklet %s panicked: %v", e.taskletName, e.value)
+}
+
+// getStack return the stack trace of the goroutine at the time of the panic
+func (e *TaskletPanicError) getStack() string {
+	return string(e.stack)
+}
+
+// callTasklet calls the tasklet once, a panic in the call is recovered and returned as a TaskletPanicError
+func callTasklet(t Tasklet) (result *ProgressState, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &TaskletPanicError{taskletName: t.name(), value: r, stack: debug.Stack()}
+		}
+	}()
+	return t.call(), nil
+}
+
+// executionTracker tracks the tasklets of a single execution
+type executionTracker struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	remaining int32
+	done      chan struct{}
+
+	errOnce sync.Once
+	err     error
+}
+
+func newExecutionTracker(ctx context.Context, cancel context.CancelFunc, taskletCount int) *executionTracker {
+	e := &executionTracker{ctx: ctx, cancel: cancel, remaining: int32(taskletCount), done: make(chan struct{})}
+	if taskletCount == 0 {
+		close(e.done)
+	}
+	return e
+}
+
+// taskletDone called by a worker after one of the tasklets finished, err is the cause if it didn't complete normally.
+// the first failure cancels the execution
+func (e *executionTracker) taskletDone(err error) {
+	if err != nil {
+		e.errOnce.Do(func() {
+			e.err = err
+			e.cancel()
+		})
+	}
+	if atomic.AddInt32(&e.remaining, -1) == 0 {
+		close(e.done)
+	}
+}
+
+// await blocks until all tasklets are done, return the cause of failure or cancellation
+func (e *executionTracker) await() error {
+	<-e.done
+	return e.err
+}
+
+// taskletTracker a tasklet scheduled on a worker
+type taskletTracker struct {
+	tasklet   Tasklet
+	execution *executionTracker
+}
+
+// cooperativeWorker calls its tasklets one after another in a loop, it backs off when none of them made progress
+type cooperativeWorker struct {
+	mu       sync.Mutex
+	incoming []*taskletTracker
+	trackers []*taskletTracker
+	wake     chan struct{}
+	stop     chan struct{}
+
+	// callStart the start of the running call in nanoseconds, 0 between the calls. callTasklet the tasklet being
+	// called and callReported whether the running call was already logged as too long
+	callStart    int64
+	callTasklet  atomic.Value
+	callReported int32
+}
+
+func newCooperativeWorker() *cooperativeWorker {
+	return &cooperativeWorker{wake: make(chan struct{}, 1), stop: make(chan struct{})}
+}
+
+func (w *cooperativeWorker) add(tracker *taskletTracker) {
+	w.mu.Lock()
+	w.incoming = append(w.incoming, tracker)
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *cooperativeWorker) run() {
+	idleCount := 0
+	for {
+		w.mu.Lock()
+		w.trackers = append(w.trackers, w.incoming...)
+		w.incoming = nil
+		w.mu.Unlock()
+
+		if len(w.trackers) == 0 {
+			select {
+			case <-w.wake:
+				continue
+			case <-w.stop:
+				w.abandon()
+				return
+			}
+		}
+		select {
+		case <-w.stop:
+			w.abandon()
+			return
+		default:
+		}
+
+		madeProgress := false
+		for i := 0; i < len(w.trackers); {
+			t := w.trackers[i]
+			if err := t.execution.ctx.Err(); err != nil {
+				w.removeTracker(i)
+				t.execution.taskletDone(err)
+				continue
+			}
+			result, err := w.call(t)
+			if err != nil || result.isDone {
+				w.removeTracker(i)
+				t.execution.taskletDone(err)
+				continue
+			}
+			madeProgress = madeProgress || result.madeProgress
+			i++
+		}
+		if madeProgress {
+			idleCount = 0
+		} else {
+			idle(idleCount)
+			idleCount++
+		}
+	}
+}
+
+// abandon completes the tasklets of the stopped worker with ErrServiceShutdown, so their executions don't wait for them
+func (w *cooperativeWorker) abandon() {
+	w.mu.Lock()
+	w.trackers = append(w.trackers, w.incoming...)
+	w.incoming = nil
+	w.mu.Unlock()
+	for _, t := range w.trackers {
+		t.execution.taskletDone(ErrServiceShutdown)
+	}
+	w.trackers = nil
+}
+
+// call calls the tasklet and records the start of the call for the watchdog
+func (w *cooperativeWorker) call(t *taskletTracker) (*ProgressState, error) {
+	w.callTasklet.Store(t)
+	atomic.StoreInt32(&w.callReported, 0)
+	atomic.StoreInt64(&w.callStart, time.Now().UnixNano())
+	result, err := callTasklet(t.tasklet)
+	atomic.StoreInt64(&w.callStart, 0)
+	return result, err
+}
+
+// checkCallDuration logs the running call if it exceeded the budget, each call is logged at most once
+func (w *cooperativeWorker) checkCallDuration(now time.Time, budget time.Duration, logger *log.Logger) {
+	start := atomic.LoadInt64(&w.callStart)
+	if start == 0 {
+		return
+	}
+	elapsed := time.Duration(now.UnixNano() - start)
+	if elapsed <= budget || !atomic.CompareAndSwapInt32(&w.callReported, 0, 1) {
+		return
+	}
+	t := w.callTasklet.Load().(*taskletTracker)
+	logger.Printf("Cooperative tasklet %s has been running for %v, longer than the budget of %v. it should not block", t.tasklet.name(), elapsed, budget)
+}
+
+func (w *cooperativeWorker) removeTracker(i int) {
+	w.trackers[i] = w.trackers[len(w.trackers)-1]
+	w.trackers[len(w.trackers)-1] = nil
+	w.trackers = w.trackers[:len(w.trackers)-1]
+}
+
+// idle backs off a worker that made no progress: it yields first, then sleeps for exponentially growing periods
+func idle(idleCount int) {
+	if idleCount < IDLE_YIELD_COUNT {
+		runtime.Gosched()
+		return
+	}
+	shift := idleCount - IDLE_YIELD_COUNT
+	if shift > 6 {
+		shift = 6
+	}
+	park := MIN_IDLE_PARK << uint(shift)
+	if park > MAX_IDLE_PARK {
+		park = MAX_IDLE_PARK
+	}
+	time.Sleep(park)
+}
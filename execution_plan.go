@@ -0,0 +1,320 @@
+package stream_processing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// ExecutionPlan the runtime form of a DAG on one member: the processor instances of every vertex, the queues
+// connecting them and the tasklets driving them
+type ExecutionPlan struct {
+	dag       *DAG
+	config    *InstanceConfig
+	service   *ExecutionService
+	jobId     int64
+	jobConfig *JobConfig
+	tasklets  []Tasklet
+	suppliers map[*Vertex]ProcessorSupplier
+
+	// members the addresses of all members running the job, memberIndex is the index of this member
+	members     []Address
+	memberIndex int
+
+	processors map[*Vertex][]Processor
+
+	// snapshotContext the snapshots in progress on this member, shared by the processor tasklets
+	snapshotContext *SnapshotContext
+
+	// edgeQueues holds for every edge the conveyor from each upstream to each downstream processor, indexed as [upstream][downstream].
+	// the queue is nil if the edge doesn't connect the two processors
+	edgeQueues map[*Edge][][]Queue
+
+	// senderQueues holds for every distributed edge the conveyor from each upstream processor to the SenderTasklet
+	// of each member, indexed as [upstream][member]. receiverQueues holds the conveyor from the ReceiverTasklet of
+	// each member to each downstream processor, indexed as [member][downstream]. the queues of this member are nil
+	senderQueues   map[*Edge][][]Queue
+	receiverQueues map[*Edge][][]Queue
+}
+
+func NewExecutionPlan(service *ExecutionService, jobId int64, jobConfig *JobConfig, dag *DAG, members []Address, suppliers map[*Vertex]ProcessorSupplier) *ExecutionPlan {
+	p := &ExecutionPlan{
+		dag:            dag,
+		config:         service.config,
+		service:        service,
+		jobId:          jobId,
+		jobConfig:      jobConfig,
+		suppliers:      suppliers,
+		members:        members,
+		processors:     make(map[*Vertex][]Processor),
+		edgeQueues:     make(map[*Edge][][]Queue),
+		senderQueues:   make(map[*Edge][][]Queue),
+		receiverQueues: make(map[*Edge][][]Queue),
+	}
+	for i, address := range members {
+		if address == service.address {
+			p.memberIndex = i
+		}
+	}
+	return p
+}
+
+// initialize creates the processors, the queues and the tasklets. if snapshot isn't nil the processors restore their
+// state from it before they process any item. return an error if a ProcessorSupplier didn't return as many processors
+// as the local parallelism of its vertex
+func (p *ExecutionPlan) initialize(ctx context.Context, snapshot *Snapshot) error {
+	vertices := p.dag.iterator()
+	for _, v := range vertices {
+		localParallelism := v.determineLocalParallelism(p.config.cooperativeThreadCount)
+		supplier := p.suppliers[v]
+		supplier.init(ctx)
+		processors := supplier.Get(localParallelism)
+		if len(processors) != localParallelism {
+			return fmt.Errorf("ProcessorSupplier of vertex %s returned %d processors instead of %d", v.name, len(processors), localParallelism)
+		}
+		p.processors[v] = processors
+	}
+	for _, e := range p.dag.edges.Values() {
+		edge := e.(*Edge)
+		upstreamParallelism, downstreamParallelism := len(p.processors[edge.source]), len(p.processors[edge.destination])
+		queues := make([][]Queue, upstreamParallelism)
+		for i := range queues {
+			queues[i] = make([]Queue, downstreamParallelism)
+			for j := range queues[i] {
+				if edge.isConnected(i, j, upstreamParallelism, downstreamParallelism) {
+					queues[i][j] = NewConveyor(edge.queueSize)
+				}
+			}
+		}
+		p.edgeQueues[edge] = queues
+		if edge.routingPolicy == PARTITIONED {
+			// the processors share the partitioner of the edge, it is initialized before any of them runs
+			edge.partitioner.init(NewDefaultPartitionStrategy(p.config.partitionCount))
+		}
+		if p.isDistributed(edge) {
+			p.initDistributedEdge(edge)
+		}
+	}
+	processorCount := 0
+	for _, processors := range p.processors {
+		processorCount += len(processors)
+	}
+	p.snapshotContext = NewSnapshotContext(processorCount, p.service.config.serializerRegistry)
+	for _, v := range vertices {
+		inboundEdges := sortedEdges(p.dag.getInboundEdges(v.name), func(e *Edge) int {
+			return e.destOrdinal
+		}, v.name, "inbound")
+		outboundEdges := sortedEdges(p.dag.getOutboundEdges(v.name), func(e *Edge) int {
+			return e.sourceOrdinal
+		}, v.name, "outbound")
+		var restoredEntries [][]MapEntry
+		if snapshot != nil {
+			restoredEntries = p.snapshotEntriesOf(v, snapshot)
+		}
+		for i, processor := range p.processors[v] {
+			context := NewProcessorContext(p.jobId, v.name, i, len(p.processors[v]), p.memberIndex, len(p.members),
+				p.jobConfig.processingGuarantee, p.config)
+			instreams := p.createInboundEdgeStreams(inboundEdges, i)
+			outbox := NewOutboxImpl(p.createOutboundCollectors(outboundEdges, i), OUTBOX_BATCH_SIZE)
+			tasklet := NewProcessorTasklet(context, processor, instreams, outbox, p.snapshotContext)
+			if snapshot != nil {
+				tasklet.restoreFrom(restoredEntries[i])
+			}
+			p.tasklets = append(p.tasklets, tasklet)
+		}
+	}
+	return nil
+}
+
+// snapshotEntriesOf splits the entries saved by the processors of the vertex among its processors on this member. an
+// entry with a BroadcastKey goes to all of them, any other to the processor with the global index partition % total
+// parallelism, like the items of a distributed partitioned edge
+func (p *ExecutionPlan) snapshotEntriesOf(v *Vertex, snapshot *Snapshot) [][]MapEntry {
+	localParallelism := len(p.processors[v])
+	totalParallelism := localParallelism * len(p.members)
+	strategy := NewDefaultPartitionStrategy(p.config.partitionCount)
+	entries := make([][]MapEntry, localParallelism)
+	for _, entry := range snapshot.getState(v.name) {
+		if _, ok := entry.key.(BroadcastKey); ok {
+			for i := range entries {
+				entries[i] = append(entries[i], entry)
+			}
+			continue
+		}
+		localIndex := strategy.getPartition(entry.key)%totalParallelism - p.memberIndex*localParallelism
+		if localIndex >= 0 && localIndex < localParallelism {
+			entries[localIndex] = append(entries[localIndex], entry)
+		}
+	}
+	return entries
+}
+
+// isDistributed tells whether the items of the edge travel to other members
+func (p *ExecutionPlan) isDistributed(edge *Edge) bool {
+	return edge.isDistributed && len(p.members) > 1
+}
+
+// initDistributedEdge creates the queues and a SenderTasklet and a ReceiverTasklet for each of the other members
+func (p *ExecutionPlan) initDistributedEdge(edge *Edge) {
+	if edge.routingPolicy == ISOLATED {
+		panic(fmt.Sprintf("Isolated edge %s can't be distributed", edge.toString()))
+	}
+	upstreamParallelism, downstreamParallelism := len(p.processors[edge.source]), len(p.processors[edge.destination])
+	senderQueues := make([][]Queue, upstreamParallelism)
+	for i := range senderQueues {
+		senderQueues[i] = make([]Queue, len(p.members))
+	}
+	receiverQueues := make([][]Queue, len(p.members))
+	for m, address := range p.members {
+		if m == p.memberIndex {
+			continue
+		}
+		var toSender []Queue
+		for i := range senderQueues {
+			senderQueues[i][m] = NewConveyor(edge.queueSize)
+			toSender = append(toSender, senderQueues[i][m])
+		}
+		sender := NewSenderTasklet(p.service.transport, p.service.config.serializerRegistry, address, p.jobId, edge, toSender, p.jobConfig.processingGuarantee == EXACTLY_ONCE)
+		p.service.registerPacketHandler(p.packetKey(ACK_PACKET, edge, address), sender.onAck)
+
+		receiverQueues[m] = make([]Queue, downstreamParallelism)
+		collectors := make([]OutboundCollector, downstreamParallelism)
+		for j := range receiverQueues[m] {
+			receiverQueues[m][j] = NewConveyor(edge.queueSize)
+			collectors[j] = NewConveyorCollector(receiverQueues[m][j], p.partitionsOf(edge, p.memberIndex, j))
+		}
+		receiver := NewReceiverTasklet(p.service.transport, p.service.config.serializerRegistry, address, p.jobId, edge, p.newRoutingCollector(edge, collectors))
+		p.service.registerPacketHandler(p.packetKey(DATA_PACKET, edge, address), receiver.onPacket)
+
+		p.tasklets = append(p.tasklets, sender, receiver)
+	}
+	p.senderQueues[edge] = senderQueues
+	p.receiverQueues[edge] = receiverQueues
+}
+
+func (p *ExecutionPlan) packetKey(packetType PacketType, edge *Edge, peer Address) packetKey {
+	return packetKey{packetType: packetType, jobId: p.jobId, vertexName: edge.destName, ordinal: edge.destOrdinal, peer: peer}
+}
+
+// createInboundEdgeStreams creates the inbound streams of the processor with the given index, they share one WatermarkCoalescer.
+// with the EXACTLY_ONCE guarantee the streams wait for the alignment of the barriers, a job whose edges of a vertex have
+// different priorities is rejected with it, see Job.checkProcessingGuarantee
+func (p *ExecutionPlan) createInboundEdgeStreams(inboundEdges []*Edge, processorIndex int) []*InboundEdgeStream {
+	edgeQueues := make([][]Queue, len(inboundEdges))
+	queueCount := 0
+	for i, edge := range inboundEdges {
+		for _, downstreamQueues := range p.edgeQueues[edge] {
+			if queue := downstreamQueues[processorIndex]; queue != nil {
+				edgeQueues[i] = append(edgeQueues[i], queue)
+			}
+		}
+		for _, downstreamQueues := range p.receiverQueues[edge] {
+			if downstreamQueues != nil {
+				edgeQueues[i] = append(edgeQueues[i], downstreamQueues[processorIndex])
+			}
+		}
+		queueCount += len(edgeQueues[i])
+	}
+	waitForAlignment := p.jobConfig.processingGuarantee == EXACTLY_ONCE
+	coalescer := NewWatermarkCoalescer(queueCount)
+	var instreams []*InboundEdgeStream
+	queueOffset := 0
+	for i, edge := range inboundEdges {
+		instream := NewInboundEdgeStream(edge.destOrdinal, edge.priority, edgeQueues[i], coalescer, queueOffset)
+		instreams = append(instreams, instream.setWaitForAlignment(waitForAlignment))
+		queueOffset += len(edgeQueues[i])
+	}
+	return instreams
+}
+
+// createOutboundCollectors creates one collector for each outbound edge of the processor with the given index, the
+// collector routes the items according to the edge's routing policy. on a distributed edge each of the other members
+// is reached through a single collector
+func (p *ExecutionPlan) createOutboundCollectors(outboundEdges []*Edge, processorIndex int) []OutboundCollector {
+	var outstreams []OutboundCollector
+	for _, edge := range outboundEdges {
+		var collectors []OutboundCollector
+		for j, queue := range p.edgeQueues[edge][processorIndex] {
+			if queue != nil {
+				collectors = append(collectors, NewConveyorCollector(queue, p.partitionsOf(edge, p.memberIndex, j)))
+			}
+		}
+		if !p.isDistributed(edge) {
+			outstreams = append(outstreams, p.newRoutingCollector(edge, collectors))
+			continue
+		}
+		var memberCollectors []OutboundCollector
+		for m, queue := range p.senderQueues[edge][processorIndex] {
+			if queue == nil {
+				continue
+			}
+			var partitions []int
+			for j := range p.processors[edge.destination] {
+				partitions = append(partitions, p.partitionsOf(edge, m, j)...)
+			}
+			memberCollectors = append(memberCollectors, NewConveyorCollector(queue, partitions))
+		}
+		if edge.routingPolicy == FANOUT {
+			memberCollectors = append(memberCollectors, NewRoundRobinCollector(collectors))
+			outstreams = append(outstreams, NewFanOutCollector(memberCollectors))
+		} else {
+			outstreams = append(outstreams, p.newRoutingCollector(edge, append(collectors, memberCollectors...)))
+		}
+	}
+	return outstreams
+}
+
+// newRoutingCollector creates the collector that routes the items among the given collectors according to the
+// edge's routing policy. within a member, a FANOUT edge behaves like a UNICAST edge
+func (p *ExecutionPlan) newRoutingCollector(edge *Edge, collectors []OutboundCollector) OutboundCollector {
+	switch edge.routingPolicy {
+	case UNICAST, ISOLATED, FANOUT:
+		return NewRoundRobinCollector(collectors)
+	case BROADCAST:
+		return NewBroadcastCollector(collectors)
+	case PARTITIONED:
+		return NewPartitionedCollector(edge.partitioner, p.config.partitionCount, collectors)
+	}
+	panic(fmt.Sprintf("Routing policy %d of edge %s is not supported", edge.routingPolicy, edge.toString()))
+}
+
+// partitionsOf return the partitions assigned to the downstream processor of the edge with the given index on the
+// given member. partition p goes to the processor with global index p % total parallelism, a local edge only spans
+// the processors of this member
+func (p *ExecutionPlan) partitionsOf(edge *Edge, memberIndex, processorIndex int) []int {
+	processorCount := len(p.processors[edge.destination])
+	globalIndex := processorIndex
+	if p.isDistributed(edge) {
+		globalIndex = memberIndex*processorCount + processorIndex
+		processorCount *= len(p.members)
+	}
+	var partitions []int
+	for partition := globalIndex; partition < p.config.partitionCount; partition += processorCount {
+		partitions = append(partitions, partition)
+	}
+	return partitions
+}
+
+// close notifies the processor suppliers that the execution finished, err is nil if it completed successfully
+func (p *ExecutionPlan) close(err error) {
+	for _, supplier := range p.suppliers {
+		supplier.close(err)
+	}
+}
+
+// sortedEdges sorts the edges by the ordinal and checks that the ordinals are consecutive starting from 0
+func sortedEdges(edges []interface{}, ordinalFn func(e *Edge) int, vertexName, direction string) []*Edge {
+	sorted := make([]*Edge, len(edges))
+	for i, e := range edges {
+		sorted[i] = e.(*Edge)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return ordinalFn(sorted[i]) < ordinalFn(sorted[j])
+	})
+	for i, e := range sorted {
+		if ordinalFn(e) != i {
+			panic(fmt.Sprintf("Vertex %s has %s edge at ordinal %d, the ordinals must be consecutive starting from 0", vertexName, direction, ordinalFn(e)))
+		}
+	}
+	return sorted
+}
@@ -0,0 +1,489 @@
+package stream_processing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ExecutionTest struct {
+	service *ExecutionService
+	mu      sync.Mutex
+	sunk    []interface{}
+}
+
+func (et *ExecutionTest) sinkSupplier() GetFn {
+	return func() interface{} {
+		return NewWriteFnSinkP(func(t interface{}) {
+			et.mu.Lock()
+			defer et.mu.Unlock()
+			et.sunk = append(et.sunk, t)
+		})
+	}
+}
+
+func ExecutionTestSetup(tb testing.TB) (func(tb testing.TB), *ExecutionTest) {
+	et := &ExecutionTest{}
+	et.service = NewExecutionService(NewInstanceConfig().setCooperativeThreadCount(4))
+
+	return func(tb testing.TB) {
+		et.service.shutdown()
+		tb.Log("ExecutionTestSetup teardown")
+	}, et
+}
+
+// neverCompletingP a source that never completes, like a stream source without data
+type neverCompletingP struct {
+	*NoopP
+}
+
+func (p neverCompletingP) complete() bool {
+	return false
+}
+
+// nonCooperativeNeverCompletingP a never completing source that runs on a goroutine of its own
+type nonCooperativeNeverCompletingP struct {
+	neverCompletingP
+}
+
+func (p nonCooperativeNeverCompletingP) isCooperative() bool {
+	return false
+}
+
+func sequence(count int) []interface{} {
+	items := make([]interface{}, count)
+	for i := range items {
+		items[i] = i
+	}
+	return items
+}
+
+func TestExecutionService_when_sourceMapSink_then_allItemsMapped(t *testing.T) {
+	teardownTest, et := ExecutionTestSetup(t)
+	defer teardownTest(t)
+
+	dag := NewDAG()
+	source := dag.newVertex("source", func() interface{} {
+		return NewListSourceP(sequence(1000))
+	}).setLocalParallelism(1)
+	mapper := dag.newVertex("map", func() interface{} {
+		return NewMapP(func(t interface{}) interface{} {
+			return t.(int) * 2
+		})
+	})
+	sink := dag.newVertex("sink", et.sinkSupplier()).setLocalParallelism(2)
+	dag.edge(Between(source, mapper)).edge(Between(mapper, sink))
+
+	assert.NoError(t, et.service.execute(context.Background(), dag))
+
+	expected := make([]interface{}, 1000)
+	for i := range expected {
+		expected[i] = i * 2
+	}
+	assert.ElementsMatch(t, expected, et.sunk)
+}
+
+func TestExecutionService_when_partitionedEdge_then_aggregatedPerProcessor(t *testing.T) {
+	teardownTest, et := ExecutionTestSetup(t)
+	defer teardownTest(t)
+
+	dag := NewDAG()
+	source := dag.newVertex("source", func() interface{} {
+		return NewListSourceP(sequence(100))
+	}).setLocalParallelism(1)
+	count := dag.newVertex("count", func() interface{} {
+		return NewAggregateP(counting())
+	}).setLocalParallelism(1)
+	sink := dag.newVertex("sink", et.sinkSupplier()).setLocalParallelism(1)
+	dag.edge(Between(source, count).allToOne("key")).edge(Between(count, sink))
+
+	assert.NoError(t, et.service.execute(context.Background(), dag))
+	assert.Equal(t, []interface{}{int64(100)}, et.sunk)
+}
+
+func TestExecutionService_when_broadcastEdge_then_everyProcessorGetsAllItems(t *testing.T) {
+	teardownTest, et := ExecutionTestSetup(t)
+	defer teardownTest(t)
+
+	dag := NewDAG()
+	source := dag.newVertex("source", func() interface{} {
+		return NewListSourceP(sequence(10))
+	}).setLocalParallelism(1)
+	sink := dag.newVertex("sink", et.sinkSupplier()).setLocalParallelism(3)
+	dag.edge(Between(source, sink).broadcast())
+
+	assert.NoError(t, et.service.execute(context.Background(), dag))
+	assert.Len(t, et.sunk, 30)
+}
+
+func TestExecutionService_when_watermarks_then_coalescedAndForwarded(t *testing.T) {
+	teardownTest, et := ExecutionTestSetup(t)
+	defer teardownTest(t)
+
+	dag := NewDAG()
+	source := dag.newVertex("source", func() interface{} {
+		return NewListSourceP([]interface{}{1, NewWatermark(10), 2, NewWatermark(20)})
+	}).setLocalParallelism(2)
+	mapper := dag.newVertex("map", func() interface{} {
+		return NewMapP(func(t interface{}) interface{} {
+			return t
+		})
+	}).setLocalParallelism(1)
+	var wms []int64
+	sink := dag.newVertex("sink", func() interface{} {
+		return &watermarkRecordingP{NoopP: NewNoopP(), wms: &wms}
+	}).setLocalParallelism(1)
+	dag.edge(Between(source, mapper)).edge(Between(mapper, sink))
+
+	assert.NoError(t, et.service.execute(context.Background(), dag))
+	assert.Equal(t, []int64{10, 20}, wms)
+}
+
+type watermarkRecordingP struct {
+	*NoopP
+	wms *[]int64
+}
+
+func (p *watermarkRecordingP) tryProcessWatermark(watermark Watermark) bool {
+	*p.wms = append(*p.wms, watermark.timestamp)
+	return true
+}
+
+func TestExecutionService_when_cancelled_then_executionStops(t *testing.T) {
+	teardownTest, et := ExecutionTestSetup(t)
+	defer teardownTest(t)
+
+	dag := NewDAG()
+	dag.newVertex("source", func() interface{} {
+		return neverCompletingP{NoopP: NewNoopP()}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, ErrJobCancelled, et.service.execute(ctx, dag))
+}
+
+func TestExecutionService_when_moreItemsThanQueueCapacity_then_backpressureDeliversAll(t *testing.T) {
+	teardownTest, et := ExecutionTestSetup(t)
+	defer teardownTest(t)
+
+	dag := NewDAG()
+	source := dag.newVertex("source", func() interface{} {
+		return NewListSourceP(sequence(10 * DEFAULT_QUEUE_SIZE))
+	}).setLocalParallelism(1)
+	sink := dag.newVertex("sink", et.sinkSupplier()).setLocalParallelism(1)
+	dag.edge(Between(source, sink))
+
+	assert.NoError(t, et.service.execute(context.Background(), dag))
+	assert.Equal(t, sequence(10*DEFAULT_QUEUE_SIZE), et.sunk)
+}
+
+// recordingSinkSupplier a supplier whose processors record the received items, each processor into its own list
+func (et *ExecutionTest) recordingSinkSupplier(received *[][]interface{}) GetFn {
+	return func() interface{} {
+		index := len(*received)
+		*received = append(*received, nil)
+		return NewWriteFnSinkP(func(t interface{}) {
+			et.mu.Lock()
+			defer et.mu.Unlock()
+			(*received)[index] = append((*received)[index], t)
+		})
+	}
+}
+
+// numberedSourceSupplier a supplier whose n-th processor emits n*1000, n*1000+1, ... n*1000+count-1
+func numberedSourceSupplier(count int) GetFn {
+	sourceIndex := 0
+	return func() interface{} {
+		items := make([]interface{}, count)
+		for i := range items {
+			items[i] = sourceIndex*1000 + i
+		}
+		sourceIndex++
+		return NewListSourceP(items)
+	}
+}
+
+func TestExecutionService_when_isolatedEdgeToHigherParallelism_then_eachProcessorFedBySingleSource(t *testing.T) {
+	teardownTest, et := ExecutionTestSetup(t)
+	defer teardownTest(t)
+
+	var received [][]interface{}
+	dag := NewDAG()
+	source := dag.newVertex("source", numberedSourceSupplier(100)).setLocalParallelism(2)
+	sink := dag.newVertex("sink", et.recordingSinkSupplier(&received)).setLocalParallelism(4)
+	dag.edge(Between(source, sink).isolated())
+
+	assert.NoError(t, et.service.execute(context.Background(), dag))
+	total := 0
+	for _, items := range received {
+		assert.NotEmpty(t, items)
+		for i, item := range items {
+			assert.Equal(t, items[0].(int)/1000, item.(int)/1000)
+			if i > 0 {
+				assert.Less(t, items[i-1], item)
+			}
+		}
+		total += len(items)
+	}
+	assert.Equal(t, 200, total)
+}
+
+func TestExecutionService_when_isolatedEdgeToLowerParallelism_then_sourceOrderKept(t *testing.T) {
+	teardownTest, et := ExecutionTestSetup(t)
+	defer teardownTest(t)
+
+	var received [][]interface{}
+	dag := NewDAG()
+	source := dag.newVertex("source", numberedSourceSupplier(100)).setLocalParallelism(4)
+	sink := dag.newVertex("sink", et.recordingSinkSupplier(&received)).setLocalParallelism(2)
+	dag.edge(Between(source, sink).isolated())
+
+	assert.NoError(t, et.service.execute(context.Background(), dag))
+	for sinkIndex, items := range received {
+		assert.Len(t, items, 200)
+		lastPerSource := make(map[int]int)
+		for _, item := range items {
+			sourceIndex := item.(int) / 1000
+			assert.Equal(t, sinkIndex, sourceIndex%2)
+			if last, ok := lastPerSource[sourceIndex]; ok {
+				assert.Less(t, last, item.(int))
+			}
+			lastPerSource[sourceIndex] = item.(int)
+		}
+	}
+}
+
+func TestExecutionService_when_fanoutEdge_then_eachItemDeliveredOncePerMember(t *testing.T) {
+	teardownTest, et := ExecutionTestSetup(t)
+	defer teardownTest(t)
+
+	dag := NewDAG()
+	source := dag.newVertex("source", func() interface{} {
+		return NewListSourceP(sequence(100))
+	}).setLocalParallelism(1)
+	sink := dag.newVertex("sink", et.sinkSupplier()).setLocalParallelism(3)
+	dag.edge(Between(source, sink).fanout())
+
+	assert.NoError(t, et.service.execute(context.Background(), dag))
+	assert.ElementsMatch(t, sequence(100), et.sunk)
+}
+
+func TestExecutionService_when_partitionedByStringKey_then_eachKeyOnOneProcessor(t *testing.T) {
+	teardownTest, et := ExecutionTestSetup(t)
+	defer teardownTest(t)
+
+	items := make([]interface{}, 1000)
+	for i := range items {
+		items[i] = fmt.Sprintf("key-%d", i%50)
+	}
+	var received [][]interface{}
+	dag := NewDAG()
+	source := dag.newVertex("source", func() interface{} {
+		return NewListSourceP(items)
+	}).setLocalParallelism(1)
+	sink := dag.newVertex("sink", et.recordingSinkSupplier(&received)).setLocalParallelism(3)
+	dag.edge(Between(source, sink).partitionedByKey(func(t interface{}) interface{} {
+		return t
+	}))
+
+	assert.NoError(t, et.service.execute(context.Background(), dag))
+	processorOfKey := make(map[interface{}]int)
+	for processorIndex, keys := range received {
+		assert.NotEmpty(t, keys)
+		for _, key := range keys {
+			if other, ok := processorOfKey[key]; ok {
+				assert.Equal(t, other, processorIndex)
+			}
+			processorOfKey[key] = processorIndex
+		}
+	}
+	assert.Len(t, processorOfKey, 50)
+}
+
+// countingPartitioner counts how often it is initialized
+type countingPartitioner struct {
+	*DefaultPartitioner
+	inits int
+}
+
+func (p *countingPartitioner) init(strat DefaultPartitionStrategy) {
+	p.inits++
+	p.DefaultPartitioner.init(strat)
+}
+
+func TestExecutionService_when_partitionedEdge_then_partitionerInitializedOncePerExecution(t *testing.T) {
+	teardownTest, et := ExecutionTestSetup(t)
+	defer teardownTest(t)
+
+	partitioner := &countingPartitioner{DefaultPartitioner: NewDefaultPartitioner()}
+	dag := NewDAG()
+	source := dag.newVertex("source", func() interface{} {
+		return NewListSourceP(sequence(100))
+	}).setLocalParallelism(4)
+	sink := dag.newVertex("sink", et.sinkSupplier()).setLocalParallelism(3)
+	dag.edge(Between(source, sink).partitioned(func(t interface{}) interface{} {
+		return t
+	}, partitioner))
+
+	assert.NoError(t, et.service.execute(context.Background(), dag))
+	// each source processor emits all the items
+	assert.Len(t, et.sunk, 400)
+	assert.Equal(t, 1, partitioner.inits)
+}
+
+func TestExecutionService_when_edgePriorities_then_higherPriorityDrainedFirst(t *testing.T) {
+	teardownTest, et := ExecutionTestSetup(t)
+	defer teardownTest(t)
+
+	probeItems := make([]interface{}, 100)
+	for i := range probeItems {
+		probeItems[i] = fmt.Sprintf("probe-%d", i)
+	}
+	dag := NewDAG()
+	probe := dag.newVertex("probe", func() interface{} {
+		return NewListSourceP(probeItems)
+	}).setLocalParallelism(1)
+	build := dag.newVertex("build", func() interface{} {
+		return NewListSourceP(sequence(3 * DEFAULT_QUEUE_SIZE))
+	}).setLocalParallelism(2)
+	join := dag.newVertex("join", et.sinkSupplier()).setLocalParallelism(1)
+	dag.edge(From(probe, 0).To(join, 0).setPriority(1)).
+		edge(From(build, 0).To(join, 1).setPriority(0))
+
+	assert.NoError(t, et.service.execute(context.Background(), dag))
+	assert.Len(t, et.sunk, 6*DEFAULT_QUEUE_SIZE+100)
+	for i, item := range et.sunk {
+		if i < 6*DEFAULT_QUEUE_SIZE {
+			assert.IsType(t, 0, item)
+		} else {
+			assert.IsType(t, "", item)
+		}
+	}
+}
+
+func TestProcessorTasklet_when_groupByPriority_then_groupsOrderedByPriority(t *testing.T) {
+	a := NewInboundEdgeStream(0, 2, nil, nil, 0)
+	b := NewInboundEdgeStream(1, 0, nil, nil, 0)
+	c := NewInboundEdgeStream(2, 2, nil, nil, 0)
+	assert.Equal(t, [][]*InboundEdgeStream{{b}, {a, c}}, groupByPriority([]*InboundEdgeStream{a, b, c}))
+}
+
+// blockingP a non-cooperative processor that blocks in process until released
+type blockingP struct {
+	*NoopP
+	release chan struct{}
+}
+
+func (p *blockingP) isCooperative() bool {
+	return false
+}
+
+func (p *blockingP) process(ordinal int, inbox Inbox) {
+	<-p.release
+	inbox.clear()
+}
+
+// slowP a cooperative processor whose first complete call takes longer than allowed
+type slowP struct {
+	*NoopP
+	delay time.Duration
+}
+
+func (p *slowP) complete() bool {
+	time.Sleep(p.delay)
+	return true
+}
+
+// syncBuffer a buffer that can be written by several goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestExecutionService_when_nonCooperativeProcessorBlocks_then_cooperativeJobsProceed(t *testing.T) {
+	service := NewExecutionService(NewInstanceConfig().setCooperativeThreadCount(1))
+	defer service.shutdown()
+
+	release := make(chan struct{})
+	blocked := NewDAG()
+	source := blocked.newVertex("source", func() interface{} {
+		return NewListSourceP(sequence(3))
+	}).setLocalParallelism(1)
+	sink := blocked.newVertex("sink", func() interface{} {
+		return &blockingP{NoopP: NewNoopP(), release: release}
+	}).setLocalParallelism(1)
+	blocked.edge(Between(source, sink))
+	blockedJob := service.newJob(context.Background(), blocked)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	dag := NewDAG()
+	dag.newVertex("v", func() interface{} {
+		return NewListSourceP(sequence(10))
+	})
+	assert.NoError(t, service.execute(ctx, dag))
+	assert.Equal(t, RUNNING, blockedJob.Status())
+
+	close(release)
+	assert.NoError(t, blockedJob.Join())
+}
+
+func TestExecutionService_when_cooperativeCallExceedsBudget_then_watchdogLogs(t *testing.T) {
+	var output syncBuffer
+	service := NewExecutionService(NewInstanceConfig().setCooperativeThreadCount(1).
+		setCooperativeCallBudget(10 * time.Millisecond).setLogOutput(&output))
+	defer service.shutdown()
+
+	dag := NewDAG()
+	dag.newVertex("slow", func() interface{} {
+		return &slowP{NoopP: NewNoopP(), delay: 100 * time.Millisecond}
+	}).setLocalParallelism(1)
+
+	assert.NoError(t, service.execute(context.Background(), dag))
+	assert.Contains(t, output.String(), "Cooperative tasklet slow#0 has been running for")
+}
+
+func TestExecutionService_when_shutdownWhileRunning_then_joinReturnsShutdownError(t *testing.T) {
+	service := NewExecutionService(NewInstanceConfig().setCooperativeThreadCount(1))
+
+	dag := NewDAG()
+	dag.newVertex("cooperative", func() interface{} {
+		return neverCompletingP{NoopP: NewNoopP()}
+	})
+	dag.newVertex("nonCooperative", func() interface{} {
+		return nonCooperativeNeverCompletingP{neverCompletingP{NoopP: NewNoopP()}}
+	})
+	job := service.newJob(context.Background(), dag)
+	time.Sleep(20 * time.Millisecond)
+	service.shutdown()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- job.Join()
+	}()
+	select {
+	case err := <-done:
+		assert.Equal(t, ErrServiceShutdown, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Join didn't return after shutdown")
+	}
+	assert.Equal(t, ErrServiceShutdown, service.execute(context.Background(), dag))
+}
@@ -0,0 +1,612 @@
+package stream_processing
+
+import "fmt"
+
+// the generic API is a statically typed layer over the interface{} based one: the typed tuples, traversers, aggregate
+// operations and stages convert their functions to the untyped ones and the items keep flowing through the same core.
+// the names carry the Typed prefix because Go doesn't allow a generic and a non-generic type of the same name
+
+// untypedItem implemented by the typed items that are serialized as their untyped counterpart
+type untypedItem interface {
+	asUntyped() interface{}
+}
+
+// untypedItemSetter implemented by the pointers to the typed items that can be restored from their untyped counterpart
+type untypedItemSetter interface {
+	setFromUntyped(item interface{})
+}
+
+// typedItemOf return the item as T. the typed tuples that crossed a distributed edge arrive as untyped tuples, they
+// are converted back. a nil item is the zero value of T
+func typedItemOf[T any](item interface{}) T {
+	if t, ok := item.(T); ok {
+		return t
+	}
+	var t T
+	if item == nil {
+		return t
+	}
+	if setter, ok := any(&t).(untypedItemSetter); ok {
+		setter.setFromUntyped(item)
+		return t
+	}
+	return item.(T)
+}
+
+// TypedTuple2 a 2-tuple with statically typed fields
+type TypedTuple2[A, B any] struct {
+	f0 A
+	f1 B
+}
+
+// NewTypedTuple2 return a new tuple with supplied values
+func NewTypedTuple2[A, B any](f0 A, f1 B) TypedTuple2[A, B] {
+	return TypedTuple2[A, B]{f0: f0, f1: f1}
+}
+
+func (t TypedTuple2[A, B]) asUntyped() interface{} {
+	return NewTuple2(t.f0, t.f1)
+}
+
+func (t *TypedTuple2[A, B]) setFromUntyped(item interface{}) {
+	u := item.(Tuple2)
+	t.f0 = typedItemOf[A](u.f0)
+	t.f1 = typedItemOf[B](u.f1)
+}
+
+// TypedTuple3 a 3-tuple with statically typed fields
+type TypedTuple3[A, B, C any] struct {
+	f0 A
+	f1 B
+	f2 C
+}
+
+// NewTypedTuple3 return a new triple with supplied values
+func NewTypedTuple3[A, B, C any](f0 A, f1 B, f2 C) TypedTuple3[A, B, C] {
+	return TypedTuple3[A, B, C]{f0: f0, f1: f1, f2: f2}
+}
+
+func (t TypedTuple3[A, B, C]) asUntyped() interface{} {
+	return NewTuple3(t.f0, t.f1, t.f2)
+}
+
+func (t *TypedTuple3[A, B, C]) setFromUntyped(item interface{}) {
+	u := item.(Tuple3)
+	t.f0 = typedItemOf[A](u.f0)
+	t.f1 = typedItemOf[B](u.f1)
+	t.f2 = typedItemOf[C](u.f2)
+}
+
+// TypedMapEntry a key-value pair with statically typed fields, a typed group-and-aggregate emits one for each key
+type TypedMapEntry[K, V any] struct {
+	key   K
+	value V
+}
+
+// NewTypedMapEntry return a new entry with supplied key and value
+func NewTypedMapEntry[K, V any](key K, value V) TypedMapEntry[K, V] {
+	return TypedMapEntry[K, V]{key: key, value: value}
+}
+
+func (e TypedMapEntry[K, V]) asUntyped() interface{} {
+	return MapEntry{key: e.key, value: e.value}
+}
+
+func (e *TypedMapEntry[K, V]) setFromUntyped(item interface{}) {
+	u := item.(MapEntry)
+	e.key = typedItemOf[K](u.key)
+	e.value = typedItemOf[V](u.value)
+}
+
+// TypedKeyedWindowResult the result of a typed windowed aggregation for a key of type K
+type TypedKeyedWindowResult[K, R any] struct {
+	start   int64
+	end     int64
+	key     K
+	result  R
+	isEarly bool
+}
+
+func NewTypedKeyedWindowResult[K, R any](start, end int64, key K, result R, isEarly bool) TypedKeyedWindowResult[K, R] {
+	return TypedKeyedWindowResult[K, R]{start: start, end: end, key: key, result: result, isEarly: isEarly}
+}
+
+func (r TypedKeyedWindowResult[K, R]) asUntyped() interface{} {
+	return NewKeyedWindowResult(r.start, r.end, r.key, r.result, r.isEarly)
+}
+
+func (r *TypedKeyedWindowResult[K, R]) setFromUntyped(item interface{}) {
+	u := item.(KeyedWindowResult)
+	r.start, r.end, r.isEarly = u.start, u.end, u.isEarly
+	r.key = typedItemOf[K](u.key)
+	r.result = typedItemOf[R](u.result)
+}
+
+// TypedTraverser a potentially infinite sequence of items of type T
+type TypedTraverser[T any] interface {
+
+	// next return the next item and true, or false if there are no more items
+	next() (T, bool)
+}
+
+// TypedTraverserFn a TypedTraverser made of its next function
+type TypedTraverserFn[T any] func() (T, bool)
+
+func (fn TypedTraverserFn[T]) next() (T, bool) {
+	return fn()
+}
+
+// traverseTypedItems return a traverser over the supplied items
+func traverseTypedItems[T any](items ...T) TypedTraverser[T] {
+	i := 0
+	return TypedTraverserFn[T](func() (T, bool) {
+		if i == len(items) {
+			var zero T
+			return zero, false
+		}
+		i++
+		return items[i-1], true
+	})
+}
+
+// mapTypedTraverser return a traverser that emits the results of applying mapFn to the items of the traverser
+func mapTypedTraverser[T, R any](t TypedTraverser[T], mapFn func(T) R) TypedTraverser[R] {
+	return TypedTraverserFn[R](func() (R, bool) {
+		item, ok := t.next()
+		if !ok {
+			var zero R
+			return zero, false
+		}
+		return mapFn(item), true
+	})
+}
+
+// filterTypedTraverser return a traverser that emits only the items of the traverser that pass the predicate
+func filterTypedTraverser[T any](t TypedTraverser[T], filterFn func(T) bool) TypedTraverser[T] {
+	return TypedTraverserFn[T](func() (T, bool) {
+		for {
+			item, ok := t.next()
+			if !ok || filterFn(item) {
+				return item, ok
+			}
+		}
+	})
+}
+
+// flatMapTypedTraverser return a traverser that emits all the items of the traversers flatMapFn returns for the items of the traverser
+func flatMapTypedTraverser[T, R any](t TypedTraverser[T], flatMapFn func(T) TypedTraverser[R]) TypedTraverser[R] {
+	var current TypedTraverser[R]
+	return TypedTraverserFn[R](func() (R, bool) {
+		for {
+			if current != nil {
+				if item, ok := current.next(); ok {
+					return item, true
+				}
+			}
+			item, ok := t.next()
+			if !ok {
+				var zero R
+				return zero, false
+			}
+			current = flatMapFn(item)
+		}
+	})
+}
+
+// untypedTraverser adapts a TypedTraverser to a Traverser. nextFn signals the end with false, so a nil item doesn't end
+// the typed traverser. the core takes a nil item for the end of a Traverser, next skips the nil items instead
+type untypedTraverser struct {
+	nextFn func() (interface{}, bool)
+}
+
+// untypedTraverserOf return the Traverser the core uses to emit the items of the typed traverser
+func untypedTraverserOf[T any](t TypedTraverser[T]) Traverser {
+	return &untypedTraverser{nextFn: func() (interface{}, bool) {
+		return t.next()
+	}}
+}
+
+func (t *untypedTraverser) next() interface{} {
+	for {
+		item, ok := t.nextFn()
+		if !ok {
+			return nil
+		}
+		if item != nil {
+			return item
+		}
+	}
+}
+
+func (t *untypedTraverser) mapX(mapFn ApplyFn) Traverser {
+	return &untypedTraverser{nextFn: func() (interface{}, bool) {
+		for item := t.next(); item != nil; item = t.next() {
+			if mapped := mapFn(item); mapped != nil {
+				return mapped, true
+			}
+		}
+		return nil, false
+	}}
+}
+
+func (t *untypedTraverser) filter(filterFn TestFn) Traverser {
+	return &untypedTraverser{nextFn: func() (interface{}, bool) {
+		for item := t.next(); item != nil; item = t.next() {
+			if filterFn(item) {
+				return item, true
+			}
+		}
+		return nil, false
+	}}
+}
+
+func (t *untypedTraverser) append(item interface{}) Traverser {
+	appended := false
+	return &untypedTraverser{nextFn: func() (interface{}, bool) {
+		if next := t.next(); next != nil {
+			return next, true
+		}
+		if appended {
+			return nil, false
+		}
+		appended = true
+		return item, true
+	}}
+}
+
+func (t *untypedTraverser) traverseItems(items ...interface{}) Traverser {
+	var traverser Traverser = t
+	for _, item := range items {
+		traverser = traverser.append(item)
+	}
+	return traverser
+}
+
+func (t *untypedTraverser) flatMap(fn ApplyFn) Traverser {
+	var current Traverser
+	return &untypedTraverser{nextFn: func() (interface{}, bool) {
+		for {
+			if current != nil {
+				if item := current.next(); item != nil {
+					return item, true
+				}
+			}
+			item := t.next()
+			if item == nil {
+				return nil, false
+			}
+			current = fn(item).(Traverser)
+		}
+	}}
+}
+
+// TypedAggregateOperation1 an aggregate operation of one input with statically typed items T, accumulator A and result R.
+// combineFn, deductFn and exportFn are optional, exportFn defaults to finishFn
+type TypedAggregateOperation1[T, A, R any] struct {
+	createFn     func() A
+	accumulateFn func(acc A, item T)
+	combineFn    func(acc, other A)
+	deductFn     func(acc, other A)
+	exportFn     func(acc A) R
+	finishFn     func(acc A) R
+}
+
+// NewTypedAggregateOperation1 return an aggregate operation whose result is obtained with exportFinishFn both when
+// exporting and when finishing
+func NewTypedAggregateOperation1[T, A, R any](createFn func() A, accumulateFn func(acc A, item T), exportFinishFn func(acc A) R) *TypedAggregateOperation1[T, A, R] {
+	return &TypedAggregateOperation1[T, A, R]{createFn: createFn, accumulateFn: accumulateFn, exportFn: exportFinishFn, finishFn: exportFinishFn}
+}
+
+func (a *TypedAggregateOperation1[T, A, R]) andCombine(combineFn func(acc, other A)) *TypedAggregateOperation1[T, A, R] {
+	a.combineFn = combineFn
+	return a
+}
+
+func (a *TypedAggregateOperation1[T, A, R]) andDeduct(deductFn func(acc, other A)) *TypedAggregateOperation1[T, A, R] {
+	a.deductFn = deductFn
+	return a
+}
+
+func (a *TypedAggregateOperation1[T, A, R]) andExport(exportFn func(acc A) R) *TypedAggregateOperation1[T, A, R] {
+	a.exportFn = exportFn
+	return a
+}
+
+func (a *TypedAggregateOperation1[T, A, R]) andFinish(finishFn func(acc A) R) *TypedAggregateOperation1[T, A, R] {
+	a.finishFn = finishFn
+	return a
+}
+
+// untyped return the AggregateOperation1 the core runs, the optional primitives that are not set stay nil
+func (a *TypedAggregateOperation1[T, A, R]) untyped() AggregateOperation1 {
+	var combineFn, deductFn BiAcceptFn
+	if a.combineFn != nil {
+		combineFn = func(acc, other interface{}) {
+			a.combineFn(acc.(A), other.(A))
+		}
+	}
+	if a.deductFn != nil {
+		deductFn = func(acc, other interface{}) {
+			a.deductFn(acc.(A), other.(A))
+		}
+	}
+	return NewAggregateOperation1Impl(func() interface{} {
+		return a.createFn()
+	}, func(acc, item interface{}) {
+		a.accumulateFn(acc.(A), typedItemOf[T](item))
+	}, combineFn, deductFn, func(acc interface{}) interface{} {
+		return a.exportFn(acc.(A))
+	}, func(acc interface{}) interface{} {
+		return a.finishFn(acc.(A))
+	})
+}
+
+// andThenTyped return a copy of the aggregate operation whose export and finish results are transformed by thenFn
+func andThenTyped[T, A, R, R1 any](a *TypedAggregateOperation1[T, A, R], thenFn func(R) R1) *TypedAggregateOperation1[T, A, R1] {
+	return &TypedAggregateOperation1[T, A, R1]{
+		createFn:     a.createFn,
+		accumulateFn: a.accumulateFn,
+		combineFn:    a.combineFn,
+		deductFn:     a.deductFn,
+		exportFn: func(acc A) R1 {
+			return thenFn(a.exportFn(acc))
+		},
+		finishFn: func(acc A) R1 {
+			return thenFn(a.finishFn(acc))
+		},
+	}
+}
+
+// typedCounting return an aggregate operation that counts the items it observes
+func typedCounting[T any]() *TypedAggregateOperation1[T, *LongAccumulator, int64] {
+	return typedSummingLong(func(T) int64 {
+		return 1
+	})
+}
+
+// typedSummingLong return an aggregate operation that computes the sum of the values getLongValueFn returns for the items
+func typedSummingLong[T any](getLongValueFn func(item T) int64) *TypedAggregateOperation1[T, *LongAccumulator, int64] {
+	return NewTypedAggregateOperation1(NewLongAccumulator, func(acc *LongAccumulator, item T) {
+		acc.addAllowingOverflow(getLongValueFn(item))
+	}, (*LongAccumulator).get).
+		andCombine(func(acc, other *LongAccumulator) {
+			acc.addAllowingOverflowWithAnother(other)
+		}).
+		andDeduct(func(acc, other *LongAccumulator) {
+			acc.subtractAllowingOverflowWithAnother(other)
+		})
+}
+
+// TypedBatchStage a BatchStage whose items are of type T
+type TypedBatchStage[T any] struct {
+	stage BatchStage
+}
+
+// NewTypedBatchStage return the typed view of the stage, the items of the stage must be of type T
+func NewTypedBatchStage[T any](stage BatchStage) TypedBatchStage[T] {
+	return TypedBatchStage[T]{stage: stage}
+}
+
+// untyped return the underlying stage
+func (s TypedBatchStage[T]) untyped() BatchStage {
+	return s.stage
+}
+
+func (s TypedBatchStage[T]) setName(name string) TypedBatchStage[T] {
+	s.stage.setName(name)
+	return s
+}
+
+func (s TypedBatchStage[T]) setLocalParallelism(localParallelism int) TypedBatchStage[T] {
+	s.stage.setLocalParallelism(localParallelism)
+	return s
+}
+
+// filter attaches a filtering stage that passes only the items that pass the predicate
+func (s TypedBatchStage[T]) filter(filterFn func(T) bool) TypedBatchStage[T] {
+	return NewTypedBatchStage[T](s.stage.filter(untypedTestFn(filterFn)).(BatchStage))
+}
+
+// rebalance return a new stage that applies data rebalancing to the output of this stage
+func (s TypedBatchStage[T]) rebalance() TypedBatchStage[T] {
+	return NewTypedBatchStage[T](s.stage.rebalance().(BatchStage))
+}
+
+// peek attaches a peeking stage that logs the items of this stage that pass shouldLogFn
+func (s TypedBatchStage[T]) peek(shouldLogFn func(T) bool, toStringFn func(T) string) TypedBatchStage[T] {
+	return NewTypedBatchStage[T](s.stage.peek(untypedTestFn(shouldLogFn), untypedApplyFn(toStringFn)).(BatchStage))
+}
+
+// addTimestamps turns this stage into a stream stage whose items get the timestamps timestampFn returns
+func (s TypedBatchStage[T]) addTimestamps(timestampFn func(T) int64, allowedLag int64) TypedStreamStage[T] {
+	return NewTypedStreamStage[T](s.stage.addTimestamps(untypedApplyAsLongFn(timestampFn), allowedLag))
+}
+
+// writeTo attaches a sink stage that receives the items of this stage
+func (s TypedBatchStage[T]) writeTo(sink Sink) SinkStage {
+	return s.stage.writeTo(sink)
+}
+
+// mapBatch attaches a mapping stage that emits the result of mapFn for each item of the stage
+func mapBatch[T, R any](s TypedBatchStage[T], mapFn func(T) R) TypedBatchStage[R] {
+	return NewTypedBatchStage[R](s.stage.mapX(untypedApplyFn(mapFn)).(BatchStage))
+}
+
+// flatMapBatch attaches a flat-mapping stage that emits all the items of the traverser flatMapFn returns for each item
+func flatMapBatch[T, R any](s TypedBatchStage[T], flatMapFn func(T) TypedTraverser[R]) TypedBatchStage[R] {
+	return NewTypedBatchStage[R](s.stage.flatMap(untypedFlatMapFn(flatMapFn)).(BatchStage))
+}
+
+// TypedStreamStage a StreamStage whose items are of type T
+type TypedStreamStage[T any] struct {
+	stage StreamStage
+}
+
+// NewTypedStreamStage return the typed view of the stage, the items of the stage must be of type T
+func NewTypedStreamStage[T any](stage StreamStage) TypedStreamStage[T] {
+	return TypedStreamStage[T]{stage: stage}
+}
+
+// untyped return the underlying stage
+func (s TypedStreamStage[T]) untyped() StreamStage {
+	return s.stage
+}
+
+func (s TypedStreamStage[T]) setName(name string) TypedStreamStage[T] {
+	s.stage.setName(name)
+	return s
+}
+
+func (s TypedStreamStage[T]) setLocalParallelism(localParallelism int) TypedStreamStage[T] {
+	s.stage.setLocalParallelism(localParallelism)
+	return s
+}
+
+// filter attaches a filtering stage that passes only the items that pass the predicate
+func (s TypedStreamStage[T]) filter(filterFn func(T) bool) TypedStreamStage[T] {
+	return NewTypedStreamStage[T](s.stage.filter(untypedTestFn(filterFn)).(StreamStage))
+}
+
+// rebalance return a new stage that applies data rebalancing to the output of this stage
+func (s TypedStreamStage[T]) rebalance() TypedStreamStage[T] {
+	return NewTypedStreamStage[T](s.stage.rebalance().(StreamStage))
+}
+
+// peek attaches a peeking stage that logs the items of this stage that pass shouldLogFn
+func (s TypedStreamStage[T]) peek(shouldLogFn func(T) bool, toStringFn func(T) string) TypedStreamStage[T] {
+	return NewTypedStreamStage[T](s.stage.peek(untypedTestFn(shouldLogFn), untypedApplyFn(toStringFn)).(StreamStage))
+}
+
+// addTimestamps attaches a stage that assigns the timestamps timestampFn returns to the items
+func (s TypedStreamStage[T]) addTimestamps(timestampFn func(T) int64, allowedLag int64) TypedStreamStage[T] {
+	return NewTypedStreamStage[T](s.stage.addTimestamps(untypedApplyAsLongFn(timestampFn), allowedLag))
+}
+
+// merge attaches a stage that emits the items of this stage and of the other stage
+func (s TypedStreamStage[T]) merge(other TypedStreamStage[T]) TypedStreamStage[T] {
+	return NewTypedStreamStage[T](s.stage.merge(other.stage))
+}
+
+// window adds the window definition to this stage as the first step of a windowed aggregation
+func (s TypedStreamStage[T]) window(wDef WindowDefinition) TypedStageWithWindow[T] {
+	return TypedStageWithWindow[T]{stage: s.stage.window(wDef)}
+}
+
+// writeTo attaches a sink stage that receives the items of this stage
+func (s TypedStreamStage[T]) writeTo(sink Sink) SinkStage {
+	return s.stage.writeTo(sink)
+}
+
+// mapStream attaches a mapping stage that emits the result of mapFn for each item of the stage
+func mapStream[T, R any](s TypedStreamStage[T], mapFn func(T) R) TypedStreamStage[R] {
+	return NewTypedStreamStage[R](s.stage.mapX(untypedApplyFn(mapFn)).(StreamStage))
+}
+
+// flatMapStream attaches a flat-mapping stage that emits all the items of the traverser flatMapFn returns for each item
+func flatMapStream[T, R any](s TypedStreamStage[T], flatMapFn func(T) TypedTraverser[R]) TypedStreamStage[R] {
+	return NewTypedStreamStage[R](s.stage.flatMap(untypedFlatMapFn(flatMapFn)).(StreamStage))
+}
+
+// groupingKeyBatch return the stage that groups the items of the stage by the key keyFn extracts
+func groupingKeyBatch[T, K any](s TypedBatchStage[T], keyFn func(T) K) TypedBatchStageWithKey[T, K] {
+	return TypedBatchStageWithKey[T, K]{stage: s.stage.groupingKey(untypedApplyFn(keyFn))}
+}
+
+// groupingKeyStream return the stage that groups the items of the stage by the key keyFn extracts
+func groupingKeyStream[T, K any](s TypedStreamStage[T], keyFn func(T) K) TypedStreamStageWithKey[T, K] {
+	return TypedStreamStageWithKey[T, K]{stage: s.stage.groupingKey(untypedApplyFn(keyFn))}
+}
+
+// TypedBatchStageWithKey a BatchStageWithKey whose items are of type T and keys of type K
+type TypedBatchStageWithKey[T, K any] struct {
+	stage BatchStageWithKey
+}
+
+// untyped return the underlying stage
+func (s TypedBatchStageWithKey[T, K]) untyped() BatchStageWithKey {
+	return s.stage
+}
+
+// distinct attaches a stage that emits the first item of each key, the stage must be created by a pipeline
+func (s TypedBatchStageWithKey[T, K]) distinct() TypedBatchStage[T] {
+	stage, ok := s.stage.(interface{ attachDistinct() BatchStage })
+	if !ok {
+		panic(fmt.Sprintf("stage with key %T wasn't created by a pipeline", s.stage))
+	}
+	return NewTypedBatchStage[T](stage.attachDistinct())
+}
+
+// aggregateBatch attaches a stage that emits a TypedMapEntry of each key and the result of the aggregate operation on
+// the items with that key
+func aggregateBatch[T, K, A, R any](s TypedBatchStageWithKey[T, K], aggrOp *TypedAggregateOperation1[T, A, R]) TypedBatchStage[TypedMapEntry[K, R]] {
+	return NewTypedBatchStage[TypedMapEntry[K, R]](s.stage.aggregate(aggrOp.untyped()))
+}
+
+// TypedStreamStageWithKey a StreamStageWithKey whose items are of type T and keys of type K
+type TypedStreamStageWithKey[T, K any] struct {
+	stage StreamStageWithKey
+}
+
+// untyped return the underlying stage
+func (s TypedStreamStageWithKey[T, K]) untyped() StreamStageWithKey {
+	return s.stage
+}
+
+// window adds the window definition to the grouped stage as the first step of a windowed aggregation
+func (s TypedStreamStageWithKey[T, K]) window(wDef WindowDefinition) TypedStageWithKeyAndWindow[T, K] {
+	return TypedStageWithKeyAndWindow[T, K]{stage: s.stage.window(wDef)}
+}
+
+// TypedStageWithWindow a StageWithWindow whose items are of type T
+type TypedStageWithWindow[T any] struct {
+	stage StageWithWindow
+}
+
+// untyped return the underlying stage
+func (s TypedStageWithWindow[T]) untyped() StageWithWindow {
+	return s.stage
+}
+
+// groupingKeyWindow return the stage that groups the items of the windowed stage by the key keyFn extracts
+func groupingKeyWindow[T, K any](s TypedStageWithWindow[T], keyFn func(T) K) TypedStageWithKeyAndWindow[T, K] {
+	return TypedStageWithKeyAndWindow[T, K]{stage: s.stage.groupingKey(untypedApplyFn(keyFn))}
+}
+
+// TypedStageWithKeyAndWindow a StageWithKeyAndWindow whose items are of type T and keys of type K
+type TypedStageWithKeyAndWindow[T, K any] struct {
+	stage StageWithKeyAndWindow
+}
+
+// untyped return the underlying stage
+func (s TypedStageWithKeyAndWindow[T, K]) untyped() StageWithKeyAndWindow {
+	return s.stage
+}
+
+// aggregateWindow attaches a stage that emits a TypedKeyedWindowResult of each key and window
+func aggregateWindow[T, K, A, R any](s TypedStageWithKeyAndWindow[T, K], aggrOp *TypedAggregateOperation1[T, A, R]) TypedStreamStage[TypedKeyedWindowResult[K, R]] {
+	return NewTypedStreamStage[TypedKeyedWindowResult[K, R]](s.stage.aggregate(aggrOp.untyped()))
+}
+
+func untypedApplyFn[T, R any](fn func(T) R) ApplyFn {
+	return func(t interface{}) interface{} {
+		return fn(typedItemOf[T](t))
+	}
+}
+
+func untypedTestFn[T any](fn func(T) bool) TestFn {
+	return func(t interface{}) bool {
+		return fn(typedItemOf[T](t))
+	}
+}
+
+func untypedApplyAsLongFn[T any](fn func(T) int64) ApplyAsLongFn {
+	return func(t interface{}) int64 {
+		return fn(typedItemOf[T](t))
+	}
+}
+
+func untypedFlatMapFn[T, R any](fn func(T) TypedTraverser[R]) ApplyFn {
+	return func(t interface{}) interface{} {
+		return untypedTraverserOf(fn(typedItemOf[T](t)))
+	}
+}
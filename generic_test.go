@@ -0,0 +1,204 @@
+package stream_processing
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// eagerBatchStage a BatchStage that applies the operations to its items right away, the other operations are not supported
+type eagerBatchStage struct {
+	BatchStage
+	items []interface{}
+}
+
+func (s *eagerBatchStage) mapX(mapFn ApplyFn) GeneralStage {
+	result := &eagerBatchStage{}
+	for _, item := range s.items {
+		result.items = append(result.items, mapFn(item))
+	}
+	return result
+}
+
+func (s *eagerBatchStage) filter(filterFn TestFn) GeneralStage {
+	result := &eagerBatchStage{}
+	for _, item := range s.items {
+		if filterFn(item) {
+			result.items = append(result.items, item)
+		}
+	}
+	return result
+}
+
+func (s *eagerBatchStage) flatMap(flatMapFn ApplyFn) GeneralStage {
+	result := &eagerBatchStage{}
+	for _, item := range s.items {
+		traverser := flatMapFn(item).(Traverser)
+		for t := traverser.next(); t != nil; t = traverser.next() {
+			result.items = append(result.items, t)
+		}
+	}
+	return result
+}
+
+func TestTypedTuple2_when_serialized_then_restoredAsTyped(t *testing.T) {
+	registry := NewSerializerRegistry()
+	tuple := NewTypedTuple2("key", NewTypedTuple3(1, int64(2), 3.5))
+	data, err := registry.serialize(tuple)
+	assert.NoError(t, err)
+	untyped, err := registry.deserialize(data)
+	assert.NoError(t, err)
+	assert.Equal(t, NewTuple2("key", NewTuple3(1, int64(2), 3.5)), untyped)
+
+	assert.Equal(t, tuple, typedItemOf[TypedTuple2[string, TypedTuple3[int, int64, float64]]](untyped))
+	assert.Equal(t, "", typedItemOf[string](nil))
+}
+
+func TestTypedTraverser_when_composed_then_itemsTransformedLazily(t *testing.T) {
+	traverser := flatMapTypedTraverser(
+		filterTypedTraverser(traverseTypedItems(1, 2, 3, 4), func(i int) bool {
+			return i%2 == 0
+		}), func(i int) TypedTraverser[string] {
+			return mapTypedTraverser(traverseTypedItems(i, i*10), func(j int) string {
+				return strings.Repeat("x", j%7)
+			})
+		})
+
+	var items []string
+	for item, ok := traverser.next(); ok; item, ok = traverser.next() {
+		items = append(items, item)
+	}
+	assert.Equal(t, []string{"xx", "xxxxxx", "xxxx", "xxxxx"}, items)
+}
+
+func TestTypedTraverser_when_untyped_then_usableByCore(t *testing.T) {
+	traverser := untypedTraverserOf(traverseTypedItems(1, 2, 3)).
+		filter(func(t interface{}) bool {
+			return t.(int) != 2
+		}).
+		mapX(func(t interface{}) interface{} {
+			return t.(int) * 10
+		}).
+		append(40)
+
+	var items []interface{}
+	for item := traverser.next(); item != nil; item = traverser.next() {
+		items = append(items, item)
+	}
+	assert.Equal(t, []interface{}{10, 30, 40}, items)
+}
+
+func TestTypedTraverser_when_nilItems_then_traversalGoesOn(t *testing.T) {
+	a, c := "a", "c"
+	typed := filterTypedTraverser(traverseTypedItems(&a, nil, &c), func(s *string) bool {
+		return true
+	})
+	var items []*string
+	for item, ok := typed.next(); ok; item, ok = typed.next() {
+		items = append(items, item)
+	}
+	assert.Equal(t, []*string{&a, nil, &c}, items)
+
+	untyped := untypedTraverserOf(traverseTypedItems[interface{}]("a", nil, "c")).append("d")
+	var untypedItems []interface{}
+	for item := untyped.next(); item != nil; item = untyped.next() {
+		untypedItems = append(untypedItems, item)
+	}
+	assert.Equal(t, []interface{}{"a", "c", "d"}, untypedItems)
+}
+
+func TestTypedAggregateOperation1_when_untyped_then_sameResult(t *testing.T) {
+	op := andThenTyped(typedSummingLong(func(s string) int64 {
+		return int64(len(s))
+	}), func(sum int64) string {
+		return strings.Repeat("*", int(sum))
+	}).untyped()
+
+	acc1, acc2 := op.getCreateFn()(), op.getCreateFn()()
+	op.accumulateFn0()(acc1, "ab")
+	op.accumulateFn0()(acc2, "c")
+	op.getCombineFn()(acc1, acc2)
+	assert.Equal(t, "***", op.getFinishFn()(acc1))
+	op.getDeductFn()(acc1, acc2)
+	assert.Equal(t, "**", op.getExportFn()(acc1))
+
+	withoutCombine := NewTypedAggregateOperation1(NewLongAccumulator, func(acc *LongAccumulator, item int) {
+		acc.addAllowingOverflow(int64(item))
+	}, (*LongAccumulator).get).untyped()
+	assert.Nil(t, withoutCombine.getCombineFn())
+	assert.Nil(t, withoutCombine.getDeductFn())
+}
+
+func TestTypedBatchStage_when_functionsApplied_then_itemsTyped(t *testing.T) {
+	source := NewTypedBatchStage[string](&eagerBatchStage{items: []interface{}{"a b", "", "c"}})
+
+	words := flatMapBatch(source.filter(func(s string) bool {
+		return s != ""
+	}), func(s string) TypedTraverser[string] {
+		return traverseTypedItems(strings.Fields(s)...)
+	})
+	pairs := mapBatch(words, func(word string) TypedTuple2[string, int] {
+		return NewTypedTuple2(word, len(word))
+	})
+
+	assert.Equal(t, []interface{}{NewTypedTuple2("a", 1), NewTypedTuple2("b", 1), NewTypedTuple2("c", 1)},
+		pairs.untyped().(*eagerBatchStage).items)
+}
+
+func TestTypedStages_when_groupedAndAggregated_then_typedResultsThroughPlanner(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	lines := NewTypedBatchStage[string](pt.p.readFromBatchSource(NewSources().items("a b", "b c b")))
+	words := flatMapBatch(lines, func(line string) TypedTraverser[string] {
+		return traverseTypedItems(strings.Fields(line)...)
+	})
+	counts := aggregateBatch(groupingKeyBatch(words, func(word string) string {
+		return word
+	}), typedCounting[string]())
+	mapBatch(counts, func(e TypedMapEntry[string, int64]) string {
+		return e.key + strings.Repeat("*", int(e.value))
+	}).writeTo(pt.collectingSink())
+
+	var mu sync.Mutex
+	var windows []interface{}
+	events := NewTypedStreamStage[int64](pt.p.readFromStreamSource(NewSources().streamFromProcessor("events", NewMetaSupplierFromProcessorSupplier(1, NewProcessorSupplierFromGetFn(func() interface{} {
+		return NewListSourceP([]interface{}{int64(0), int64(1), int64(2), int64(5)})
+	})))).withTimestamps(func(t interface{}) int64 {
+		return t.(int64)
+	}, 0))
+	sums := aggregateWindow(groupingKeyWindow(events.window(NewTumblingWindowDefinition(4)), func(ts int64) bool {
+		return ts%2 == 0
+	}), typedSummingLong(func(ts int64) int64 {
+		return ts
+	}))
+	mapStream(sums, func(r TypedKeyedWindowResult[bool, int64]) TypedTuple2[int64, int64] {
+		if !r.key {
+			return NewTypedTuple2(r.end, -r.result)
+		}
+		return NewTypedTuple2(r.end, r.result)
+	}).writeTo(NewSinks().writeFn("windows", func(t interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		windows = append(windows, t)
+	}))
+	var windowCounts []interface{}
+	counted := aggregateWindow(groupingKeyStream(events, func(ts int64) string {
+		return "all"
+	}).window(NewTumblingWindowDefinition(4)), typedCounting[int64]())
+	mapStream(counted, func(r TypedKeyedWindowResult[string, int64]) string {
+		return r.key + strings.Repeat("*", int(r.result))
+	}).writeTo(NewSinks().writeFn("counts", func(t interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		windowCounts = append(windowCounts, t)
+	}))
+
+	assert.NoError(t, pt.service.executePipeline(context.Background(), pt.p))
+	assert.ElementsMatch(t, []interface{}{"a*", "b***", "c*"}, pt.sunk)
+	assert.ElementsMatch(t, []interface{}{NewTypedTuple2(int64(4), int64(2)), NewTypedTuple2(int64(4), int64(-1)), NewTypedTuple2(int64(8), int64(-5))}, windows)
+	assert.ElementsMatch(t, []interface{}{"all***", "all*"}, windowCounts)
+}
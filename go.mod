@@ -1,6 +1,6 @@
 module github.com/fzft/stream-processing
 
-go 1.17
+go 1.18
 
 require (
 	github.com/ef-ds/deque v1.0.4
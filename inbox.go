@@ -1,6 +1,10 @@
 package stream_processing
 
-import "container/list"
+import (
+	"container/list"
+
+	"github.com/ef-ds/deque"
+)
 
 // Inbox a subset of queue restricted to the consumer side
 type Inbox interface {
@@ -34,6 +38,9 @@ func (t *TestInbox) isEmpty() bool {
 }
 
 func (t *TestInbox) peek() interface{} {
+	if t.isEmpty() {
+		return nil
+	}
 	return t.queue.Front().Value
 }
 
@@ -65,3 +72,58 @@ func (t *TestInbox) Iter() []interface{} {
 func (t *TestInbox) clear() {
 	t.queue = list.New()
 }
+
+// ConcurrentInbox the Inbox of a ProcessorTasklet. it drains the conveyors of an inbound edge stream into a local deque,
+// so the processor polls and peeks the items without touching the concurrent queues
+type ConcurrentInbox struct {
+	queue *deque.Deque
+}
+
+func NewConcurrentInbox() *ConcurrentInbox {
+	return &ConcurrentInbox{queue: deque.New()}
+}
+
+// drainFrom moves the available items of the stream into this inbox, return the stream's progress and the new coalesced watermark
+func (i *ConcurrentInbox) drainFrom(instream *InboundEdgeStream) (*ProgressState, int64) {
+	return instream.drainTo(i.add)
+}
+
+func (i *ConcurrentInbox) add(item interface{}) {
+	i.queue.PushBack(item)
+}
+
+func (i *ConcurrentInbox) size() int {
+	return i.queue.Len()
+}
+
+func (i *ConcurrentInbox) isEmpty() bool {
+	return i.queue.Len() == 0
+}
+
+func (i *ConcurrentInbox) peek() interface{} {
+	item, _ := i.queue.Front()
+	return item
+}
+
+func (i *ConcurrentInbox) poll() interface{} {
+	item, _ := i.queue.PopFront()
+	return item
+}
+
+func (i *ConcurrentInbox) remove() {
+	i.queue.PopFront()
+}
+
+func (i *ConcurrentInbox) Iter() []interface{} {
+	var iterList []interface{}
+	for n := i.queue.Len(); n > 0; n-- {
+		item, _ := i.queue.PopFront()
+		iterList = append(iterList, item)
+		i.queue.PushBack(item)
+	}
+	return iterList
+}
+
+func (i *ConcurrentInbox) clear() {
+	i.queue.Init()
+}
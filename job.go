@@ -1 +1,407 @@
 package stream_processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrJobCancelled returned by Job.Join when the job was cancelled
+var ErrJobCancelled = errors.New("job was cancelled")
+
+// JobStatus the status of a Job
+type JobStatus int
+
+const (
+	// NOT_RUNNING the job is submitted but not started yet
+	NOT_RUNNING JobStatus = iota
+
+	// STARTING the job's execution is being initialized
+	STARTING
+
+	// RUNNING the job is running
+	RUNNING
+
+	// COMPLETING the job's processors are done or were asked to stop, the job is about to finish
+	COMPLETING
+
+	// FAILED the job failed
+	FAILED
+
+	// COMPLETED the job completed successfully
+	COMPLETED
+
+	// CANCELLED the job was cancelled
+	CANCELLED
+)
+
+func (s JobStatus) String() string {
+	switch s {
+	case NOT_RUNNING:
+		return "NOT_RUNNING"
+	case STARTING:
+		return "STARTING"
+	case RUNNING:
+		return "RUNNING"
+	case COMPLETING:
+		return "COMPLETING"
+	case FAILED:
+		return "FAILED"
+	case COMPLETED:
+		return "COMPLETED"
+	case CANCELLED:
+		return "CANCELLED"
+	}
+	return fmt.Sprintf("JobStatus(%d)", int(s))
+}
+
+// isTerminal tells whether the job can't change its status anymore
+func (s JobStatus) isTerminal() bool {
+	return s == FAILED || s == COMPLETED || s == CANCELLED
+}
+
+// Job a handle to the execution of a DAG submitted to the ExecutionService of every member
+type Job struct {
+	id      int64
+	dag     *DAG
+	config  *JobConfig
+	members []*ExecutionService
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	mu               sync.Mutex
+	status           JobStatus
+	cancelRequested  bool
+	restartRequested bool
+	failure          error
+	done             chan struct{}
+
+	// cancelExecution stops the current execution, the job goes on if it is restarted
+	cancelExecution context.CancelFunc
+
+	// lastSnapshot the latest snapshot all members completed, nil if there is none
+	lastSnapshot *Snapshot
+
+	// failedAttempts the number of executions that failed in a row, it is reset when a snapshot completes
+	failedAttempts int
+
+	// snapshotName the name the snapshots of the job are stored under
+	snapshotName string
+}
+
+// NewJob the snapshots of a job without a name are stored under a name no other job has, the ids of the jobs start
+// from 1 in every process
+func NewJob(ctx context.Context, id int64, dag *DAG, config *JobConfig, members []*ExecutionService) *Job {
+	j := &Job{id: id, dag: dag, config: config, members: members, status: NOT_RUNNING, done: make(chan struct{})}
+	j.ctx, j.cancel = context.WithCancel(ctx)
+	j.snapshotName = config.getName()
+	if j.snapshotName == "" {
+		j.snapshotName = fmt.Sprintf("unnamed-%d-%d", id, time.Now().UnixNano())
+	}
+	return j
+}
+
+// getConfig return the configuration of this job
+func (j *Job) getConfig() *JobConfig {
+	return j.config
+}
+
+// getId return the ID of this job
+func (j *Job) getId() int64 {
+	return j.id
+}
+
+// Status return the current status of the job
+func (j *Job) Status() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+// Join blocks until the job is done, return nil if it completed successfully, otherwise the cause of the failure.
+// a cancelled job returns ErrJobCancelled, also when the context it was submitted with was cancelled or timed out
+func (j *Job) Join() error {
+	<-j.done
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.failure
+}
+
+// Cancel asks the job to stop, the context the processors were initialized with is cancelled. it doesn't wait for the job to stop
+func (j *Job) Cancel() {
+	j.mu.Lock()
+	if j.status.isTerminal() {
+		j.mu.Unlock()
+		return
+	}
+	j.cancelRequested = true
+	if j.status == RUNNING {
+		j.status = COMPLETING
+	}
+	j.mu.Unlock()
+	j.cancel()
+}
+
+// getLastSnapshot return the latest snapshot the job completed, nil if there is none
+func (j *Job) getLastSnapshot() *Snapshot {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.lastSnapshot
+}
+
+// Restart stops the current execution of the job and starts a new one, the processors restore their state from the
+// latest complete snapshot. it doesn't wait for the new execution to start
+func (j *Job) Restart() {
+	j.mu.Lock()
+	if j.status != RUNNING {
+		j.mu.Unlock()
+		return
+	}
+	j.restartRequested = true
+	cancelExecution := j.cancelExecution
+	j.mu.Unlock()
+	cancelExecution()
+}
+
+// snapshotStore the store of the snapshots of the job, the first member coordinates the snapshots
+func (j *Job) snapshotStore() SnapshotStore {
+	return j.members[0].config.snapshotStore
+}
+
+// start runs the job in the background. the first execution is initialized before it returns, a job the processing
+// guarantee can't be given for fails right away
+func (j *Job) start() {
+	if err := j.checkProcessingGuarantee(); err != nil {
+		j.setStatus(COMPLETING)
+		j.finish(err)
+		return
+	}
+	j.setStatus(STARTING)
+	outcome := j.startExecution()
+	j.setRunning()
+	go j.run(outcome)
+}
+
+// checkProcessingGuarantee the EXACTLY_ONCE guarantee needs the snapshot barriers aligned on all inbound edges of a
+// vertex. the edges of lower priority aren't drained before those of higher priority are done, so their barriers can't
+// be aligned with the others
+func (j *Job) checkProcessingGuarantee() error {
+	if j.config.processingGuarantee != EXACTLY_ONCE {
+		return nil
+	}
+	for _, v := range j.dag.iterator() {
+		inboundEdges := j.dag.getInboundEdges(v.name)
+		for _, e := range inboundEdges {
+			if e.(*Edge).priority != inboundEdges[0].(*Edge).priority {
+				return fmt.Errorf("vertex %s has inbound edges of different priorities, the %v guarantee isn't supported", v.name, EXACTLY_ONCE)
+			}
+		}
+	}
+	return nil
+}
+
+// run waits for the executions of the job and finishes it. a new execution is started when a restart stopped the last
+// one or, if the restart policy allows it, when the last one failed
+func (j *Job) run(outcome <-chan error) {
+	for {
+		err := <-outcome
+		restart, backoff := j.shouldRestart(err)
+		if restart && backoff > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-j.ctx.Done():
+				timer.Stop()
+				restart = false
+			}
+		}
+		if !restart {
+			j.setStatus(COMPLETING)
+			j.finish(err)
+			return
+		}
+		outcome = j.startExecution()
+		j.setRunning()
+	}
+}
+
+// shouldRestart decides whether a new execution is started after the last one ended with err and how long to wait
+// before it. a cancelled job, also one whose context is done, and a job whose service was shut down are never restarted
+func (j *Job) shouldRestart(err error) (bool, time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	restartRequested := j.restartRequested
+	j.restartRequested = false
+	if err == nil || err == ErrServiceShutdown || j.cancelRequested || j.ctx.Err() != nil {
+		return false, 0
+	}
+	if restartRequested {
+		j.status = STARTING
+		return true, 0
+	}
+	policy := j.config.restartPolicy
+	if policy == nil || !policy.shouldRestart(j.failedAttempts) {
+		return false, 0
+	}
+	j.failedAttempts++
+	j.status = STARTING
+	backoff := policy.backoff(j.failedAttempts)
+	j.members[0].logger.Printf("Job %d failed, restarting it in %v, attempt %d of %d: %v", j.id, backoff, j.failedAttempts, policy.maxAttempts, err)
+	return true, backoff
+}
+
+// startExecution initializes an execution on all members and runs it in the background, the processors are restored
+// from the latest complete snapshot of the job if there is one. unless the processing guarantee is NONE, the snapshots
+// are taken while it runs. the returned channel receives the outcome of the execution, it fails as soon as it fails on one
+// member, or right away if it can't be initialized
+func (j *Job) startExecution() <-chan error {
+	ctx, cancel := context.WithCancel(j.ctx)
+	j.mu.Lock()
+	j.cancelExecution = cancel
+	j.mu.Unlock()
+	outcome := make(chan error, 1)
+	var snapshot *Snapshot
+	if j.config.processingGuarantee != NONE {
+		var err error
+		if snapshot, err = loadSnapshot(j.snapshotStore(), j.snapshotName, j.dag); err != nil {
+			cancel()
+			outcome <- fmt.Errorf("failed to load the snapshot of job %d: %v", j.id, err)
+			return outcome
+		}
+	}
+
+	addresses := make([]Address, len(j.members))
+	for i, member := range j.members {
+		addresses[i] = member.address
+	}
+	suppliers := j.createSuppliers(ctx, addresses)
+	plans := make([]*ExecutionPlan, len(j.members))
+	for i, member := range j.members {
+		plans[i] = NewExecutionPlan(member, j.id, j.config, j.dag, addresses, suppliers[i])
+		if err := plans[i].initialize(ctx, snapshot); err != nil {
+			// the execution fails before it started on any member
+			cancel()
+			for _, plan := range plans[:i+1] {
+				plan.close(err)
+			}
+			for _, member := range j.members {
+				member.unregisterJob(j.id)
+			}
+			outcome <- err
+			return outcome
+		}
+	}
+	results := make(chan error, len(j.members))
+	for i, member := range j.members {
+		plan := plans[i]
+		execution := member.beginExecute(ctx, cancel, plan.tasklets)
+		go func() {
+			err := execution.await()
+			plan.close(err)
+			results <- err
+		}()
+	}
+
+	if j.config.processingGuarantee != NONE {
+		contexts := make([]*SnapshotContext, len(plans))
+		for i, plan := range plans {
+			contexts[i] = plan.snapshotContext
+		}
+		lastSnapshotId := NO_SNAPSHOT
+		if snapshot != nil {
+			lastSnapshotId = snapshot.id
+		}
+		interval := time.Duration(j.config.snapshotIntervalMillis) * time.Millisecond
+		coordinator := newSnapshotCoordinator(contexts, interval, lastSnapshotId, j.snapshotCompleted)
+		go coordinator.run(ctx)
+	}
+
+	go func() {
+		var err error
+		for range j.members {
+			// the other members fail with the cancellation caused by the first failure, it is not reported
+			if result := <-results; result != nil && (err == nil || err == context.Canceled) {
+				err = result
+				cancel()
+			}
+		}
+		cancel()
+		for _, member := range j.members {
+			member.unregisterJob(j.id)
+		}
+		outcome <- err
+	}()
+	return outcome
+}
+
+// setRunning sets the status after an execution started, unless the job was cancelled meanwhile
+func (j *Job) setRunning() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cancelRequested {
+		j.status = COMPLETING
+	} else {
+		j.status = RUNNING
+	}
+}
+
+// createSuppliers creates for every member the ProcessorSupplier of each vertex using the vertex's ProcessorMetaSupplier
+func (j *Job) createSuppliers(ctx context.Context, addresses []Address) []map[*Vertex]ProcessorSupplier {
+	addressList := make([]interface{}, len(addresses))
+	for i, address := range addresses {
+		addressList[i] = address
+	}
+	suppliers := make([]map[*Vertex]ProcessorSupplier, len(addresses))
+	for i := range suppliers {
+		suppliers[i] = make(map[*Vertex]ProcessorSupplier)
+	}
+	for _, v := range j.dag.iterator() {
+		v.metaSupplier.init(ctx)
+		supplierFn := v.metaSupplier.get(addressList)
+		for i, address := range addresses {
+			suppliers[i][v] = supplierFn(address).(ProcessorSupplier)
+		}
+	}
+	return suppliers
+}
+
+// snapshotCompleted called when all processors of the job saved their state for the snapshot, it writes the snapshot
+// to the store. the snapshot is committed only if it was stored
+func (j *Job) snapshotCompleted(snapshot *Snapshot) bool {
+	if err := storeSnapshot(j.snapshotStore(), j.snapshotName, snapshot); err != nil {
+		j.members[0].logger.Printf("Failed to store snapshot %d of job %d: %v", snapshot.id, j.id, err)
+		return false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.lastSnapshot = snapshot
+	j.failedAttempts = 0
+	return true
+}
+
+func (j *Job) setStatus(status JobStatus) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status = status
+}
+
+// finish sets the final status of the job according to the outcome of its execution. the job was cancelled if Cancel
+// was called or the context it was submitted with is done
+func (j *Job) finish(err error) {
+	j.mu.Lock()
+	switch {
+	case j.cancelRequested || j.ctx.Err() != nil:
+		j.status = CANCELLED
+		j.failure = ErrJobCancelled
+	case err != nil:
+		j.status = FAILED
+		j.failure = err
+	default:
+		j.status = COMPLETED
+	}
+	j.mu.Unlock()
+	j.cancel()
+	close(j.done)
+}
@@ -0,0 +1,289 @@
+package stream_processing
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type JobTest struct {
+	service *ExecutionService
+}
+
+func JobTestSetup(tb testing.TB) (func(tb testing.TB), JobTest) {
+	jt := JobTest{}
+	jt.service = NewExecutionService(NewInstanceConfig().setCooperativeThreadCount(2))
+
+	return func(tb testing.TB) {
+		jt.service.shutdown()
+		tb.Log("JobTestSetup teardown")
+	}, jt
+}
+
+// contextAwareP a processor that completes only after the context it was initialized with is cancelled
+type contextAwareP struct {
+	*NoopP
+	ctx context.Context
+}
+
+func (p *contextAwareP) init(ctx context.Context, outbox Outbox) {
+	p.ctx = ctx
+}
+
+func (p *contextAwareP) complete() bool {
+	return p.ctx.Err() != nil
+}
+
+// panickingP a processor that panics in complete during the first failingExecutions executions, executions counts
+// the processors created
+type panickingP struct {
+	*NoopP
+	cooperative bool
+	panics      bool
+}
+
+func newPanickingP(executions *int32, failingExecutions int32, cooperative bool) *panickingP {
+	return &panickingP{NoopP: NewNoopP(), cooperative: cooperative, panics: atomic.AddInt32(executions, 1) <= failingExecutions}
+}
+
+func (p *panickingP) isCooperative() bool {
+	return p.cooperative
+}
+
+func (p *panickingP) complete() bool {
+	if p.panics {
+		panic("processor failure")
+	}
+	return true
+}
+
+func TestJob_when_completes_then_statusCompleted(t *testing.T) {
+	teardownTest, jt := JobTestSetup(t)
+	defer teardownTest(t)
+
+	dag := NewDAG()
+	dag.newVertex("v", func() interface{} {
+		return NewNoopP()
+	})
+
+	job := jt.service.newJob(context.Background(), dag)
+	assert.NoError(t, job.Join())
+	assert.Equal(t, COMPLETED, job.Status())
+}
+
+func TestJob_when_cancelled_then_statusCancelledAndContextCancelled(t *testing.T) {
+	teardownTest, jt := JobTestSetup(t)
+	defer teardownTest(t)
+
+	var processors []*contextAwareP
+	dag := NewDAG()
+	dag.newVertex("v", func() interface{} {
+		p := &contextAwareP{NoopP: NewNoopP()}
+		processors = append(processors, p)
+		return p
+	})
+
+	job := jt.service.newJob(context.Background(), dag)
+	assert.Equal(t, RUNNING, job.Status())
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, RUNNING, job.Status())
+
+	job.Cancel()
+	assert.Equal(t, ErrJobCancelled, job.Join())
+	assert.Equal(t, CANCELLED, job.Status())
+	for _, p := range processors {
+		assert.Error(t, p.ctx.Err())
+	}
+}
+
+func TestJob_when_parentContextTimesOut_then_statusCancelledAndNotRestarted(t *testing.T) {
+	teardownTest, jt := JobTestSetup(t)
+	defer teardownTest(t)
+
+	var executions int32
+	dag := NewDAG()
+	dag.newVertex("v", func() interface{} {
+		atomic.AddInt32(&executions, 1)
+		return neverCompletingP{NoopP: NewNoopP()}
+	}).setLocalParallelism(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	config := NewJobConfig().setRestartPolicy(NewRestartPolicy(3, time.Millisecond, time.Millisecond))
+	job := jt.service.newJobWithConfig(ctx, dag, config)
+	assert.Equal(t, ErrJobCancelled, job.Join())
+	assert.Equal(t, CANCELLED, job.Status())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&executions))
+}
+
+func TestJob_when_cancelAfterCompletion_then_staysCompleted(t *testing.T) {
+	teardownTest, jt := JobTestSetup(t)
+	defer teardownTest(t)
+
+	dag := NewDAG()
+	dag.newVertex("v", func() interface{} {
+		return NewNoopP()
+	})
+
+	job := jt.service.newJob(context.Background(), dag)
+	assert.NoError(t, job.Join())
+	job.Cancel()
+	assert.Equal(t, COMPLETED, job.Status())
+}
+
+func TestJob_when_processorPanics_then_jobFailedAndServiceUsable(t *testing.T) {
+	teardownTest, jt := JobTestSetup(t)
+	defer teardownTest(t)
+
+	for _, cooperative := range []bool{true, false} {
+		var executions int32
+		dag := NewDAG()
+		dag.newVertex("failing", func() interface{} {
+			return newPanickingP(&executions, 1, cooperative)
+		}).setLocalParallelism(1)
+		dag.newVertex("stream", func() interface{} {
+			return neverCompletingP{NoopP: NewNoopP()}
+		})
+
+		err := jt.service.newJob(context.Background(), dag).Join()
+		var panicErr *TaskletPanicError
+		assert.True(t, errors.As(err, &panicErr))
+		assert.Contains(t, err.Error(), "failing")
+		assert.Contains(t, panicErr.getStack(), "panickingP")
+		assert.Equal(t, int32(1), executions)
+	}
+
+	dag := NewDAG()
+	dag.newVertex("v", func() interface{} {
+		return NewNoopP()
+	})
+	assert.NoError(t, jt.service.newJob(context.Background(), dag).Join())
+}
+
+func TestJob_when_failsWithRestartPolicy_then_restartedUntilCompletes(t *testing.T) {
+	teardownTest, jt := JobTestSetup(t)
+	defer teardownTest(t)
+
+	var executions int32
+	dag := NewDAG()
+	dag.newVertex("v", func() interface{} {
+		return newPanickingP(&executions, 2, true)
+	}).setLocalParallelism(1)
+
+	config := NewJobConfig().setRestartPolicy(NewRestartPolicy(3, time.Millisecond, 5*time.Millisecond))
+	job := jt.service.newJobWithConfig(context.Background(), dag, config)
+	assert.NoError(t, job.Join())
+	assert.Equal(t, COMPLETED, job.Status())
+	assert.Equal(t, int32(3), executions)
+}
+
+func TestJob_when_restartAttemptsExhausted_then_statusFailed(t *testing.T) {
+	teardownTest, jt := JobTestSetup(t)
+	defer teardownTest(t)
+
+	var executions int32
+	dag := NewDAG()
+	dag.newVertex("v", func() interface{} {
+		return newPanickingP(&executions, 10, true)
+	}).setLocalParallelism(1)
+
+	config := NewJobConfig().setRestartPolicy(NewRestartPolicy(2, time.Millisecond, time.Millisecond))
+	job := jt.service.newJobWithConfig(context.Background(), dag, config)
+	assert.IsType(t, &TaskletPanicError{}, job.Join())
+	assert.Equal(t, FAILED, job.Status())
+	assert.Equal(t, int32(3), executions)
+}
+
+func TestJob_when_cancelledDuringBackoff_then_notRestarted(t *testing.T) {
+	teardownTest, jt := JobTestSetup(t)
+	defer teardownTest(t)
+
+	var executions int32
+	dag := NewDAG()
+	dag.newVertex("v", func() interface{} {
+		return newPanickingP(&executions, 1, true)
+	}).setLocalParallelism(1)
+
+	config := NewJobConfig().setRestartPolicy(NewRestartPolicy(1, time.Hour, time.Hour))
+	job := jt.service.newJobWithConfig(context.Background(), dag, config)
+	assert.Eventually(t, func() bool {
+		return job.Status() == STARTING
+	}, time.Second, time.Millisecond)
+	job.Cancel()
+	assert.Equal(t, ErrJobCancelled, job.Join())
+	assert.Equal(t, CANCELLED, job.Status())
+}
+
+func TestRestartPolicy_backoff(t *testing.T) {
+	policy := NewRestartPolicy(5, 10*time.Millisecond, 50*time.Millisecond)
+	assert.Equal(t, 10*time.Millisecond, policy.backoff(1))
+	assert.Equal(t, 20*time.Millisecond, policy.backoff(2))
+	assert.Equal(t, 40*time.Millisecond, policy.backoff(3))
+	assert.Equal(t, 50*time.Millisecond, policy.backoff(4))
+	assert.True(t, policy.shouldRestart(4))
+	assert.False(t, policy.shouldRestart(5))
+}
+
+func TestJobStatus_String(t *testing.T) {
+	assert.Equal(t, "NOT_RUNNING", NOT_RUNNING.String())
+	assert.Equal(t, "CANCELLED", CANCELLED.String())
+	assert.True(t, FAILED.isTerminal())
+	assert.False(t, COMPLETING.isTerminal())
+}
+
+// shortSupplier a ProcessorSupplier that returns one processor less than asked for
+type shortSupplier struct {
+	*ProcessorSupplierFromGetFn
+}
+
+func (s shortSupplier) Get(count int) []Processor {
+	return s.ProcessorSupplierFromGetFn.Get(count - 1)
+}
+
+func TestJob_when_exactlyOnceWithEdgePriorities_then_rejected(t *testing.T) {
+	teardownTest, jt := JobTestSetup(t)
+	defer teardownTest(t)
+
+	dag := NewDAG()
+	probe := dag.newVertex("probe", func() interface{} {
+		return NewListSourceP(sequence(10))
+	})
+	build := dag.newVertex("build", func() interface{} {
+		return NewListSourceP(sequence(10))
+	})
+	join := dag.newVertex("join", func() interface{} {
+		return NewNoopP()
+	})
+	dag.edge(From(probe, 0).To(join, 0).setPriority(1)).
+		edge(From(build, 0).To(join, 1).setPriority(0))
+
+	job := jt.service.newJobWithConfig(context.Background(), dag, NewJobConfig().setProcessingGuarantee(EXACTLY_ONCE))
+	assert.EqualError(t, job.Join(), "vertex join has inbound edges of different priorities, the EXACTLY_ONCE guarantee isn't supported")
+	assert.Equal(t, FAILED, job.Status())
+
+	job = jt.service.newJobWithConfig(context.Background(), dag, NewJobConfig().setProcessingGuarantee(AT_LEAST_ONCE))
+	assert.NoError(t, job.Join())
+}
+
+func TestJob_when_supplierReturnsWrongProcessorCount_then_jobFailedAndServiceUsable(t *testing.T) {
+	teardownTest, jt := JobTestSetup(t)
+	defer teardownTest(t)
+
+	dag := NewDAG()
+	dag.vertex(NewVertex("v", shortSupplier{NewProcessorSupplierFromGetFn(func() interface{} {
+		return NewNoopP()
+	})}).setLocalParallelism(2))
+	job := jt.service.newJob(context.Background(), dag)
+	assert.EqualError(t, job.Join(), "ProcessorSupplier of vertex v returned 1 processors instead of 2")
+	assert.Equal(t, FAILED, job.Status())
+
+	dag = NewDAG()
+	dag.newVertex("v", func() interface{} {
+		return NewNoopP()
+	})
+	assert.NoError(t, jt.service.newJob(context.Background(), dag).Join())
+}
@@ -38,6 +38,10 @@ type BatchStageWithKey interface {
 	// distinct attaches a stage that emits just the items that are distinct according to the grouping key
 	distinct()
 
+	// aggregate attaches a stage that performs the given group-and-aggregate operation, it emits a MapEntry of each
+	// distinct key and the result of the operation on the items with that key
+	aggregate(aggrOp AggregateOperation1) BatchStage
+
 }
 
 // StreamStageWithKey ...
@@ -57,6 +61,11 @@ type StageWithKeyAndWindow interface {
 
 	windowDefinition() WindowDefinition
 
+	// aggregate attaches a stage that performs the given aggregate operation over the items of each key in each window,
+	// it emits a KeyedWindowResult of each key and window
+	aggregate(aggrOp AggregateOperation1) StreamStage
 
-
+	// aggregateWithLateEvents is aggregate, the second stage gets the items that arrived later than the allowed lateness
+	// of their windows
+	aggregateWithLateEvents(aggrOp AggregateOperation1) (StreamStage, StreamStage)
 }
@@ -0,0 +1,116 @@
+package stream_processing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// LOOPBACK_BASE_PORT the port of the first member of a LoopbackNetwork, the following members get the next ports
+const LOOPBACK_BASE_PORT = 5701
+
+// LoopbackNetwork connects the members simulated in a single process, a packet is copied and delivered to the
+// handler of the target member directly from send
+type LoopbackNetwork struct {
+	mu         sync.RWMutex
+	transports map[Address]*loopbackTransport
+	addresses  []Address
+}
+
+func NewLoopbackNetwork(memberCount int) *LoopbackNetwork {
+	n := &LoopbackNetwork{transports: make(map[Address]*loopbackTransport)}
+	for i := 0; i < memberCount; i++ {
+		address := NewAddress("127.0.0.1", LOOPBACK_BASE_PORT+i)
+		n.transports[address] = &loopbackTransport{network: n, address: address}
+		n.addresses = append(n.addresses, address)
+	}
+	return n
+}
+
+// transport return the Transport of the member with the given index
+func (n *LoopbackNetwork) transport(memberIndex int) Transport {
+	return n.transports[n.addresses[memberIndex]]
+}
+
+// loopbackTransport the Transport of a member of a LoopbackNetwork
+type loopbackTransport struct {
+	network *LoopbackNetwork
+	address Address
+	handler atomic.Value
+}
+
+func (t *loopbackTransport) localAddress() Address {
+	return t.address
+}
+
+func (t *loopbackTransport) send(target Address, packet *Packet) error {
+	t.network.mu.RLock()
+	dest, ok := t.network.transports[target]
+	t.network.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown member %s", target)
+	}
+	handler, ok := dest.handler.Load().(PacketHandler)
+	if !ok {
+		return fmt.Errorf("member %s doesn't accept packets", target)
+	}
+	copied := *packet
+	copied.payload = append([]byte(nil), packet.payload...)
+	handler(&copied)
+	return nil
+}
+
+func (t *loopbackTransport) setPacketHandler(handler PacketHandler) {
+	t.handler.Store(handler)
+}
+
+// LoopbackCluster members simulated in a single process, each with its own ExecutionService, they run the jobs together
+type LoopbackCluster struct {
+	network   *LoopbackNetwork
+	members   []*ExecutionService
+	lastJobId int64
+}
+
+func NewLoopbackCluster(memberCount int, config *InstanceConfig) *LoopbackCluster {
+	c := &LoopbackCluster{network: NewLoopbackNetwork(memberCount)}
+	for i := 0; i < memberCount; i++ {
+		service := NewExecutionService(config)
+		service.setTransport(c.network.transport(i))
+		c.members = append(c.members, service)
+	}
+	return c
+}
+
+// newJob submits the DAG for execution on all members
+func (c *LoopbackCluster) newJob(ctx context.Context, dag *DAG) *Job {
+	return c.newJobWithConfig(ctx, dag, NewJobConfig())
+}
+
+// newJobWithConfig submits the DAG for execution on all members with the given job configuration
+func (c *LoopbackCluster) newJobWithConfig(ctx context.Context, dag *DAG, config *JobConfig) *Job {
+	job := NewJob(ctx, atomic.AddInt64(&c.lastJobId, 1), dag, config, c.members)
+	job.start()
+	return job
+}
+
+// newPipelineJob plans the pipeline into a DAG and submits it for execution with the given job configuration
+func (c *LoopbackCluster) newPipelineJob(ctx context.Context, pipeline Pipeline, config *JobConfig) *Job {
+	return c.newJobWithConfig(ctx, pipeline.toDag(), config)
+}
+
+// executePipeline runs the pipeline and blocks until it is done
+func (c *LoopbackCluster) executePipeline(ctx context.Context, pipeline Pipeline) error {
+	return c.newPipelineJob(ctx, pipeline, NewJobConfig()).Join()
+}
+
+// execute runs the DAG on all members and blocks until it is done
+func (c *LoopbackCluster) execute(ctx context.Context, dag *DAG) error {
+	return c.newJob(ctx, dag).Join()
+}
+
+func (c *LoopbackCluster) shutdown() {
+	for _, member := range c.members {
+		member.shutdown()
+	}
+}
@@ -0,0 +1,239 @@
+package stream_processing
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type LoopbackTest struct {
+	cluster  *LoopbackCluster
+	mu       sync.Mutex
+	received [][]interface{}
+}
+
+func LoopbackTestSetup(tb testing.TB) (func(tb testing.TB), *LoopbackTest) {
+	lt := &LoopbackTest{}
+	lt.cluster = NewLoopbackCluster(3, NewInstanceConfig().setCooperativeThreadCount(2))
+
+	return func(tb testing.TB) {
+		lt.cluster.shutdown()
+		tb.Log("LoopbackTestSetup teardown")
+	}, lt
+}
+
+// sinkSupplier a supplier whose processors record the received items, each processor of each member into its own list
+func (lt *LoopbackTest) sinkSupplier() GetFn {
+	return func() interface{} {
+		lt.mu.Lock()
+		index := len(lt.received)
+		lt.received = append(lt.received, nil)
+		lt.mu.Unlock()
+		return NewWriteFnSinkP(func(t interface{}) {
+			lt.mu.Lock()
+			defer lt.mu.Unlock()
+			lt.received[index] = append(lt.received[index], t)
+		})
+	}
+}
+
+func (lt *LoopbackTest) allReceived() []interface{} {
+	var all []interface{}
+	for _, items := range lt.received {
+		all = append(all, items...)
+	}
+	return all
+}
+
+// addressSourceMetaSupplier creates for each member a source that emits the member's address
+func addressSourceMetaSupplier() ProcessorMetaSupplier {
+	return NewMetaSupplierFromAddressFn(1, func(address Address) ProcessorSupplier {
+		return NewProcessorSupplierFromGetFn(func() interface{} {
+			return NewListSourceP([]interface{}{address.String()})
+		})
+	})
+}
+
+func TestLoopbackCluster_when_distributedPartitionedEdge_then_eachKeyOnOneProcessorOfCluster(t *testing.T) {
+	teardownTest, lt := LoopbackTestSetup(t)
+	defer teardownTest(t)
+
+	dag := NewDAG()
+	source := dag.newVertex("source", func() interface{} {
+		return NewListSourceP(sequence(100))
+	}).setLocalParallelism(1)
+	sink := dag.newVertex("sink", lt.sinkSupplier()).setLocalParallelism(2)
+	dag.edge(Between(source, sink).partitionedByKey(func(t interface{}) interface{} {
+		return t
+	}).distributed())
+
+	assert.NoError(t, lt.cluster.execute(context.Background(), dag))
+	assert.Len(t, lt.received, 6)
+	processorOfKey := make(map[interface{}]int)
+	for processorIndex, items := range lt.received {
+		for _, item := range items {
+			if other, ok := processorOfKey[item]; ok {
+				assert.Equal(t, other, processorIndex)
+			}
+			processorOfKey[item] = processorIndex
+		}
+	}
+	assert.Len(t, lt.allReceived(), 300)
+	assert.Len(t, processorOfKey, 100)
+}
+
+func TestLoopbackCluster_when_localEdge_then_itemsStayOnMember(t *testing.T) {
+	teardownTest, lt := LoopbackTestSetup(t)
+	defer teardownTest(t)
+
+	dag := NewDAG()
+	source := dag.vertex(NewVertexFromMetaSupplier("source", addressSourceMetaSupplier()))
+	sink := dag.newVertex("sink", lt.sinkSupplier()).setLocalParallelism(1)
+	dag.edge(Between(source, sink))
+
+	assert.NoError(t, lt.cluster.execute(context.Background(), dag))
+	for i, items := range lt.received {
+		assert.Equal(t, []interface{}{lt.cluster.members[i].address.String()}, items)
+	}
+}
+
+func TestLoopbackCluster_when_distributedBroadcastEdge_then_everyProcessorGetsItemsOfAllMembers(t *testing.T) {
+	teardownTest, lt := LoopbackTestSetup(t)
+	defer teardownTest(t)
+
+	metaSupplier := addressSourceMetaSupplier()
+	dag := NewDAG()
+	source := dag.vertex(NewVertexFromMetaSupplier("source", metaSupplier))
+	sink := dag.newVertex("sink", lt.sinkSupplier()).setLocalParallelism(2)
+	dag.edge(Between(source, sink).broadcast().distributed())
+
+	assert.NoError(t, lt.cluster.execute(context.Background(), dag))
+	var addresses []interface{}
+	for _, member := range lt.cluster.members {
+		addresses = append(addresses, member.address.String())
+	}
+	assert.Len(t, addresses, 3)
+	for _, items := range lt.received {
+		assert.ElementsMatch(t, addresses, items)
+	}
+}
+
+func TestLoopbackCluster_when_distributedFanoutEdge_then_eachMemberGetsEveryItemOnce(t *testing.T) {
+	teardownTest, lt := LoopbackTestSetup(t)
+	defer teardownTest(t)
+
+	dag := NewDAG()
+	source := dag.vertex(NewVertexFromMetaSupplier("source", addressSourceMetaSupplier()))
+	sink := dag.newVertex("sink", lt.sinkSupplier()).setLocalParallelism(2)
+	dag.edge(Between(source, sink).fanout().distributed())
+
+	assert.NoError(t, lt.cluster.execute(context.Background(), dag))
+	for member := 0; member < 3; member++ {
+		items := append(lt.received[2*member], lt.received[2*member+1]...)
+		assert.Len(t, items, 3)
+	}
+}
+
+func TestLoopbackCluster_when_moreItemsThanWindow_then_flowControlDeliversAll(t *testing.T) {
+	teardownTest, lt := LoopbackTestSetup(t)
+	defer teardownTest(t)
+
+	dag := NewDAG()
+	source := dag.newVertex("source", func() interface{} {
+		return NewListSourceP(sequence(5 * DEFAULT_QUEUE_SIZE))
+	}).setLocalParallelism(1)
+	sink := dag.newVertex("sink", lt.sinkSupplier()).setLocalParallelism(1)
+	dag.edge(Between(source, sink).distributed().setQueueSize(64))
+
+	assert.NoError(t, lt.cluster.execute(context.Background(), dag))
+	assert.Len(t, lt.allReceived(), 15*DEFAULT_QUEUE_SIZE)
+}
+
+func TestLoopbackTransport_when_unknownMember_then_sendFails(t *testing.T) {
+	network := NewLoopbackNetwork(1)
+	assert.Error(t, network.transport(0).send(NewAddress("10.0.0.1", 5701), &Packet{}))
+}
+
+func TestLoopbackTransport_when_batchSent_then_itemsDecoded(t *testing.T) {
+	registry := NewSerializerRegistry()
+	payload, err := registry.serializeBatch([]interface{}{1, "a", int64(2)})
+	assert.NoError(t, err)
+	items, err := registry.deserializeBatch(payload)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{1, "a", int64(2)}, items)
+}
+
+func TestLoopbackCluster_when_tuplesOnDistributedEdge_then_decodedOnOtherMembers(t *testing.T) {
+	teardownTest, lt := LoopbackTestSetup(t)
+	defer teardownTest(t)
+
+	dag := NewDAG()
+	source := dag.newVertex("source", func() interface{} {
+		return NewListSourceP([]interface{}{NewTuple2("a", 1), NewTuple3("b", 2, 3.5)})
+	}).setLocalParallelism(1)
+	sink := dag.newVertex("sink", lt.sinkSupplier()).setLocalParallelism(1)
+	dag.edge(Between(source, sink).distributed().broadcast())
+
+	assert.NoError(t, lt.cluster.execute(context.Background(), dag))
+	assert.Len(t, lt.allReceived(), 18)
+	for _, item := range lt.allReceived() {
+		assert.Contains(t, []interface{}{NewTuple2("a", 1), NewTuple3("b", 2, 3.5)}, item)
+	}
+}
+
+func TestLoopbackCluster_when_distributedEdgeWithWatermarks_then_coalescedOverAllMembers(t *testing.T) {
+	teardownTest, lt := LoopbackTestSetup(t)
+	defer teardownTest(t)
+
+	var wms [3][]int64
+	sinkIndex := 0
+	dag := NewDAG()
+	source := dag.newVertex("source", func() interface{} {
+		return NewListSourceP([]interface{}{1, NewWatermark(10), 2, NewWatermark(20)})
+	}).setLocalParallelism(1)
+	sink := dag.newVertex("sink", func() interface{} {
+		p := &watermarkRecordingP{NoopP: NewNoopP(), wms: &wms[sinkIndex]}
+		sinkIndex++
+		return p
+	}).setLocalParallelism(1)
+	dag.edge(Between(source, sink).distributed())
+
+	assert.NoError(t, lt.cluster.execute(context.Background(), dag))
+	for _, memberWms := range wms {
+		assert.Equal(t, []int64{10, 20}, memberWms)
+	}
+}
+
+func TestLoopbackCluster_when_pipelineRebalanced_then_itemsSpreadOverMembers(t *testing.T) {
+	teardownTest, lt := LoopbackTestSetup(t)
+	defer teardownTest(t)
+
+	p := NewPipelineImpl()
+	p.readFromBatchSource(NewSources().items(sequence(30)...)).rebalance().
+		writeTo(NewSinks().fromProcessor("sink", NewMetaSupplierFromProcessorSupplier(1, NewProcessorSupplierFromGetFn(lt.sinkSupplier()))))
+
+	assert.NoError(t, lt.cluster.executePipeline(context.Background(), p))
+	assert.ElementsMatch(t, sequence(30), lt.allReceived())
+	for _, items := range lt.received {
+		assert.NotEmpty(t, items)
+	}
+}
+
+func TestLoopbackCluster_when_pipelineAggregatesInTwoStages_then_countsOfAllMembers(t *testing.T) {
+	teardownTest, lt := LoopbackTestSetup(t)
+	defer teardownTest(t)
+
+	p := NewPipelineImpl()
+	words := NewSources().batchFromProcessor("words", NewMetaSupplierFromProcessorSupplier(2, NewProcessorSupplierFromGetFn(func() interface{} {
+		return NewListSourceP([]interface{}{"a", "b", "a"})
+	})))
+	p.readFromBatchSource(words).groupingKey(func(t interface{}) interface{} {
+		return t
+	}).aggregate(counting()).
+		writeTo(NewSinks().fromProcessor("sink", NewMetaSupplierFromProcessorSupplier(1, NewProcessorSupplierFromGetFn(lt.sinkSupplier()))))
+
+	assert.NoError(t, lt.cluster.executePipeline(context.Background(), p))
+	assert.ElementsMatch(t, []interface{}{MapEntry{key: "a", value: int64(12)}, MapEntry{key: "b", value: int64(6)}}, lt.allReceived())
+}
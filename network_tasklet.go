@@ -0,0 +1,240 @@
+package stream_processing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// packetKey identifies the tasklet a packet is addressed to: the job, the inbound edge of the destination vertex and
+// the member on the other side of the edge
+type packetKey struct {
+	packetType PacketType
+	jobId      int64
+	vertexName string
+	ordinal    int
+	peer       Address
+}
+
+// SenderTasklet drains the queues from the local upstream processors of a distributed edge to one remote member and
+// sends their items to it in packets. it stops draining when the member didn't acknowledge window items yet.
+// a snapshot barrier is sent once it arrived on all the queues
+type SenderTasklet struct {
+	transport   Transport
+	registry    *SerializerRegistry
+	destination Address
+	jobId       int64
+	vertexName  string
+	ordinal     int
+	instream    *InboundEdgeStream
+	window      int64
+
+	batch      []interface{}
+	sentCount  int64
+	ackedCount int64
+}
+
+// NewSenderTasklet creates the sender, waitForAlignment tells whether the queues that delivered a snapshot barrier are
+// blocked until it arrived on all of them
+func NewSenderTasklet(transport Transport, registry *SerializerRegistry, destination Address, jobId int64, edge *Edge, queues []Queue, waitForAlignment bool) *SenderTasklet {
+	instream := NewInboundEdgeStream(edge.destOrdinal, edge.priority, queues, NewWatermarkCoalescer(len(queues)), 0)
+	return &SenderTasklet{
+		transport:   transport,
+		registry:    registry,
+		destination: destination,
+		jobId:       jobId,
+		vertexName:  edge.destName,
+		ordinal:     edge.destOrdinal,
+		instream:    instream.setWaitForAlignment(waitForAlignment),
+		window:      int64(edge.queueSize),
+	}
+}
+
+func (s *SenderTasklet) init(ctx context.Context) {
+}
+
+func (s *SenderTasklet) isCooperative() bool {
+	return true
+}
+
+func (s *SenderTasklet) name() string {
+	return fmt.Sprintf("sender %s#%d -> %s", s.vertexName, s.ordinal, s.destination)
+}
+
+func (s *SenderTasklet) call() *ProgressState {
+	if s.sentCount-atomic.LoadInt64(&s.ackedCount) >= s.window {
+		return NO_PROGRESS
+	}
+	s.batch = s.batch[:0]
+	result, wm := s.instream.drainTo(func(item interface{}) {
+		s.batch = append(s.batch, item)
+	})
+	snapshotId := s.instream.receivedBarrier()
+	if len(s.batch) == 0 && wm == NO_NEW_WM && snapshotId == NO_SNAPSHOT && !result.isDone {
+		return result
+	}
+	payload, err := s.registry.serializeBatch(s.batch)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to serialize the items of %s: %v", s.name(), err))
+	}
+	packet := &Packet{
+		packetType: DATA_PACKET,
+		jobId:      s.jobId,
+		vertexName: s.vertexName,
+		ordinal:    s.ordinal,
+		sender:     s.transport.localAddress(),
+		payload:    payload,
+		watermark:  wm,
+		snapshotId: snapshotId,
+		done:       result.isDone,
+	}
+	if err := s.transport.send(s.destination, packet); err != nil {
+		panic(fmt.Sprintf("Failed to send a packet of %s: %v", s.name(), err))
+	}
+	s.sentCount += int64(len(s.batch))
+	if snapshotId != NO_SNAPSHOT {
+		s.instream.releaseBarrier()
+	}
+	if result.isDone {
+		return DONE
+	}
+	return MADE_PROGRESS
+}
+
+// onAck called by the transport when the destination member acknowledged items
+func (s *SenderTasklet) onAck(packet *Packet) {
+	atomic.AddInt64(&s.ackedCount, packet.ackCount)
+}
+
+// ReceiverTasklet receives the packets of a distributed edge from one remote member and routes their items to the
+// queues towards the local downstream processors
+type ReceiverTasklet struct {
+	transport  Transport
+	registry   *SerializerRegistry
+	sender     Address
+	jobId      int64
+	vertexName string
+	ordinal    int
+	collector  OutboundCollector
+
+	mu       sync.Mutex
+	incoming []*Packet
+
+	// pending the received items not yet accepted by the collector, followed by the watermark, the barrier and DONE_ITEM
+	pending  []interface{}
+	ackCount int64
+}
+
+func NewReceiverTasklet(transport Transport, registry *SerializerRegistry, sender Address, jobId int64, edge *Edge, collector OutboundCollector) *ReceiverTasklet {
+	return &ReceiverTasklet{
+		transport:  transport,
+		registry:   registry,
+		sender:     sender,
+		jobId:      jobId,
+		vertexName: edge.destName,
+		ordinal:    edge.destOrdinal,
+		collector:  collector,
+	}
+}
+
+func (r *ReceiverTasklet) init(ctx context.Context) {
+}
+
+func (r *ReceiverTasklet) isCooperative() bool {
+	return true
+}
+
+func (r *ReceiverTasklet) name() string {
+	return fmt.Sprintf("receiver %s#%d <- %s", r.vertexName, r.ordinal, r.sender)
+}
+
+// onPacket called by the transport when a packet from the sender arrived
+func (r *ReceiverTasklet) onPacket(packet *Packet) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.incoming = append(r.incoming, packet)
+}
+
+func (r *ReceiverTasklet) pollPacket() *Packet {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.incoming) == 0 {
+		return nil
+	}
+	packet := r.incoming[0]
+	r.incoming[0] = nil
+	r.incoming = r.incoming[1:]
+	return packet
+}
+
+func (r *ReceiverTasklet) call() *ProgressState {
+	tracker := NewProgressTracker()
+	tracker.notDone()
+	if len(r.pending) == 0 {
+		packet := r.pollPacket()
+		if packet == nil {
+			return NO_PROGRESS
+		}
+		tracker.madeProgress()
+		items, err := r.registry.deserializeBatch(packet.payload)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to deserialize the items of %s: %v", r.name(), err))
+		}
+		r.pending = items
+		if packet.watermark == IDLE_MESSAGE.timestamp {
+			r.pending = append(r.pending, IDLE_MESSAGE)
+		} else if packet.watermark != NO_NEW_WM {
+			r.pending = append(r.pending, NewWatermark(packet.watermark))
+		}
+		if packet.snapshotId != NO_SNAPSHOT {
+			r.pending = append(r.pending, NewSnapshotBarrier(packet.snapshotId))
+		}
+		if packet.done {
+			r.pending = append(r.pending, DONE_ITEM)
+		}
+	}
+	for len(r.pending) > 0 {
+		item := r.pending[0]
+		var result *ProgressState
+		if isBroadcastItem(item) {
+			result = r.collector.offerBroadcast(item)
+		} else {
+			result = r.collector.offer(item)
+		}
+		if !result.isDone {
+			break
+		}
+		tracker.madeProgress()
+		r.pending[0] = nil
+		r.pending = r.pending[1:]
+		if item == DONE_ITEM {
+			r.sendAck()
+			return DONE
+		}
+		if !isBroadcastItem(item) {
+			r.ackCount++
+		}
+	}
+	r.sendAck()
+	return tracker.toProgressState()
+}
+
+// sendAck acknowledges the items accepted since the last acknowledgement
+func (r *ReceiverTasklet) sendAck() {
+	if r.ackCount == 0 {
+		return
+	}
+	packet := &Packet{
+		packetType: ACK_PACKET,
+		jobId:      r.jobId,
+		vertexName: r.vertexName,
+		ordinal:    r.ordinal,
+		sender:     r.transport.localAddress(),
+		ackCount:   r.ackCount,
+	}
+	if err := r.transport.send(r.sender, packet); err != nil {
+		panic(fmt.Sprintf("Failed to acknowledge the packets of %s: %v", r.name(), err))
+	}
+	r.ackCount = 0
+}
@@ -1,6 +1,10 @@
 package stream_processing
 
-import "container/list"
+import (
+	"container/list"
+	"fmt"
+	"reflect"
+)
 
 // Outbox data sink for a Processor. the outbox consists of individual output buckets
 type Outbox interface {
@@ -15,6 +19,9 @@ type Outbox interface {
 
 	offerWithMany(ordinal []int, item interface{}) bool
 
+	// offerToSnapshot offers the key-value pair to the snapshot bucket, only allowed in Processor.saveToSnapshot
+	// return true if the outbox accepted the entry
+	offerToSnapshot(key, value interface{}) bool
 }
 
 // OutboxInternal ...
@@ -33,13 +40,214 @@ type OutboxInternal interface {
 }
 
 
+// OUTBOX_BATCH_SIZE the default number of items a bucket of OutboxImpl accepts between two reset calls
+const OUTBOX_BATCH_SIZE = 1024
 
-//type OutboxImpl struct {
-//	outstreams []
-//}
+// OutboxImpl the Outbox of a processor driven by a ProcessorTasklet. each bucket is backed by the OutboundCollector of an outbound edge.
+// a bucket accepts at most batchSize items between two reset calls, after that, or when the downstream queue is full, offer returns false
+type OutboxImpl struct {
+	outstreams       []OutboundCollector
+	allOrdinals      []int
+	singleOrdinal    []int
+	broadcastTracker []bool
 
+	batchSize           int
+	numRemainingInBatch []int
+	blocked             bool
+	unfinishedItem      interface{}
+	lastForwardedWmTs   int64
 
+	// unfinishedOrdinals the ordinals the unfinishedItem was offered to, it must be offered again to the same ones
+	unfinishedOrdinals []int
+
+	// acceptedCount the number of items the outbox accepted so far, the tasklet uses it to detect progress
+	acceptedCount int64
+
+	// snapshotEntries the entries offered to the snapshot bucket since the last takeSnapshotEntries
+	snapshotEntries []MapEntry
+}
+
+func NewOutboxImpl(outstreams []OutboundCollector, batchSize int) *OutboxImpl {
+	o := &OutboxImpl{
+		outstreams:          outstreams,
+		allOrdinals:         make([]int, len(outstreams)),
+		singleOrdinal:       make([]int, 1),
+		broadcastTracker:    make([]bool, len(outstreams)),
+		batchSize:           batchSize,
+		numRemainingInBatch: make([]int, len(outstreams)),
+		lastForwardedWmTs:   Min_Value,
+	}
+	for i := range o.allOrdinals {
+		o.allOrdinals[i] = i
+	}
+	o.reset()
+	return o
+}
+
+func (o *OutboxImpl) bucketCount() int {
+	return len(o.outstreams)
+}
+
+func (o *OutboxImpl) offer(ordinal int, item interface{}) bool {
+	if ordinal == -1 {
+		return o.offerWithMany(o.allOrdinals, item)
+	}
+	o.singleOrdinal[0] = ordinal
+	return o.offerWithMany(o.singleOrdinal, item)
+}
+
+func (o *OutboxImpl) offerWithMany(ordinals []int, item interface{}) bool {
+	if o.blocked && o.unfinishedItem == nil {
+		return false
+	}
+	if o.unfinishedItem != nil {
+		if !sameItem(o.unfinishedItem, item) {
+			panic(fmt.Sprintf("Different item offered after previous call returned false: %v, the unfinished item is %v", item, o.unfinishedItem))
+		}
+		if !reflect.DeepEqual(o.unfinishedOrdinals, ordinals) {
+			panic(fmt.Sprintf("Item offered to ordinals %v after previous call returned false, it was offered to %v", ordinals, o.unfinishedOrdinals))
+		}
+	}
+	done := true
+	for i, ordinal := range ordinals {
+		if o.broadcastTracker[i] {
+			continue
+		}
+		if o.numRemainingInBatch[ordinal] == 0 || !o.doOffer(o.outstreams[ordinal], item).isDone {
+			done = false
+			continue
+		}
+		o.broadcastTracker[i] = true
+		o.numRemainingInBatch[ordinal]--
+	}
+	if !done {
+		o.unfinishedItem = item
+		o.unfinishedOrdinals = append(o.unfinishedOrdinals[:0], ordinals...)
+		return false
+	}
+	for i := range ordinals {
+		o.broadcastTracker[i] = false
+	}
+	o.unfinishedItem = nil
+	o.acceptedCount++
+	if wm, ok := item.(*Watermark); ok && !wm.isIdleMessage() {
+		o.lastForwardedWmTs = wm.timestamp
+	}
+	return true
+}
+
+// sameItem tells whether an item offered again is the unfinished one, the items of an uncomparable type are compared
+// deeply
+func sameItem(unfinished, item interface{}) bool {
+	if reflect.TypeOf(unfinished) != reflect.TypeOf(item) {
+		return false
+	}
+	if reflect.TypeOf(item).Comparable() {
+		return unfinished == item
+	}
+	return reflect.DeepEqual(unfinished, item)
+}
+
+// offerToEdges offers the item to all outbound edges
+func (o *OutboxImpl) offerToEdges(item interface{}) bool {
+	return o.offerWithMany(o.allOrdinals, item)
+}
+
+func (o *OutboxImpl) offerToSnapshot(key, value interface{}) bool {
+	o.snapshotEntries = append(o.snapshotEntries, MapEntry{key: key, value: value})
+	return true
+}
+
+// takeSnapshotEntries return the entries offered to the snapshot bucket and empties it
+func (o *OutboxImpl) takeSnapshotEntries() []MapEntry {
+	entries := o.snapshotEntries
+	o.snapshotEntries = nil
+	return entries
+}
+
+// hasUnfinishedItem tells whether an item was accepted by some of the buckets only, it must be offered again
+func (o *OutboxImpl) hasUnfinishedItem() bool {
+	return o.unfinishedItem != nil
+}
+
+func (o *OutboxImpl) doOffer(collector OutboundCollector, item interface{}) *ProgressState {
+	if isBroadcastItem(item) {
+		return collector.offerBroadcast(item)
+	}
+	return collector.offer(item)
+}
+
+func (o *OutboxImpl) reset() {
+	for i := range o.numRemainingInBatch {
+		o.numRemainingInBatch[i] = o.batchSize
+	}
+}
+
+func (o *OutboxImpl) block() {
+	o.blocked = true
+}
+
+func (o *OutboxImpl) unblock() {
+	o.blocked = false
+}
+
+func (o *OutboxImpl) lastForwardedWm() int64 {
+	return o.lastForwardedWmTs
+}
+
+// listCollector an OutboundCollector that adds the items to a list of limited capacity
+type listCollector struct {
+	list     *list.List
+	capacity int
+}
+
+func (c *listCollector) offer(item interface{}) *ProgressState {
+	if c.list.Len() >= c.capacity {
+		return NO_PROGRESS
+	}
+	c.list.PushBack(item)
+	return DONE
+}
+
+func (c *listCollector) offerBroadcast(item interface{}) *ProgressState {
+	return c.offer(item)
+}
+
+func (c *listCollector) getPartitions() []int {
+	return nil
+}
+
+// TestOutbox implementation suitable to be used in tests. each bucket is a list with the given capacity
 type TestOutbox struct {
+	*OutboxImpl
 	buckets []*list.List
+}
 
-}
\ No newline at end of file
+func NewTestOutbox(capacities ...int) *TestOutbox {
+	o := &TestOutbox{}
+	collectors := make([]OutboundCollector, len(capacities))
+	batchSize := 0
+	for i, capacity := range capacities {
+		o.buckets = append(o.buckets, list.New())
+		collectors[i] = &listCollector{list: o.buckets[i], capacity: capacity}
+		batchSize = Max(batchSize, capacity)
+	}
+	o.OutboxImpl = NewOutboxImpl(collectors, batchSize)
+	return o
+}
+
+// queue returns the bucket with the given ordinal
+func (o *TestOutbox) queue(ordinal int) *list.List {
+	return o.buckets[ordinal]
+}
+
+// drainQueueAndReset removes all items from the bucket with the given ordinal and resets the outbox
+func (o *TestOutbox) drainQueueAndReset(ordinal int) []interface{} {
+	var items []interface{}
+	bucket := o.buckets[ordinal]
+	for e := bucket.Front(); e != nil; e = bucket.Front() {
+		items = append(items, bucket.Remove(e))
+	}
+	o.reset()
+	return items
+}
@@ -0,0 +1,126 @@
+package stream_processing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type OutboxTest struct {
+	outbox *TestOutbox
+}
+
+func OutboxTestSetup(tb testing.TB) (func(tb testing.TB), OutboxTest) {
+	ot := OutboxTest{}
+	ot.outbox = NewTestOutbox(2, 3)
+
+	return func(tb testing.TB) {
+		tb.Log("OutboxTestSetup teardown")
+	}, ot
+}
+
+func TestOutbox_when_bucketFull_then_offerRejected(t *testing.T) {
+	teardownTest, ot := OutboxTestSetup(t)
+	defer teardownTest(t)
+
+	assert.True(t, ot.outbox.offer(0, "a"))
+	assert.True(t, ot.outbox.offer(0, "b"))
+	assert.False(t, ot.outbox.offer(0, "c"))
+
+	assert.Equal(t, []interface{}{"a", "b"}, ot.outbox.drainQueueAndReset(0))
+	assert.True(t, ot.outbox.offer(0, "c"))
+}
+
+func TestOutbox_when_batchExhausted_then_offerRejectedUntilReset(t *testing.T) {
+	teardownTest, _ := OutboxTestSetup(t)
+	defer teardownTest(t)
+
+	outbox := NewOutboxImpl([]OutboundCollector{&listCollector{list: NewTestOutbox(10).queue(0), capacity: 10}}, 2)
+	assert.True(t, outbox.offer(0, "a"))
+	assert.True(t, outbox.offer(0, "b"))
+	assert.False(t, outbox.offer(0, "c"))
+
+	outbox.reset()
+	assert.True(t, outbox.offer(0, "c"))
+}
+
+func TestOutbox_when_offerToAllPartiallyAccepted_then_retryOffersOnlyToRemaining(t *testing.T) {
+	teardownTest, ot := OutboxTestSetup(t)
+	defer teardownTest(t)
+
+	assert.True(t, ot.outbox.offer(0, "a"))
+	assert.True(t, ot.outbox.offer(0, "b"))
+
+	// bucket 0 is full, bucket 1 accepts the item
+	assert.False(t, ot.outbox.offer(-1, "c"))
+	assert.Equal(t, 1, ot.outbox.queue(1).Len())
+
+	ot.outbox.drainQueueAndReset(0)
+	assert.True(t, ot.outbox.offer(-1, "c"))
+	assert.Equal(t, 1, ot.outbox.queue(0).Len())
+	assert.Equal(t, 1, ot.outbox.queue(1).Len())
+}
+
+func TestOutbox_when_blocked_then_onlyUnfinishedItemAccepted(t *testing.T) {
+	teardownTest, ot := OutboxTestSetup(t)
+	defer teardownTest(t)
+
+	assert.True(t, ot.outbox.offer(0, "a"))
+	assert.True(t, ot.outbox.offer(0, "b"))
+	assert.False(t, ot.outbox.offer(0, "c"))
+
+	ot.outbox.block()
+	ot.outbox.drainQueueAndReset(0)
+	assert.True(t, ot.outbox.offer(0, "c"))
+	assert.False(t, ot.outbox.offer(0, "d"))
+
+	ot.outbox.unblock()
+	assert.True(t, ot.outbox.offer(0, "d"))
+}
+
+func TestOutbox_when_watermarkOffered_then_lastForwardedWmUpdated(t *testing.T) {
+	teardownTest, ot := OutboxTestSetup(t)
+	defer teardownTest(t)
+
+	assert.Equal(t, Min_Value, ot.outbox.lastForwardedWm())
+	assert.True(t, ot.outbox.offer(-1, NewWatermark(10)))
+	assert.Equal(t, int64(10), ot.outbox.lastForwardedWm())
+
+	// the idle message is not a real watermark
+	assert.True(t, ot.outbox.offer(-1, IDLE_MESSAGE))
+	assert.Equal(t, int64(10), ot.outbox.lastForwardedWm())
+}
+
+func TestOutbox_when_processorEmitsToFullOutbox_then_backsOffAndResumes(t *testing.T) {
+	teardownTest, ot := OutboxTestSetup(t)
+	defer teardownTest(t)
+
+	p := NewListSourceP([]interface{}{1, 2, 3})
+	p.init(nil, ot.outbox)
+
+	assert.False(t, p.complete())
+	assert.Equal(t, []interface{}{1, 2}, ot.outbox.drainQueueAndReset(0))
+	ot.outbox.drainQueueAndReset(1)
+	assert.True(t, p.complete())
+	assert.Equal(t, []interface{}{3}, ot.outbox.drainQueueAndReset(0))
+}
+
+func TestOutbox_when_otherItemOrOrdinalsAfterRejectedOffer_then_panics(t *testing.T) {
+	teardownTest, ot := OutboxTestSetup(t)
+	defer teardownTest(t)
+
+	assert.True(t, ot.outbox.offer(0, "a"))
+	assert.True(t, ot.outbox.offer(0, "b"))
+	assert.False(t, ot.outbox.offer(-1, "c"))
+
+	assert.Panics(t, func() {
+		ot.outbox.offer(-1, "d")
+	})
+	assert.Panics(t, func() {
+		ot.outbox.offer(0, "c")
+	})
+
+	ot.outbox.drainQueueAndReset(0)
+	assert.True(t, ot.outbox.offer(-1, "c"))
+	assert.True(t, ot.outbox.offer(0, "d"))
+}
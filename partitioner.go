@@ -1,5 +1,14 @@
 package stream_processing
 
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"math"
+	"reflect"
+)
+
 // Partitioner decides on the partition ID of an item traveling over it.
 // the partition ID determines which cluster member and which instance of Processor on that member an item will be forwarded to
 type Partitioner interface {
@@ -19,14 +28,182 @@ type DefaultPartitionStrategy interface {
 }
 
 
+// PartitionAware implemented by keys that want to be partitioned by another key, the items with equal partition keys
+// land in the same partition
+type PartitionAware interface {
+
+	// getPartitionKey return the key used to decide on the partition
+	getPartitionKey() interface{}
+}
+
+// DefaultPartitionStrategyImpl hashes the key and takes the hash modulo the partition count
 type DefaultPartitionStrategyImpl struct {
+	partitionCount int
+}
+
+func NewDefaultPartitionStrategy(partitionCount int) DefaultPartitionStrategyImpl {
+	if partitionCount <= 0 {
+		panic("partitionCount must be positive")
+	}
+	return DefaultPartitionStrategyImpl{partitionCount: partitionCount}
 }
 
 func (d DefaultPartitionStrategyImpl) getPartition(o interface{}) int {
-	if v, ok := o.(int); ok {
-		return v
+	return int(hashKey(o) % uint64(d.partitionCount))
+}
+
+// hashKey return a stable hash of the key, it is the same in every process and for every run. all signed and
+// unsigned integer types hash the same for the same value, a string hashes the same as its bytes. a key holding a
+// pointer, map, func or chan is rejected
+func hashKey(key interface{}) uint64 {
+	h := fnv.New64a()
+	writeKey(h, key)
+	return h.Sum64()
+}
+
+// key type markers, they keep the encodings of different kinds of keys apart
+const (
+	keyNil byte = iota
+	keyInt
+	keyBytes
+	keyBool
+	keyFloat
+	keyTuple2
+	keyTuple3
+	keyOther
+)
+
+// writeKey writes a canonical encoding of the key into the hash
+func writeKey(h hash.Hash64, key interface{}) {
+	if pa, ok := key.(PartitionAware); ok {
+		key = pa.getPartitionKey()
+	}
+	var buf [9]byte
+	switch k := key.(type) {
+	case nil:
+		h.Write([]byte{keyNil})
+	case int:
+		writeInt(h, buf[:], uint64(k))
+	case int8:
+		writeInt(h, buf[:], uint64(k))
+	case int16:
+		writeInt(h, buf[:], uint64(k))
+	case int32:
+		writeInt(h, buf[:], uint64(k))
+	case int64:
+		writeInt(h, buf[:], uint64(k))
+	case uint:
+		writeInt(h, buf[:], uint64(k))
+	case uint8:
+		writeInt(h, buf[:], uint64(k))
+	case uint16:
+		writeInt(h, buf[:], uint64(k))
+	case uint32:
+		writeInt(h, buf[:], uint64(k))
+	case uint64:
+		writeInt(h, buf[:], k)
+	case uintptr:
+		writeInt(h, buf[:], uint64(k))
+	case string:
+		writeBytes(h, buf[:], []byte(k))
+	case []byte:
+		writeBytes(h, buf[:], k)
+	case bool:
+		if k {
+			h.Write([]byte{keyBool, 1})
+		} else {
+			h.Write([]byte{keyBool, 0})
+		}
+	case float32:
+		buf[0] = keyFloat
+		binary.LittleEndian.PutUint64(buf[1:], math.Float64bits(float64(k)))
+		h.Write(buf[:])
+	case float64:
+		buf[0] = keyFloat
+		binary.LittleEndian.PutUint64(buf[1:], math.Float64bits(k))
+		h.Write(buf[:])
+	case Tuple2:
+		h.Write([]byte{keyTuple2})
+		writeKey(h, k.f0)
+		writeKey(h, k.f1)
+	case Tuple3:
+		h.Write([]byte{keyTuple3})
+		writeKey(h, k.f0)
+		writeKey(h, k.f1)
+		writeKey(h, k.f2)
+	default:
+		// any other key is hashed by its type and the values of its fields
+		h.Write([]byte{keyOther})
+		v := reflect.ValueOf(k)
+		h.Write([]byte(v.Type().String()))
+		writeValue(h, buf[:], v, v.Type())
+	}
+}
+
+// writeValue writes the value of a key that isn't one of the known types, structs and arrays are written field by
+// field, slices element by element. a pointer, map, func or chan in the key would be hashed by its address, which differs between processes and
+// runs, such a key is rejected, it has to be PartitionAware
+func writeValue(h hash.Hash64, buf []byte, v reflect.Value, keyType reflect.Type) {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			h.Write([]byte{keyBool, 1})
+		} else {
+			h.Write([]byte{keyBool, 0})
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeInt(h, buf, uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeInt(h, buf, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		buf[0] = keyFloat
+		binary.LittleEndian.PutUint64(buf[1:], math.Float64bits(v.Float()))
+		h.Write(buf)
+	case reflect.Complex64, reflect.Complex128:
+		buf[0] = keyFloat
+		binary.LittleEndian.PutUint64(buf[1:], math.Float64bits(real(v.Complex())))
+		h.Write(buf)
+		binary.LittleEndian.PutUint64(buf[1:], math.Float64bits(imag(v.Complex())))
+		h.Write(buf)
+	case reflect.String:
+		writeBytes(h, buf, []byte(v.String()))
+	case reflect.Slice:
+		buf[0] = keyBytes
+		binary.LittleEndian.PutUint64(buf[1:], uint64(v.Len()))
+		h.Write(buf)
+		fallthrough
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			writeValue(h, buf, v.Index(i), keyType)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			writeValue(h, buf, v.Field(i), keyType)
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			h.Write([]byte{keyNil})
+			return
+		}
+		h.Write([]byte(v.Elem().Type().String()))
+		writeValue(h, buf, v.Elem(), keyType)
+	default:
+		panic(fmt.Sprintf("Key of type %s can't be partitioned, it holds a %s whose hash isn't stable. implement PartitionAware to partition it by a value", keyType, v.Kind()))
 	}
-	return 0
+}
+
+func writeInt(h hash.Hash64, buf []byte, v uint64) {
+	buf[0] = keyInt
+	binary.LittleEndian.PutUint64(buf[1:], v)
+	h.Write(buf)
+}
+
+// writeBytes writes the length before the bytes, so the fields of a tuple can't run into each other
+func writeBytes(h hash.Hash64, buf []byte, b []byte) {
+	buf[0] = keyBytes
+	binary.LittleEndian.PutUint64(buf[1:], uint64(len(b)))
+	h.Write(buf)
+	h.Write(b)
 }
 
 type DefaultPartitioner struct {
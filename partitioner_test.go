@@ -0,0 +1,116 @@
+package stream_processing
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type PartitionerTest struct {
+	strategy DefaultPartitionStrategyImpl
+}
+
+func PartitionerTestSetup(tb testing.TB) (func(tb testing.TB), PartitionerTest) {
+	pt := PartitionerTest{}
+	pt.strategy = NewDefaultPartitionStrategy(DEFAULT_PARTITION_COUNT)
+
+	return func(tb testing.TB) {
+		tb.Log("PartitionerTestSetup teardown")
+	}, pt
+}
+
+// orderKey a PartitionAware key, all the orders of a customer land in the same partition
+type orderKey struct {
+	orderId    int
+	customerId string
+}
+
+func (k orderKey) getPartitionKey() interface{} {
+	return k.customerId
+}
+
+func TestDefaultPartitionStrategy_when_sameValueDifferentIntWidths_then_samePartition(t *testing.T) {
+	teardownTest, pt := PartitionerTestSetup(t)
+	defer teardownTest(t)
+
+	expected := pt.strategy.getPartition(42)
+	for _, key := range []interface{}{int8(42), int16(42), int32(42), int64(42), uint(42), uint8(42), uint16(42), uint32(42), uint64(42)} {
+		assert.Equal(t, expected, pt.strategy.getPartition(key), "%T", key)
+	}
+}
+
+func TestDefaultPartitionStrategy_when_equalKeys_then_samePartition(t *testing.T) {
+	teardownTest, pt := PartitionerTestSetup(t)
+	defer teardownTest(t)
+
+	assert.Equal(t, pt.strategy.getPartition("key"), pt.strategy.getPartition([]byte("key")))
+	assert.Equal(t, pt.strategy.getPartition(NewTuple2("a", 1)), pt.strategy.getPartition(NewTuple2("a", int64(1))))
+	assert.Equal(t, pt.strategy.getPartition(NewTuple3("a", 1, true)), pt.strategy.getPartition(NewTuple3("a", 1, true)))
+	assert.Equal(t, pt.strategy.getPartition(orderKey{1, "c1"}), pt.strategy.getPartition(orderKey{2, "c1"}))
+	assert.Equal(t, pt.strategy.getPartition(struct{ a, b int }{1, 2}), pt.strategy.getPartition(struct{ a, b int }{1, 2}))
+}
+
+func TestDefaultPartitionStrategy_when_tupleFieldsShifted_then_differentPartitions(t *testing.T) {
+	teardownTest, _ := PartitionerTestSetup(t)
+	defer teardownTest(t)
+
+	assert.NotEqual(t, hashKey(NewTuple2("ab", "c")), hashKey(NewTuple2("a", "bc")))
+}
+
+func TestDefaultPartitionStrategy_when_manyKeys_then_allPartitionsUsedAndInRange(t *testing.T) {
+	teardownTest, pt := PartitionerTestSetup(t)
+	defer teardownTest(t)
+
+	counts := make([]int, DEFAULT_PARTITION_COUNT)
+	for i := 0; i < 100*DEFAULT_PARTITION_COUNT; i++ {
+		partition := pt.strategy.getPartition(fmt.Sprintf("key-%d", i))
+		assert.True(t, partition >= 0 && partition < DEFAULT_PARTITION_COUNT)
+		counts[partition]++
+	}
+	for _, count := range counts {
+		assert.Greater(t, count, 50)
+		assert.Less(t, count, 150)
+	}
+}
+
+func TestDefaultPartitionStrategy_when_nonPositiveCount_then_panics(t *testing.T) {
+	assert.Panics(t, func() {
+		NewDefaultPartitionStrategy(0)
+	})
+}
+
+// accountKey a struct key with a field of a named type and an interface field
+type accountKey struct {
+	Region region
+	Id     interface{}
+}
+
+type region string
+
+func TestDefaultPartitionStrategy_when_structKeysEqual_then_sameHash(t *testing.T) {
+	teardownTest, _ := PartitionerTestSetup(t)
+	defer teardownTest(t)
+
+	assert.Equal(t, hashKey(accountKey{"eu", 7}), hashKey(accountKey{region("e" + "u"), 7}))
+	assert.NotEqual(t, hashKey(accountKey{"eu", 7}), hashKey(accountKey{"eu", int64(7)}))
+	assert.NotEqual(t, hashKey(region("eu")), hashKey("eu"))
+	// the hash doesn't depend on the process, it is the same for every run
+	assert.Equal(t, uint64(0x9219faea463f766d), hashKey(accountKey{"eu", 7}))
+}
+
+func TestDefaultPartitionStrategy_when_keyHoldsPointer_then_panics(t *testing.T) {
+	teardownTest, pt := PartitionerTestSetup(t)
+	defer teardownTest(t)
+
+	id := 7
+	assert.Panics(t, func() {
+		pt.strategy.getPartition(&id)
+	})
+	assert.Panics(t, func() {
+		pt.strategy.getPartition(accountKey{"eu", &id})
+	})
+	assert.Panics(t, func() {
+		pt.strategy.getPartition(struct{ fn func() }{func() {}})
+	})
+}
@@ -1,5 +1,7 @@
 package stream_processing
 
+import "fmt"
+
 // BatchSource a finite source of data for pipeline
 type BatchSource interface {
 	name() string
@@ -38,6 +40,13 @@ type Pipeline interface {
 	// setPreserveOrder whether or not it is allowed to reorder the events for better performance
 	setPreserveOrder(value bool) Pipeline
 
+	// isFuseStatelessStages return the fuse stateless stages property of this pipeline
+	isFuseStatelessStages() bool
+
+	// setFuseStatelessStages whether or not the chains of stateless stages are planned as a single vertex, so the items
+	// don't pass a queue between them. the stages are fused unless an input is rebalanced or their local parallelism differ
+	setFuseStatelessStages(value bool) Pipeline
+
 	// readFromBatchSource return a pipeline stage that represents a bounded data source
 	readFromBatchSource(source BatchSource) BatchStage
 
@@ -49,78 +58,346 @@ type Pipeline interface {
 
 	// isEmpty return true if there are no stages in the pipeline
 	isEmpty() bool
+
+	// toDag transforms the pipeline into a DAG which can be submitted for execution
+	toDag() *DAG
 }
 
+// ServiceFactory creates the service the *UsingService stages pass to their functions. every processor of the stage
+// creates its own service with createServiceFn when it's initialized and destroys it with destroyServiceFn once its
+// input is exhausted
 type ServiceFactory struct {
+	createServiceFn  GetFn
+	destroyServiceFn AcceptFn
+}
+
+// NewServiceFactory a nil destroyServiceFn leaves the services as they are
+func NewServiceFactory(createServiceFn GetFn, destroyServiceFn AcceptFn) ServiceFactory {
+	if createServiceFn == nil {
+		panic("createServiceFn must not be nil")
+	}
+	return ServiceFactory{createServiceFn: createServiceFn, destroyServiceFn: destroyServiceFn}
+}
+
+// createService returns a new service for a processor
+func (f ServiceFactory) createService() interface{} {
+	if f.createServiceFn == nil {
+		panic("the service factory has no createServiceFn, create it with NewServiceFactory")
+	}
+	return f.createServiceFn()
+}
+
+// destroyService releases the service of a processor
+func (f ServiceFactory) destroyService(service interface{}) {
+	if f.destroyServiceFn != nil {
+		f.destroyServiceFn(service)
+	}
 }
 
 // PipelineImpl implementation of Pipeline
 type PipelineImpl struct {
-	adjacencyMap  map[Transform][]Transform
-	attachedFiles map[string]interface{}
-	preserveOrder bool
+	// adjacencyMap maps each transform to the transforms attached to its output, a transform with more than one is fanned out
+	adjacencyMap map[Transform][]Transform
+	// transforms the transforms in the order they were added, upstream transforms always come before their downstream ones
+	transforms          []Transform
+	attachedFiles       map[string]interface{}
+	preserveOrder       bool
+	fuseStatelessStages bool
+}
+
+func NewPipelineImpl() *PipelineImpl {
+	return &PipelineImpl{
+		adjacencyMap:  make(map[Transform][]Transform),
+		attachedFiles: make(map[string]interface{}),
+	}
+}
+
+func (p *PipelineImpl) create() Pipeline {
+	return NewPipelineImpl()
 }
 
-func (p PipelineImpl) create() Pipeline {
-	panic("implement me")
+func (p *PipelineImpl) isPreserveOrder() bool {
+	return p.preserveOrder
+}
+
+func (p *PipelineImpl) setPreserveOrder(value bool) Pipeline {
+	p.preserveOrder = value
+	return p
+}
+
+func (p *PipelineImpl) isFuseStatelessStages() bool {
+	return p.fuseStatelessStages
+}
+
+func (p *PipelineImpl) setFuseStatelessStages(value bool) Pipeline {
+	p.fuseStatelessStages = value
+	return p
+}
+
+func (p *PipelineImpl) readFromBatchSource(source BatchSource) BatchStage {
+	transform, ok := source.(*BatchSourceTransform)
+	if !ok {
+		panic(fmt.Sprintf("unsupported batch source %s", source.name()))
+	}
+	if transform.isAssignedToStage {
+		panic(fmt.Sprintf("source %s was already read from, create a new source for every stage", source.name()))
+	}
+	transform.isAssignedToStage = true
+	p.register(transform)
+	return NewBatchStageImpl(NewAbstractStage(transform, p, DO_NOT_ADAPT))
+}
+
+func (p *PipelineImpl) readFromStreamSource(source StreamSource) StreamSourceStage {
+	transform, ok := source.(*StreamSourceTransform)
+	if !ok {
+		panic(fmt.Sprintf("unsupported stream source %s", source.name()))
+	}
+	if transform.isAssignedToStage {
+		panic(fmt.Sprintf("source %s was already read from, create a new source for every stage", source.name()))
+	}
+	transform.isAssignedToStage = true
+	p.register(transform)
+	return NewStreamSourceStageImpl(transform, p)
+}
+
+func (p *PipelineImpl) writeTo(sink Sink, stages ...GeneralStage) SinkStage {
+	if len(stages) == 0 {
+		panic("at least one stage must be written to the sink")
+	}
+	upstream := make([]*AbstractStage, len(stages))
+	for i, stage := range stages {
+		upstream[i] = abstractStageOf(stage)
+	}
+	return p.writeToStages(sink, upstream)
 }
 
-func (p PipelineImpl) isPreserveOrder() bool {
-	panic("implement me")
+func (p *PipelineImpl) writeToStages(sink Sink, upstream []*AbstractStage) SinkStage {
+	sinkImpl, ok := sink.(*SinkImpl)
+	if !ok {
+		panic(fmt.Sprintf("unsupported sink %s", sink.name()))
+	}
+	if sinkImpl.isAssignedToStage {
+		panic(fmt.Sprintf("sink %s was already written to, create a new sink for every stage", sink.name()))
+	}
+	sinkImpl.isAssignedToStage = true
+	transforms := make([]Transform, len(upstream))
+	for i, stage := range upstream {
+		transforms[i] = stage.transform
+	}
+	transform := NewSinkTransform(sinkImpl, transforms)
+	for ordinal, stage := range upstream {
+		transform.timestampedInput[ordinal] = stage.fnAdapter.isTimestamped()
+	}
+	p.connect(upstream, transform)
+	return NewSinkStageImpl(NewAbstractStage(transform, p, DO_NOT_ADAPT))
 }
 
-func (p PipelineImpl) setPreserveOrder(value bool) Pipeline {
-	panic("implement me")
+func (p *PipelineImpl) isEmpty() bool {
+	return len(p.transforms) == 0
 }
 
-func (p PipelineImpl) readFromBatchSource(source BatchSource) BatchStage {
-	panic("implement me")
+func (p *PipelineImpl) toDag() *DAG {
+	return NewPlanner(p).createDag()
 }
 
-func (p PipelineImpl) readFromStreamSource(source StreamSource) StreamSourceStage {
-	panic("implement me")
+// register adds a transform to the pipeline, initially nothing is attached to its output
+func (p *PipelineImpl) register(transform Transform) {
+	if _, ok := p.adjacencyMap[transform]; ok {
+		return
+	}
+	p.adjacencyMap[transform] = []Transform{}
+	p.transforms = append(p.transforms, transform)
 }
 
-func (p PipelineImpl) writeTo(sink Sink, stages ...GeneralStage) SinkStage {
-	panic("implement me")
+// connect registers the downstream transform and attaches it to the output of each upstream stage,
+// the input at ordinal i is rebalanced if the i-th stage was returned by rebalance
+func (p *PipelineImpl) connect(upstream []*AbstractStage, downstream Transform) {
+	for ordinal, stage := range upstream {
+		if stage.pipeline != p {
+			panic(fmt.Sprintf("stage %s belongs to a different pipeline", stage.name()))
+		}
+		if stage.rebalanceOutput {
+			downstream.setRebalanceInput(ordinal, true)
+		}
+		p.adjacencyMap[stage.transform] = append(p.adjacencyMap[stage.transform], downstream)
+	}
+	p.register(downstream)
 }
 
-func (p PipelineImpl) isEmpty() bool {
-	panic("implement me")
+// downstream returns the transforms attached to the output of the given one
+func (p *PipelineImpl) downstream(transform Transform) []Transform {
+	return p.adjacencyMap[transform]
 }
 
+// DEFAULT_WATERMARK_STRIDE the watermark stride used when no transform prefers one, it doesn't throttle the watermarks
+const DEFAULT_WATERMARK_STRIDE int64 = 1
+
+// Planner turns the transforms of a pipeline into the vertices and edges of a DAG
 type Planner struct {
-	xform2vertex map[Transform]PlannerVertex
-	pipeline     Pipeline
+	dag          *DAG
+	xform2vertex map[Transform]*PlannerVertex
+	pipeline     *PipelineImpl
+	// watermarkStride the throttling frame of the inserted watermarks, the greatest common divisor of the strides the transforms prefer
+	watermarkStride int64
 }
 
-func NewPlanner(pipeline Pipeline) *Planner {
+func NewPlanner(pipeline *PipelineImpl) *Planner {
 	return &Planner{
-		xform2vertex: make(map[Transform]PlannerVertex),
+		dag:          NewDAG(),
+		xform2vertex: make(map[Transform]*PlannerVertex),
 		pipeline:     pipeline,
 	}
 }
 
-func (p *Planner) addEdges(transform Transform, vertex Vertex, edgeFn ApplyFn) {
-	//var destOrdinal int
-	//for _, fromTransform := range transform.getUpstream() {
-	//	fromPv := p.xform2vertex[fromTransform]
-	//	edge :=
-	//}
+// createDag adds the transforms to the DAG in the order they were added to the pipeline, so the vertices of the upstream
+// transforms exist by the time the edges to them are added
+func (p *Planner) createDag() *DAG {
+	p.watermarkStride = 0
+	for _, transform := range p.pipeline.transforms {
+		if stride := transform.preferredWatermarkStride(); stride > 0 {
+			p.watermarkStride = Gcd(p.watermarkStride, stride)
+		}
+	}
+	if p.watermarkStride == 0 {
+		p.watermarkStride = DEFAULT_WATERMARK_STRIDE
+	}
+	transforms := p.pipeline.transforms
+	if p.pipeline.isFuseStatelessStages() {
+		transforms = p.fuseStatelessTransforms(transforms)
+	}
+	for _, transform := range transforms {
+		transform.addToDag(p)
+	}
+	return p.dag
+}
+
+// fuseStatelessTransforms replaces each chain of stateless transforms that can be fused by a FusedTransform,
+// at the position of the first transform of the chain
+func (p *Planner) fuseStatelessTransforms(transforms []Transform) []Transform {
+	fused := make(map[Transform]bool)
+	var result []Transform
+	for _, transform := range transforms {
+		if fused[transform] {
+			continue
+		}
+		chain := p.statelessChain(transform)
+		if len(chain) < 2 {
+			result = append(result, transform)
+			continue
+		}
+		for _, t := range chain {
+			fused[t] = true
+		}
+		result = append(result, NewFusedTransform(chain))
+	}
+	return result
+}
+
+// statelessChain returns the longest chain of stateless transforms starting with the given one, where each transform
+// is the only one attached to the previous, its input isn't rebalanced and its local parallelism is compatible
+func (p *Planner) statelessChain(first Transform) []Transform {
+	if statelessFlatMapFn(first) == nil {
+		return nil
+	}
+	chain := []Transform{first}
+	localParallelism := first.getLocalParallelism()
+	for {
+		downstream := p.pipeline.downstream(chain[len(chain)-1])
+		if len(downstream) != 1 {
+			return chain
+		}
+		next := downstream[0]
+		if statelessFlatMapFn(next) == nil || next.shouldRebalanceInput(0) || next.partitionKeyFnForInput(0) != nil {
+			return chain
+		}
+		if nextParallelism := next.getLocalParallelism(); nextParallelism != LOCAL_PARALLELISM_USE_DEFAULT {
+			if localParallelism != LOCAL_PARALLELISM_USE_DEFAULT && localParallelism != nextParallelism {
+				return chain
+			}
+			localParallelism = nextParallelism
+		}
+		chain = append(chain, next)
+	}
+}
+
+// addVertex adds the vertex of the transform with the determined local parallelism, the edges to it are added by addEdges
+func (p *Planner) addVertex(transform Transform, name string, metaSupplier ProcessorMetaSupplier) *PlannerVertex {
+	transform.setDeterminedLocalParallelism(p.determineLocalParallelism(transform, metaSupplier))
+	pv := NewPlannerVertex(p.dag.vertex(NewVertexFromMetaSupplier(p.dag.uniqueName(name), metaSupplier)).
+		setLocalParallelism(transform.getDeterminedLocalParallelism()))
+	p.xform2vertex[transform] = pv
+	return pv
+}
+
+// addVertexFromGetFn adds the vertex of the transform whose processors are created by getFn
+func (p *Planner) addVertexFromGetFn(transform Transform, name string, getFn GetFn) *PlannerVertex {
+	return p.addVertex(transform, name, NewMetaSupplierFromProcessorSupplier(LOCAL_PARALLELISM_USE_DEFAULT, NewProcessorSupplierFromGetFn(getFn)))
+}
+
+// determineLocalParallelism the local parallelism set on the stage, otherwise the one of the single upstream transform if
+// the pipeline preserves order, otherwise the one the meta-supplier prefers
+func (p *Planner) determineLocalParallelism(transform Transform, metaSupplier ProcessorMetaSupplier) int {
+	if localParallelism := transform.getLocalParallelism(); localParallelism != LOCAL_PARALLELISM_USE_DEFAULT {
+		return localParallelism
+	}
+	if upstream := transform.getUpstream(); p.pipeline.isPreserveOrder() && len(upstream) == 1 {
+		return upstream[0].getDeterminedLocalParallelism()
+	}
+	return metaSupplier.getPreferredLocalParallelism()
+}
+
+// addEdges connects the vertices of the upstream transforms to the vertex, the input at ordinal i comes from the i-th
+// upstream transform. a rebalanced input is distributed, a keyed input is partitioned and the other inputs are isolated
+// if the pipeline preserves order. configureEdgeFn, if not nil, adjusts the edge further
+func (p *Planner) addEdges(transform Transform, vertex *Vertex, configureEdgeFn func(edge *Edge, ordinal int)) {
+	p.addEdgesFrom(transform, vertex, func(ordinal int, fromTransform Transform) *PlannerVertex {
+		return p.xform2vertex[fromTransform]
+	}, configureEdgeFn)
+}
+
+// addEdgesFrom is addEdges with the vertices of the inputs supplied by fromVertexFn
+func (p *Planner) addEdgesFrom(transform Transform, vertex *Vertex, fromVertexFn func(ordinal int, fromTransform Transform) *PlannerVertex, configureEdgeFn func(edge *Edge, ordinal int)) {
+	for ordinal, fromTransform := range transform.getUpstream() {
+		fromPv := fromVertexFn(ordinal, fromTransform)
+		edge := From(fromPv.v, fromPv.nextAvailableOrdinal()).To(vertex, ordinal)
+		rebalance := transform.shouldRebalanceInput(ordinal)
+		if rebalance {
+			edge.distributed()
+		}
+		if keyFn := transform.partitionKeyFnForInput(ordinal); keyFn != nil {
+			edge.partitionedByKey(keyFn)
+		} else if !rebalance && p.pipeline.isPreserveOrder() {
+			edge.isolated()
+		}
+		if configureEdgeFn != nil {
+			configureEdgeFn(edge, ordinal)
+		}
+		p.dag.edge(edge)
+	}
+}
+
+// withWatermarkStride returns the policy throttling the watermarks to the stride of the pipeline, unless it has its own frame
+func (p *Planner) withWatermarkStride(policy EventTimePolicy) EventTimePolicy {
+	if policy.watermarkThrottlingFrameSize == 0 {
+		policy.watermarkThrottlingFrameSize = p.watermarkStride
+	}
+	return policy
 }
 
 type PlannerVertex struct {
-	v                Vertex
+	v                *Vertex
 	availableOrdinal int
 }
 
-func NewPlannerVertex(v Vertex) *PlannerVertex {
+func NewPlannerVertex(v *Vertex) *PlannerVertex {
 	return &PlannerVertex{
 		v: v,
 	}
 }
 
+// nextAvailableOrdinal returns the first outbound ordinal of the vertex no edge was added at, and reserves it
 func (v *PlannerVertex) nextAvailableOrdinal() int {
+	ordinal := v.availableOrdinal
 	v.availableOrdinal++
-	return v.availableOrdinal
+	return ordinal
 }
@@ -0,0 +1,632 @@
+package stream_processing
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type PipelineTest struct {
+	p       *PipelineImpl
+	service *ExecutionService
+	mu      sync.Mutex
+	sunk    []interface{}
+}
+
+func PipelineTestSetup(tb testing.TB) (func(tb testing.TB), *PipelineTest) {
+	pt := &PipelineTest{}
+	pt.p = NewPipelineImpl()
+	pt.service = NewExecutionService(NewInstanceConfig().setCooperativeThreadCount(2))
+
+	return func(tb testing.TB) {
+		pt.service.shutdown()
+		tb.Log("PipelineTestSetup teardown")
+	}, pt
+}
+
+// collectingSink a sink that records the received items in sunk
+func (pt *PipelineTest) collectingSink() Sink {
+	return NewSinks().writeFn("collect", func(t interface{}) {
+		pt.mu.Lock()
+		defer pt.mu.Unlock()
+		pt.sunk = append(pt.sunk, t)
+	})
+}
+
+// edge returns the only edge between the vertices with the given names
+func (pt *PipelineTest) edge(tb testing.TB, dag *DAG, source, destination string) *Edge {
+	var found *Edge
+	for _, e := range dag.getOutboundEdges(source) {
+		if edge := e.(*Edge); edge.destName == destination {
+			assert.Nil(tb, found)
+			found = edge
+		}
+	}
+	assert.NotNil(tb, found)
+	return found
+}
+
+func (pt *PipelineTest) streamSource(name string) StreamSource {
+	return NewSources().streamFromProcessor(name, NewMetaSupplierFromProcessorSupplier(1, NewProcessorSupplierFromGetFn(func() interface{} {
+		return NewNoopP()
+	})))
+}
+
+func (pt *PipelineTest) sink() Sink {
+	return NewSinks().writeFn("sink", func(t interface{}) {})
+}
+
+func TestPipelineImpl_when_created_then_empty(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	assert.True(t, pt.p.isEmpty())
+	assert.False(t, pt.p.isPreserveOrder())
+	assert.Same(t, pt.p, pt.p.setPreserveOrder(true))
+	assert.True(t, pt.p.isPreserveOrder())
+	assert.True(t, pt.p.create().isEmpty())
+
+	pt.p.readFromBatchSource(NewSources().items(1, 2))
+	assert.False(t, pt.p.isEmpty())
+}
+
+func TestPipelineImpl_when_stagesAttached_then_transformsInAdjacencyMap(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	source := pt.p.readFromBatchSource(NewSources().items(1, 2, 3))
+	mapped := source.mapX(func(t interface{}) interface{} {
+		return t.(int) * 2
+	})
+	mapped.setName("double")
+	mapped.setLocalParallelism(3)
+	sinkStage := mapped.writeTo(pt.sink())
+
+	sourceTransform := abstractStageOf(source).transform
+	mapTransform := abstractStageOf(mapped).transform
+	sinkTransform := abstractStageOf(sinkStage).transform
+	assert.Equal(t, []Transform{sourceTransform, mapTransform, sinkTransform}, pt.p.transforms)
+	assert.Equal(t, []Transform{mapTransform}, pt.p.downstream(sourceTransform))
+	assert.Equal(t, []Transform{sinkTransform}, pt.p.downstream(mapTransform))
+	assert.Empty(t, pt.p.downstream(sinkTransform))
+	assert.Equal(t, []Transform{sourceTransform}, mapTransform.getUpstream())
+	assert.Equal(t, "double", mapTransform.getName())
+	assert.Equal(t, 3, mapTransform.getLocalParallelism())
+	assert.Equal(t, "sink", sinkStage.name())
+	assert.Equal(t, 2, mapTransform.(*MapTransform).mapFn(1))
+}
+
+func TestPipelineImpl_when_stageFannedOut_then_allDownstreamTransformsAttached(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	source := pt.p.readFromBatchSource(NewSources().items("a", "b"))
+	filtered := source.filter(func(t interface{}) bool {
+		return t == "a"
+	})
+	flatMapped := source.rebalance().flatMap(func(t interface{}) interface{} {
+		return NewAppendableTraverser().append(t).append(t)
+	})
+	source.writeTo(pt.sink())
+
+	sourceTransform := abstractStageOf(source).transform
+	downstream := pt.p.downstream(sourceTransform)
+	assert.Len(t, downstream, 3)
+	assert.Same(t, abstractStageOf(filtered).transform, downstream[0])
+	assert.Same(t, abstractStageOf(flatMapped).transform, downstream[1])
+	assert.False(t, downstream[0].shouldRebalanceInput(0))
+	assert.True(t, downstream[1].shouldRebalanceInput(0))
+	assert.Nil(t, downstream[0].(*MapTransform).mapFn("b"))
+	assert.IsType(t, &SinkTransform{}, downstream[2])
+}
+
+func TestPipelineImpl_when_writeToMultipleStages_then_sinkHasAllUpstreams(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	first := pt.p.readFromStreamSource(pt.streamSource("first")).withoutTimestamps()
+	second := pt.p.readFromStreamSource(pt.streamSource("second")).withTimestamps(func(t interface{}) int64 {
+		return 0
+	}, 10)
+	sinkStage := pt.p.writeTo(pt.sink(), first, second.rebalance())
+
+	sinkTransform := abstractStageOf(sinkStage).transform
+	assert.Equal(t, []Transform{abstractStageOf(first).transform, abstractStageOf(second).transform}, sinkTransform.getUpstream())
+	assert.False(t, sinkTransform.shouldRebalanceInput(0))
+	assert.True(t, sinkTransform.shouldRebalanceInput(1))
+	assert.Nil(t, abstractStageOf(first).transform.(*StreamSourceTransform).getEventTimePolicy())
+	policy := abstractStageOf(second).transform.(*StreamSourceTransform).getEventTimePolicy()
+	assert.Equal(t, DEFAULT_PARTITION_IDLE_TIMEOUT, policy.idleTimeoutMillis)
+}
+
+func TestPipelineImpl_when_streamStagesMerged_then_mergeTransformHasBothUpstreams(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	first := pt.p.readFromStreamSource(pt.streamSource("first")).withIngestionTimestamps()
+	second := pt.p.readFromBatchSource(NewSources().items(1)).addTimestamps(func(t interface{}) int64 {
+		return int64(t.(int))
+	}, 0)
+	merged := first.merge(second)
+
+	mergeTransform := abstractStageOf(merged).transform
+	assert.IsType(t, &MergeTransform{}, mergeTransform)
+	assert.Equal(t, []Transform{abstractStageOf(first).transform, abstractStageOf(second).transform}, mergeTransform.getUpstream())
+	assert.IsType(t, &TimestampTransform{}, abstractStageOf(second).transform)
+}
+
+func TestPipelineImpl_when_sourceOrSinkReused_then_panics(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	source := NewSources().items(1)
+	sink := pt.sink()
+	stage := pt.p.readFromBatchSource(source)
+	stage.writeTo(sink)
+
+	assert.Panics(t, func() {
+		pt.p.readFromBatchSource(source)
+	})
+	assert.Panics(t, func() {
+		stage.writeTo(sink)
+	})
+	assert.Panics(t, func() {
+		pt.p.writeTo(pt.sink())
+	})
+	assert.Panics(t, func() {
+		NewPipelineImpl().writeTo(pt.sink(), stage)
+	})
+	assert.Panics(t, func() {
+		pt.p.readFromStreamSource(pt.streamSource("stream")).withNativeTimestamps(0)
+	})
+}
+
+func TestTypedBatchStage_when_overPipelineStage_then_typedStagesReturned(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	source := NewTypedBatchStage[string](pt.p.readFromBatchSource(NewSources().items("a", "bb")))
+	lengths := mapBatch(source.filter(func(s string) bool {
+		return s != ""
+	}), func(s string) int {
+		return len(s)
+	})
+	lengths.writeTo(pt.sink())
+
+	assert.Len(t, pt.p.transforms, 4)
+	assert.Equal(t, 2, abstractStageOf(lengths.untyped()).transform.(*MapTransform).mapFn("bb"))
+}
+
+func TestPlanner_when_pipelinePlanned_then_vertexPerTransform(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	source := pt.p.readFromBatchSource(NewSources().items(1, 2))
+	mapped := source.mapX(func(t interface{}) interface{} {
+		return t
+	})
+	mapped.setLocalParallelism(3)
+	mapped.filter(func(t interface{}) bool {
+		return true
+	}).writeTo(pt.sink())
+	source.writeTo(NewSinks().writeFn("sink", func(t interface{}) {}))
+
+	dag := pt.p.toDag()
+	var names []string
+	for _, v := range dag.iterator() {
+		names = append(names, v.name)
+	}
+	assert.ElementsMatch(t, []string{"items", "map", "filter", "sink", "sink-2"}, names)
+	assert.Equal(t, 1, dag.getVertex("items").localParallelism)
+	assert.Equal(t, 3, dag.getVertex("map").localParallelism)
+	assert.Equal(t, LOCAL_PARALLELISM_USE_DEFAULT, dag.getVertex("filter").localParallelism)
+
+	// the source is fanned out at the next available ordinals
+	assert.Equal(t, 0, pt.edge(t, dag, "items", "map").sourceOrdinal)
+	assert.Equal(t, 1, pt.edge(t, dag, "items", "sink-2").sourceOrdinal)
+	toSink := pt.edge(t, dag, "filter", "sink")
+	assert.Equal(t, UNICAST, toSink.routingPolicy)
+	assert.False(t, toSink.isDistributed)
+}
+
+func TestPlanner_when_inputRebalancedOrPartitioned_then_distributedEdge(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	source := pt.p.readFromBatchSource(NewSources().items(1, 2))
+	mapped := source.rebalance().mapX(func(t interface{}) interface{} {
+		return t
+	})
+	abstractStageOf(mapped).transform.setPartitionKeyFnForInput(0, func(t interface{}) interface{} {
+		return t
+	})
+	mapped.writeTo(pt.sink())
+
+	dag := pt.p.toDag()
+	rebalanced := pt.edge(t, dag, "items", "map")
+	assert.True(t, rebalanced.isDistributed)
+	assert.Equal(t, PARTITIONED, rebalanced.routingPolicy)
+	assert.False(t, pt.edge(t, dag, "map", "sink").isDistributed)
+}
+
+func TestPlanner_when_preserveOrder_then_isolatedEdgesAndUpstreamParallelism(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	pt.p.setPreserveOrder(true)
+	source := pt.p.readFromBatchSource(NewSources().items(1, 2))
+	source.setLocalParallelism(2)
+	source.mapX(func(t interface{}) interface{} {
+		return t
+	}).writeTo(pt.sink())
+
+	dag := pt.p.toDag()
+	assert.Equal(t, 2, dag.getVertex("map").localParallelism)
+	assert.Equal(t, 2, dag.getVertex("sink").localParallelism)
+	assert.Equal(t, ISOLATED, pt.edge(t, dag, "items", "map").routingPolicy)
+	assert.Equal(t, ISOLATED, pt.edge(t, dag, "map", "sink").routingPolicy)
+}
+
+func TestPipelineImpl_when_executed_then_itemsTransformedIntoSink(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	source := pt.p.readFromBatchSource(NewSources().items("a b", "", "c d e"))
+	words := source.filter(func(t interface{}) bool {
+		return t != ""
+	}).flatMap(func(t interface{}) interface{} {
+		traverser := NewAppendableTraverser()
+		for _, word := range strings.Fields(t.(string)) {
+			traverser.append(word)
+		}
+		return traverser
+	}).rebalance().mapX(func(t interface{}) interface{} {
+		return strings.ToUpper(t.(string))
+	})
+	words.peek(nil, nil).writeTo(pt.collectingSink())
+
+	assert.NoError(t, pt.service.executePipeline(context.Background(), pt.p))
+	assert.ElementsMatch(t, []interface{}{"A", "B", "C", "D", "E"}, pt.sunk)
+}
+
+func TestPipelineImpl_when_streamWithTimestamps_then_watermarksInserted(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	var wms []int64
+	source := NewSources().streamFromProcessor("events", NewMetaSupplierFromProcessorSupplier(1, NewProcessorSupplierFromGetFn(func() interface{} {
+		return NewListSourceP([]interface{}{int64(10), int64(25), int64(20), int64(40)})
+	})))
+	stage := pt.p.readFromStreamSource(source).withTimestamps(func(t interface{}) int64 {
+		return t.(int64)
+	}, 5)
+	stage.writeTo(NewSinks().fromProcessor("wms", NewMetaSupplierFromProcessorSupplier(1, NewProcessorSupplierFromGetFn(func() interface{} {
+		return &watermarkRecordingP{NoopP: NewNoopP(), wms: &wms}
+	}))))
+
+	dag := pt.p.toDag()
+	assert.NotNil(t, dag.getVertex("events-add-timestamps"))
+	assert.Equal(t, ISOLATED, pt.edge(t, dag, "events", "events-add-timestamps").routingPolicy)
+	assert.NoError(t, pt.service.executePipeline(context.Background(), pt.p))
+	assert.Equal(t, []int64{5, 20, 35}, wms)
+}
+
+func (pt *PipelineTest) vertexNames(dag *DAG) []string {
+	var names []string
+	for _, v := range dag.iterator() {
+		names = append(names, v.name)
+	}
+	return names
+}
+
+func TestPlanner_when_statelessStagesFused_then_singleVertexWithSameResult(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	pt.p.setFuseStatelessStages(true)
+	pt.p.readFromBatchSource(NewSources().items(1, 2, 3, 4)).mapX(func(t interface{}) interface{} {
+		return t.(int) * 10
+	}).filter(func(t interface{}) bool {
+		return t != 20
+	}).flatMap(func(t interface{}) interface{} {
+		return NewAppendableTraverser().append(t).append(t.(int) + 1)
+	}).mapX(func(t interface{}) interface{} {
+		if t == 31 {
+			return nil
+		}
+		return t
+	}).writeTo(pt.collectingSink())
+
+	dag := pt.p.toDag()
+	assert.ElementsMatch(t, []string{"items", "fused(map, filter, flat-map, map)", "collect"}, pt.vertexNames(dag))
+	pt.edge(t, dag, "fused(map, filter, flat-map, map)", "collect")
+	assert.NoError(t, pt.service.executePipeline(context.Background(), pt.p))
+	assert.ElementsMatch(t, []interface{}{10, 11, 30, 40, 41}, pt.sunk)
+}
+
+func TestPlanner_when_rebalancedOrParallelismDiffers_then_chainSplit(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	identity := func(t interface{}) interface{} {
+		return t
+	}
+	pt.p.setFuseStatelessStages(true)
+	source := pt.p.readFromBatchSource(NewSources().items(1))
+	first := source.mapX(identity)
+	first.setLocalParallelism(2)
+	second := first.mapX(identity)
+	second.setName("second")
+	third := second.mapX(identity)
+	third.setName("third")
+	third.setLocalParallelism(3)
+	fourth := third.rebalance().mapX(identity)
+	fourth.setName("fourth")
+	fourth.writeTo(pt.sink())
+	fourth.mapX(identity).writeTo(NewSinks().writeFn("other", func(t interface{}) {}))
+
+	dag := pt.p.toDag()
+	assert.ElementsMatch(t, []string{"items", "fused(map, second)", "third", "fourth", "map", "sink", "other"}, pt.vertexNames(dag))
+	assert.Equal(t, 2, dag.getVertex("fused(map, second)").localParallelism)
+	assert.True(t, pt.edge(t, dag, "third", "fourth").isDistributed)
+}
+
+func TestPlanner_when_aggregateCanCombine_then_twoStages(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	keyFn := func(t interface{}) interface{} {
+		return t
+	}
+	source := pt.p.readFromBatchSource(NewSources().items("a", "b", "a"))
+	source.groupingKey(keyFn).aggregate(counting()).writeTo(pt.sink())
+	withoutCombine := NewAggregateOperation1Impl(func() interface{} {
+		return NewLongAccumulator()
+	}, func(acc, item interface{}) {
+		acc.(*LongAccumulator).addAllowingOverflow(1)
+	}, nil, nil, nil, func(acc interface{}) interface{} {
+		return acc.(*LongAccumulator).get()
+	})
+	source.groupingKey(keyFn).aggregate(withoutCombine).writeTo(NewSinks().writeFn("other", func(t interface{}) {}))
+
+	dag := pt.p.toDag()
+	assert.ElementsMatch(t, []string{"items", "group-and-aggregate-prepare", "group-and-aggregate", "sink", "group-and-aggregate-2", "other"}, pt.vertexNames(dag))
+	prepare := pt.edge(t, dag, "items", "group-and-aggregate-prepare")
+	assert.Equal(t, PARTITIONED, prepare.routingPolicy)
+	assert.False(t, prepare.isDistributed)
+	combine := pt.edge(t, dag, "group-and-aggregate-prepare", "group-and-aggregate")
+	assert.Equal(t, PARTITIONED, combine.routingPolicy)
+	assert.True(t, combine.isDistributed)
+	pt.edge(t, dag, "group-and-aggregate", "sink")
+	single := pt.edge(t, dag, "items", "group-and-aggregate-2")
+	assert.Equal(t, PARTITIONED, single.routingPolicy)
+	assert.True(t, single.isDistributed)
+	pt.edge(t, dag, "group-and-aggregate-2", "other")
+}
+
+func TestPipelineImpl_when_slidingWindowAggregated_then_keyedWindowResultsSunk(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	source := NewSources().streamFromProcessor("events", NewMetaSupplierFromProcessorSupplier(1, NewProcessorSupplierFromGetFn(func() interface{} {
+		return NewListSourceP([]interface{}{int64(0), int64(1), int64(2), int64(3), int64(6), int64(9)})
+	})))
+	pt.p.readFromStreamSource(source).withTimestamps(func(t interface{}) int64 {
+		return t.(int64)
+	}, 0).mapX(func(t interface{}) interface{} {
+		return t.(int64) * 10
+	}).(StreamStage).window(NewSlidingWindowDefinition(4, 2)).groupingKey(func(t interface{}) interface{} {
+		return "all"
+	}).aggregate(counting()).writeTo(pt.collectingSink())
+
+	dag := pt.p.toDag()
+	windowEdge := pt.edge(t, dag, "map", "window-group-and-aggregate")
+	assert.True(t, windowEdge.isDistributed)
+	assert.Equal(t, PARTITIONED, windowEdge.routingPolicy)
+	assert.NotNil(t, dag.getVertex("collect-remove-timestamps"))
+	assert.NoError(t, pt.service.executePipeline(context.Background(), pt.p))
+	assert.ElementsMatch(t, []interface{}{
+		NewKeyedWindowResult(-2, 2, "all", int64(2), false), NewKeyedWindowResult(0, 4, "all", int64(4), false),
+		NewKeyedWindowResult(2, 6, "all", int64(2), false), NewKeyedWindowResult(4, 8, "all", int64(1), false),
+		NewKeyedWindowResult(6, 10, "all", int64(2), false), NewKeyedWindowResult(8, 12, "all", int64(1), false),
+	}, pt.sunk)
+}
+
+func TestPipelineImpl_when_sessionWindowAggregated_then_sessionsSunk(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	source := NewSources().streamFromProcessor("events", NewMetaSupplierFromProcessorSupplier(1, NewProcessorSupplierFromGetFn(func() interface{} {
+		return NewListSourceP([]interface{}{int64(0), int64(2), int64(1), int64(10), int64(11)})
+	})))
+	pt.p.readFromStreamSource(source).withTimestamps(func(t interface{}) int64 {
+		return t.(int64)
+	}, 1).window(NewSessionWindowDefinition(3)).groupingKey(func(t interface{}) interface{} {
+		return "all"
+	}).aggregate(counting()).writeTo(pt.collectingSink())
+
+	assert.NoError(t, pt.service.executePipeline(context.Background(), pt.p))
+	assert.ElementsMatch(t, []interface{}{
+		NewKeyedWindowResult(0, 5, "all", int64(3), false), NewKeyedWindowResult(10, 14, "all", int64(2), false),
+	}, pt.sunk)
+}
+
+func TestPipelineImpl_when_itemLaterThanAllowedLateness_then_sunkFromLateEventsStage(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	var mu sync.Mutex
+	var late []interface{}
+	source := NewSources().streamFromProcessor("events", NewMetaSupplierFromProcessorSupplier(1, NewProcessorSupplierFromGetFn(func() interface{} {
+		return NewListSourceP([]interface{}{int64(0), int64(10), int64(1), int64(11)})
+	})))
+	results, lateEvents := pt.p.readFromStreamSource(source).withTimestamps(func(t interface{}) int64 {
+		return t.(int64)
+	}, 0).window(NewTumblingWindowDefinition(5)).groupingKey(func(t interface{}) interface{} {
+		return "all"
+	}).aggregateWithLateEvents(counting())
+	results.writeTo(pt.collectingSink())
+	lateEvents.writeTo(NewSinks().writeFn("late", func(t interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		late = append(late, t)
+	}))
+
+	dag := pt.p.toDag()
+	assert.Equal(t, 0, pt.edge(t, dag, "window-group-and-aggregate", "window-group-and-aggregate-late-events").sourceOrdinal)
+	assert.NotNil(t, dag.getVertex("late-remove-timestamps"))
+	assert.NoError(t, pt.service.executePipeline(context.Background(), pt.p))
+	assert.ElementsMatch(t, []interface{}{
+		NewKeyedWindowResult(0, 5, "all", int64(1), false), NewKeyedWindowResult(10, 15, "all", int64(2), false),
+	}, pt.sunk)
+	assert.Equal(t, []interface{}{int64(1)}, late)
+}
+
+func TestPipelineImpl_when_statefulStagesAttached_then_stateKeptPerKey(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	source := pt.p.setPreserveOrder(true).readFromBatchSource(NewSources().items("b", "a", "b", "c", "a", "b"))
+	source.mapStateful(func() interface{} {
+		return NewLongAccumulator()
+	}, func(state, item interface{}) interface{} {
+		state.(*LongAccumulator).addAllowingOverflow(1)
+		return state.(*LongAccumulator).get()
+	}).(BatchStage).sort().writeTo(pt.collectingSink())
+	var mu sync.Mutex
+	var counts, distinct []interface{}
+	source.groupingKey(func(t interface{}) interface{} {
+		return t
+	}).mapStateful(func() interface{} {
+		return NewLongAccumulator()
+	}, func(state, key, item interface{}) interface{} {
+		state.(*LongAccumulator).addAllowingOverflow(1)
+		return NewTuple2(key, state.(*LongAccumulator).get())
+	}).writeTo(NewSinks().writeFn("counts", func(t interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		counts = append(counts, t)
+	}))
+	source.groupingKey(func(t interface{}) interface{} {
+		return t
+	}).(*BatchStageWithKeyImpl).attachDistinct().writeTo(NewSinks().writeFn("distinct", func(t interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		distinct = append(distinct, t)
+	}))
+
+	dag := pt.p.toDag()
+	assert.Equal(t, 1, dag.getVertex("map-stateful").localParallelism)
+	keyed := pt.edge(t, dag, "items", "map-stateful-2")
+	assert.Equal(t, PARTITIONED, keyed.routingPolicy)
+	assert.True(t, keyed.isDistributed)
+	assert.True(t, pt.edge(t, dag, "map-stateful", "sort").isDistributed)
+	assert.NoError(t, pt.service.executePipeline(context.Background(), pt.p))
+	assert.Equal(t, []interface{}{int64(1), int64(2), int64(3), int64(4), int64(5), int64(6)}, pt.sunk)
+	assert.ElementsMatch(t, []interface{}{
+		NewTuple2("a", int64(1)), NewTuple2("a", int64(2)), NewTuple2("b", int64(1)), NewTuple2("b", int64(2)),
+		NewTuple2("b", int64(3)), NewTuple2("c", int64(1)),
+	}, counts)
+	assert.ElementsMatch(t, []interface{}{"a", "b", "c"}, distinct)
+}
+
+func TestPipelineImpl_when_streamGroupedByKey_then_statefulAndWindowedStagesKeepTimestamps(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	source := NewSources().streamFromProcessor("events", NewMetaSupplierFromProcessorSupplier(1, NewProcessorSupplierFromGetFn(func() interface{} {
+		return NewListSourceP([]interface{}{int64(0), int64(1), int64(2), int64(5), int64(6)})
+	})))
+	keyFn := func(t interface{}) interface{} {
+		return t.(int64) % 2
+	}
+	events := pt.p.readFromStreamSource(source).withTimestamps(func(t interface{}) int64 {
+		return t.(int64)
+	}, 0)
+	events.groupingKey(keyFn).filterStateful(func() interface{} {
+		return NewLongAccumulator()
+	}, func(state, item interface{}) bool {
+		state.(*LongAccumulator).addAllowingOverflow(1)
+		return state.(*LongAccumulator).get() > 1
+	}).(StreamStage).groupingKey(keyFn).window(NewTumblingWindowDefinition(4)).aggregate(counting()).writeTo(pt.collectingSink())
+
+	assert.NoError(t, pt.service.executePipeline(context.Background(), pt.p))
+	assert.ElementsMatch(t, []interface{}{
+		NewKeyedWindowResult(0, 4, int64(0), int64(1), false), NewKeyedWindowResult(4, 8, int64(0), int64(1), false),
+		NewKeyedWindowResult(4, 8, int64(1), int64(1), false),
+	}, pt.sunk)
+}
+
+func TestPipelineImpl_when_keyedCustomTransform_then_itemsPartitionedAcrossCluster(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	pt.p.readFromBatchSource(NewSources().items(1, 2, 3)).groupingKey(func(t interface{}) interface{} {
+		return t
+	}).customTransform("custom", func() interface{} {
+		return NewMapP(func(t interface{}) interface{} {
+			return t
+		})
+	}).writeTo(pt.collectingSink())
+
+	edge := pt.edge(t, pt.p.toDag(), "items", "custom")
+	assert.Equal(t, PARTITIONED, edge.routingPolicy)
+	assert.True(t, edge.isDistributed)
+	assert.NoError(t, pt.service.executePipeline(context.Background(), pt.p))
+	assert.ElementsMatch(t, []interface{}{1, 2, 3}, pt.sunk)
+}
+
+func TestPipelineImpl_when_serviceStagesAttached_then_eachProcessorUsesItsOwnService(t *testing.T) {
+	teardownTest, pt := PipelineTestSetup(t)
+	defer teardownTest(t)
+
+	var mu sync.Mutex
+	created, destroyed := 0, 0
+	serviceFactory := NewServiceFactory(func() interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		created++
+		return strings.ToUpper
+	}, func(service interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		destroyed++
+	})
+	var keyed []interface{}
+	source := pt.p.readFromBatchSource(NewSources().items("a b", "c", "d e f"))
+	words := source.flatMapUsingService(serviceFactory, func(service, item interface{}) interface{} {
+		traverser := NewAppendableTraverser()
+		for _, word := range strings.Fields(item.(string)) {
+			traverser.append(service.(func(string) string)(word))
+		}
+		return traverser
+	}).filterUsingService(serviceFactory, func(service, item interface{}) bool {
+		return item != "C"
+	})
+	words.mapUsingServiceAsync(serviceFactory, 2, true, func(service, item interface{}) interface{} {
+		return item.(string) + "!"
+	}).writeTo(pt.collectingSink())
+	words.(BatchStage).groupingKey(func(t interface{}) interface{} {
+		return t
+	}).mapUsingService(serviceFactory, func(service, key, item interface{}) interface{} {
+		return NewTuple2(key, service.(func(string) string)(item.(string)))
+	}).writeTo(NewSinks().writeFn("keyed", func(t interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		keyed = append(keyed, t)
+	}))
+
+	edge := pt.edge(t, pt.p.toDag(), "filter-using-service", "map-using-service")
+	assert.Equal(t, PARTITIONED, edge.routingPolicy)
+	assert.True(t, edge.isDistributed)
+	assert.NoError(t, pt.service.executePipeline(context.Background(), pt.p))
+	assert.ElementsMatch(t, []interface{}{"A!", "B!", "D!", "E!", "F!"}, pt.sunk)
+	assert.ElementsMatch(t, []interface{}{
+		NewTuple2("A", "A"), NewTuple2("B", "B"), NewTuple2("D", "D"), NewTuple2("E", "E"), NewTuple2("F", "F"),
+	}, keyed)
+	assert.Positive(t, created)
+	assert.Equal(t, created, destroyed)
+}
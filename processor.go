@@ -2,6 +2,11 @@ package stream_processing
 
 import (
 	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/emirpasic/gods/utils"
 )
 
 // Processor when execute a Dag, it creates one or more instance of Processor on each cluster member to do the work of a given vertex.
@@ -27,17 +32,75 @@ type Processor interface {
 
 	// complete called after all the inbound edges' streams are exhausted. if it returns false, it will be invoked again until it return true
 	complete() bool
+
+	// saveToSnapshot stores the state of the processor with Outbox.offerToSnapshot. a processor with inbound edges is
+	// called when the snapshot barrier arrived on all of them, a source when the job asks for a snapshot.
+	// if it returns false, it will be invoked again until it return true
+	saveToSnapshot() bool
+
+	// snapshotCommitFinish called after the snapshot was completed on all the processors of the job, or failed.
+	// the processor commits or rolls back what it prepared in saveToSnapshot. if it returns false, it will be invoked again until it return true
+	snapshotCommitFinish(success bool) bool
+
+	// restoreFromSnapshot called when the job is restarted from a snapshot, before any item is processed. the inbox
+	// holds MapEntry items with the state saved by the processors of the vertex, the entries with a BroadcastKey are
+	// given to every processor, the others to the processor owning the key's partition
+	restoreFromSnapshot(inbox Inbox)
+
+	// finishSnapshotRestore called after all the entries were restored. if it returns false, it will be invoked again until it return true
+	finishSnapshotRestore() bool
+}
+
+// BroadcastKey the key of a snapshot entry that is restored to all processors of the vertex
+type BroadcastKey struct {
+	key interface{}
 }
 
-// ProcessorSupplier factory Processor instance
+func NewBroadcastKey(key interface{}) BroadcastKey {
+	return BroadcastKey{key: key}
+}
+
+// ProcessorSupplier factory of the Processor instances of a vertex on one member
 type ProcessorSupplier interface {
+
+	// init called on the member before Get
+	init(ctx context.Context)
+
+	// Get return count processor instances, count is the local parallelism of the vertex
+	Get(count int) []Processor
+
+	// close called after the execution finished on the member, err is nil if it completed successfully
+	close(err error)
+}
+
+// ProcessorSupplierFromGetFn a ProcessorSupplier that creates each processor by calling getFn
+type ProcessorSupplierFromGetFn struct {
+	getFn GetFn
+}
+
+func NewProcessorSupplierFromGetFn(getFn GetFn) *ProcessorSupplierFromGetFn {
+	return &ProcessorSupplierFromGetFn{getFn: getFn}
+}
+
+func (s *ProcessorSupplierFromGetFn) init(ctx context.Context) {
+}
+
+func (s *ProcessorSupplierFromGetFn) Get(count int) []Processor {
+	processors := make([]Processor, count)
+	for i := range processors {
+		processors[i] = s.getFn().(Processor)
+	}
+	return processors
+}
+
+func (s *ProcessorSupplierFromGetFn) close(err error) {
 }
 
 // ProcessorMetaSupplier factory of ProcessorSupplier instances
 type ProcessorMetaSupplier interface {
 
 	// getTags returns the metadata on this supplier, a string-to-string map, There is no predefined metadata;
-	getTags()
+	getTags() map[string]string
 
 	// preferredLocalParallelism return the local parallelism
 	getPreferredLocalParallelism() int
@@ -55,11 +118,11 @@ type NoopP struct {
 }
 
 func (n NoopP) tryProcess(ordinal int, item interface{}) bool {
-	panic("implement me")
+	return true
 }
 
 func (n NoopP) complete() bool {
-	panic("implement me")
+	return true
 }
 
 func NewNoopP() *NoopP {
@@ -79,24 +142,42 @@ func (n NoopP) init(context context.Context, outbox Outbox) {
 }
 
 func (n NoopP) process(ordinal int, inbox Inbox) {
-
+	inbox.clear()
 }
 
 func (n NoopP) tryProcessWatermark(watermark Watermark) bool {
 	return true
 }
 
+func (n NoopP) saveToSnapshot() bool {
+	return true
+}
+
+func (n NoopP) snapshotCommitFinish(success bool) bool {
+	return true
+}
+
+func (n NoopP) restoreFromSnapshot(inbox Inbox) {
+	inbox.clear()
+}
+
+func (n NoopP) finishSnapshotRestore() bool {
+	return true
+}
+
+// MetaSupplierFromProcessorSupplier a ProcessorMetaSupplier that gives the same ProcessorSupplier to every member
 type MetaSupplierFromProcessorSupplier struct {
 	preferredLocalParallelism int
 	processorSupplier         ProcessorSupplier
+	tags                      map[string]string
 }
 
 func NewMetaSupplierFromProcessorSupplier(preferredLocalParallelism int, processorSupplier ProcessorSupplier) *MetaSupplierFromProcessorSupplier {
-	return &MetaSupplierFromProcessorSupplier{preferredLocalParallelism: preferredLocalParallelism, processorSupplier: processorSupplier}
+	return &MetaSupplierFromProcessorSupplier{preferredLocalParallelism: preferredLocalParallelism, processorSupplier: processorSupplier, tags: make(map[string]string)}
 }
 
-func (m MetaSupplierFromProcessorSupplier) getTags() {
-	panic("implement me")
+func (m MetaSupplierFromProcessorSupplier) getTags() map[string]string {
+	return m.tags
 }
 
 func (m MetaSupplierFromProcessorSupplier) getPreferredLocalParallelism() int {
@@ -104,21 +185,57 @@ func (m MetaSupplierFromProcessorSupplier) getPreferredLocalParallelism() int {
 }
 
 func (m MetaSupplierFromProcessorSupplier) init(ctx context.Context) {
-	panic("implement me")
 }
 
 func (m MetaSupplierFromProcessorSupplier) get(address []interface{}) ApplyFn {
-	panic("implement me")
+	return func(t interface{}) interface{} {
+		return m.processorSupplier
+	}
+}
+
+// MetaSupplierFromAddressFn a ProcessorMetaSupplier that creates a separate ProcessorSupplier for each member by
+// calling addressFn with the member's Address
+type MetaSupplierFromAddressFn struct {
+	preferredLocalParallelism int
+	addressFn                 func(address Address) ProcessorSupplier
+	tags                      map[string]string
+}
+
+func NewMetaSupplierFromAddressFn(preferredLocalParallelism int, addressFn func(address Address) ProcessorSupplier) *MetaSupplierFromAddressFn {
+	return &MetaSupplierFromAddressFn{preferredLocalParallelism: preferredLocalParallelism, addressFn: addressFn, tags: make(map[string]string)}
+}
+
+func (m MetaSupplierFromAddressFn) getTags() map[string]string {
+	return m.tags
+}
+
+func (m MetaSupplierFromAddressFn) getPreferredLocalParallelism() int {
+	return m.preferredLocalParallelism
+}
+
+func (m MetaSupplierFromAddressFn) init(ctx context.Context) {
+}
+
+func (m MetaSupplierFromAddressFn) get(address []interface{}) ApplyFn {
+	return func(t interface{}) interface{} {
+		return m.addressFn(t.(Address))
+	}
 }
 
-// AbstractProcessor base class to implement custom processors
+// AbstractProcessor base class to implement custom processors.
+// self is the processor embedding this one, the items taken from the inbox are dispatched to its tryProcess
 type AbstractProcessor struct {
+	self        Processor
 	outbox      Outbox
 	pendingItem interface{}
 }
 
+func NewAbstractProcessor(self Processor) *AbstractProcessor {
+	return &AbstractProcessor{self: self}
+}
+
 func (p *AbstractProcessor) complete() bool {
-	panic("implement me")
+	return true
 }
 
 func (p *AbstractProcessor) isCooperative() bool {
@@ -147,7 +264,17 @@ func (p *AbstractProcessor) process(ordinal int, inbox Inbox) {
 
 // tryProcessWatermark this basic implementation only forwards the passed watermark
 func (p *AbstractProcessor) tryProcessWatermark(watermark Watermark) bool {
-	return p.tryEmit(-1, watermark)
+	return p.tryEmit(-1, &watermark)
+}
+
+// saveToSnapshot this basic implementation is for stateless processors, it saves nothing
+func (p *AbstractProcessor) saveToSnapshot() bool {
+	return true
+}
+
+// snapshotCommitFinish this basic implementation has nothing to commit
+func (p *AbstractProcessor) snapshotCommitFinish(success bool) bool {
+	return true
 }
 
 func (p *AbstractProcessor) init(ctx context.Context, outbox Outbox) {
@@ -157,20 +284,40 @@ func (p *AbstractProcessor) init(ctx context.Context, outbox Outbox) {
 
 // restoreFromSnapshot implements the boilerplate of polling the inbox, casting the item to key, value pair
 func (p *AbstractProcessor) restoreFromSnapshot(inbox Inbox) {
-	var item interface{}
-	for ; item != nil; item = inbox.poll() {
+	restorer := mapEntryRestorer(p)
+	if r, ok := p.self.(mapEntryRestorer); ok {
+		restorer = r
+	}
+	for item := inbox.poll(); item != nil; item = inbox.poll() {
 		if entry, ok := item.(MapEntry); ok {
-			p.restoreFromSnapshotWithMapEntry(entry)
+			restorer.restoreFromSnapshotWithMapEntry(entry)
 		}
 	}
 }
 
+// finishSnapshotRestore this basic implementation has nothing to do after the entries were restored
+func (p *AbstractProcessor) finishSnapshotRestore() bool {
+	return true
+}
+
+// idleProcessor a processor that has work to do while no items arrive, like emitting results on wall-clock time
+type idleProcessor interface {
+	// tryProcessIdle called when the inbox is empty, the inbox is filled again only after it returns true
+	tryProcessIdle() bool
+}
+
+// mapEntryRestorer a processor that restores its state one snapshot entry at a time
+type mapEntryRestorer interface {
+	restoreFromSnapshotWithMapEntry(entry MapEntry)
+}
+
 func (p *AbstractProcessor) initContext(ctx context.Context) {
 }
 
-// restoreFromSnapshotWithMapEntry called to restore one key-value pair from snapshot to processor's internal state
+// restoreFromSnapshotWithMapEntry called to restore one key-value pair from snapshot to processor's internal state,
+// a processor that saves its state must override it
 func (p *AbstractProcessor) restoreFromSnapshotWithMapEntry(entry MapEntry) {
-	panic("implement me")
+	panic("Processor saved its state to the snapshot but doesn't override restoreFromSnapshotWithMapEntry")
 }
 
 // emitFromTraverser obtains items from traverser and offers them to the outbox's buckets identified in the supplier array
@@ -213,8 +360,7 @@ func (p *AbstractProcessor) emitFromTraverserWithMany(ordinal []int, traverser T
 
 // process0 the processN methods contain repeated looping code in order to give an easier job to compiler to optimize each case independently, and to ensure that ordinal is dispatched on just once per process all
 func (p *AbstractProcessor) process0(inbox Inbox) {
-	var item interface{}
-	for ; item != nil && p.tryProcess0(item); item = inbox.peek() {
+	for item := inbox.peek(); item != nil && p.tryProcess0(item); item = inbox.peek() {
 		inbox.remove()
 	}
 }
@@ -226,8 +372,7 @@ func (p *AbstractProcessor) tryProcess0(item interface{}) bool {
 
 // process1 the processN methods contain repeated looping code in order to give an easier job to compiler to optimize each case independently, and to ensure that ordinal is dispatched on just once per process all
 func (p *AbstractProcessor) process1(inbox Inbox) {
-	var item interface{}
-	for ; item != nil && p.tryProcess1(item); item = inbox.peek() {
+	for item := inbox.peek(); item != nil && p.tryProcess1(item); item = inbox.peek() {
 		inbox.remove()
 	}
 }
@@ -239,8 +384,7 @@ func (p *AbstractProcessor) tryProcess1(item interface{}) bool {
 
 // process2 the processN methods contain repeated looping code in order to give an easier job to compiler to optimize each case independently, and to ensure that ordinal is dispatched on just once per process all
 func (p *AbstractProcessor) process2(inbox Inbox) {
-	var item interface{}
-	for ; item != nil && p.tryProcess2(item); item = inbox.peek() {
+	for item := inbox.peek(); item != nil && p.tryProcess2(item); item = inbox.peek() {
 		inbox.remove()
 	}
 }
@@ -253,8 +397,7 @@ func (p *AbstractProcessor) tryProcess2(item interface{}) bool {
 
 // process3 the processN methods contain repeated looping code in order to give an easier job to compiler to optimize each case independently, and to ensure that ordinal is dispatched on just once per process all
 func (p *AbstractProcessor) process3(inbox Inbox) {
-	var item interface{}
-	for ; item != nil && p.tryProcess3(item); item = inbox.peek() {
+	for item := inbox.peek(); item != nil && p.tryProcess3(item); item = inbox.peek() {
 		inbox.remove()
 	}
 }
@@ -266,8 +409,7 @@ func (p *AbstractProcessor) tryProcess3(item interface{}) bool {
 
 // process4 the processN methods contain repeated looping code in order to give an easier job to compiler to optimize each case independently, and to ensure that ordinal is dispatched on just once per process all
 func (p *AbstractProcessor) process4(inbox Inbox) {
-	var item interface{}
-	for ; item != nil && p.tryProcess3(item); item = inbox.peek() {
+	for item := inbox.peek(); item != nil && p.tryProcess4(item); item = inbox.peek() {
 		inbox.remove()
 	}
 }
@@ -278,12 +420,14 @@ func (p *AbstractProcessor) tryProcess4(item interface{}) bool {
 }
 
 func (p *AbstractProcessor) tryProcess(ordinal int, item interface{}) bool {
-	panic("implement me")
+	if p.self == nil {
+		panic("implement me")
+	}
+	return p.self.tryProcess(ordinal, item)
 }
 
 func (p *AbstractProcessor) processAny(ordinal int, inbox Inbox) {
-	var item interface{}
-	for ; item != nil && p.tryProcess(ordinal, item); item = inbox.peek() {
+	for item := inbox.peek(); item != nil && p.tryProcess(ordinal, item); item = inbox.peek() {
 		inbox.remove()
 	}
 }
@@ -306,10 +450,13 @@ type GroupP struct {
 	aggrOp            AggregateOperation
 	resultTraverser   Traverser
 	mapToOutputFn     BiApplyFn
+	snapshotEntries   []MapEntry
 }
 
 func NewGroupP(groupKeyFns []ApplyFn, aggrOp AggregateOperation, mapToOutputFn BiApplyFn) *GroupP {
-	return &GroupP{groupKeyFns: groupKeyFns, aggrOp: aggrOp, mapToOutputFn: mapToOutputFn, abstractProcessor: &AbstractProcessor{}, keyToAcc: make(map[interface{}]interface{})}
+	p := &GroupP{groupKeyFns: groupKeyFns, aggrOp: aggrOp, mapToOutputFn: mapToOutputFn, keyToAcc: make(map[interface{}]interface{})}
+	p.abstractProcessor = NewAbstractProcessor(p)
+	return p
 }
 
 func (p *GroupP) isCooperative() bool {
@@ -328,6 +475,44 @@ func (p *GroupP) tryProcessWatermark(watermark Watermark) bool {
 	return p.abstractProcessor.tryProcessWatermark(watermark)
 }
 
+// saveToSnapshot saves the accumulator of each key
+func (p *GroupP) saveToSnapshot() bool {
+	if p.snapshotEntries == nil {
+		for key, acc := range p.keyToAcc {
+			p.snapshotEntries = append(p.snapshotEntries, MapEntry{key: key, value: acc})
+		}
+	}
+	for ; len(p.snapshotEntries) > 0; p.snapshotEntries = p.snapshotEntries[1:] {
+		if !p.abstractProcessor.outbox.offerToSnapshot(p.snapshotEntries[0].key, p.snapshotEntries[0].value) {
+			return false
+		}
+	}
+	p.snapshotEntries = nil
+	return true
+}
+
+func (p *GroupP) snapshotCommitFinish(success bool) bool {
+	return p.abstractProcessor.snapshotCommitFinish(success)
+}
+
+func (p *GroupP) restoreFromSnapshot(inbox Inbox) {
+	p.abstractProcessor.restoreFromSnapshot(inbox)
+}
+
+// restoreFromSnapshotWithMapEntry the accumulator is combined into the one the key already has, if the operation can
+// combine them. the processors of a first stage save partial accumulators of the same key
+func (p *GroupP) restoreFromSnapshotWithMapEntry(entry MapEntry) {
+	if acc, ok := p.keyToAcc[entry.key]; ok && p.aggrOp.getCombineFn() != nil {
+		p.aggrOp.getCombineFn()(acc, entry.value)
+		return
+	}
+	p.keyToAcc[entry.key] = entry.value
+}
+
+func (p *GroupP) finishSnapshotRestore() bool {
+	return p.abstractProcessor.finishSnapshotRestore()
+}
+
 func (p *GroupP) tryProcess(ordinal int, item interface{}) bool {
 	var (
 		acc interface{}
@@ -336,7 +521,8 @@ func (p *GroupP) tryProcess(ordinal int, item interface{}) bool {
 	keyFn := p.groupKeyFns[ordinal]
 	key := keyFn(item)
 	if acc, ok = p.keyToAcc[key]; !ok {
-		acc = p.aggrOp.getCreateFn()
+		acc = p.aggrOp.getCreateFn()()
+		p.keyToAcc[key] = acc
 	}
 	p.aggrOp.accumulateFn(ordinal)(acc, item)
 	return true
@@ -377,7 +563,7 @@ type TransformP struct {
 
 func NewTransformP(mapper ApplyFn) *TransformP {
 	p := new(TransformP)
-	p.AbstractProcessor = &AbstractProcessor{}
+	p.AbstractProcessor = NewAbstractProcessor(p)
 	p.flatMapper = NewFlatMapper(nil, mapper, p.AbstractProcessor)
 	return p
 }
@@ -392,15 +578,49 @@ type MapP struct {
 }
 
 func NewMapP(mapFn ApplyFn) *MapP {
-	p := new(MapP)
 	trav := &ResettableSingletonTraverser{}
 	return &MapP{TransformP: NewTransformP(func(t interface{}) interface{} {
 		trav.accept(mapFn(t))
 		return trav
 	})}
+}
+
+// PeekP passes the items through unchanged and logs those that match shouldLogFn, formatted by toStringFn
+type PeekP struct {
+	*AbstractProcessor
+	shouldLogFn TestFn
+	toStringFn  ApplyFn
+	logger      *log.Logger
+}
+
+// NewPeekP a nil shouldLogFn logs every item, a nil toStringFn formats the items with %v
+func NewPeekP(shouldLogFn TestFn, toStringFn ApplyFn) *PeekP {
+	p := &PeekP{shouldLogFn: shouldLogFn, toStringFn: toStringFn, logger: log.Default()}
+	p.AbstractProcessor = NewAbstractProcessor(p)
 	return p
 }
 
+func (p *PeekP) init(ctx context.Context, outbox Outbox) {
+	p.AbstractProcessor.init(ctx, outbox)
+	if c := ProcessorContextOf(ctx); c != nil {
+		p.logger = c.getLogger()
+	}
+}
+
+func (p *PeekP) tryProcess(ordinal int, item interface{}) bool {
+	if !p.tryEmit(-1, item) {
+		return false
+	}
+	if p.shouldLogFn == nil || p.shouldLogFn(item) {
+		if p.toStringFn != nil {
+			p.logger.Printf("Output: %v", p.toStringFn(item))
+		} else {
+			p.logger.Printf("Output: %v", item)
+		}
+	}
+	return true
+}
+
 type AggregateP struct {
 	*GroupP
 }
@@ -418,10 +638,317 @@ func NewAggregateP(aggrOp AggregateOperation) *AggregateP {
 	p.GroupP = NewGroupP(groupKeyFns, aggrOp, func(k, r interface{}) interface{} {
 		return r
 	})
-	p.keyToAcc[CONSTANT_KEY] = aggrOp.getCreateFn()
+	p.keyToAcc[CONSTANT_KEY] = aggrOp.getCreateFn()()
+	return p
+}
+
+// AccumulateByKeyP the first stage of a two-stage group-and-aggregate, it accumulates the items by key and once the input
+// is exhausted emits a MapEntry of each key and its partial accumulator
+type AccumulateByKeyP struct {
+	*GroupP
+}
+
+func NewAccumulateByKeyP(groupKeyFns []ApplyFn, aggrOp AggregateOperation) *AccumulateByKeyP {
+	return &AccumulateByKeyP{GroupP: NewGroupP(groupKeyFns, aggrOp.withIdentityFinish(), func(key, acc interface{}) interface{} {
+		return MapEntry{key: key, value: acc}
+	})}
+}
+
+// CombineByKeyP the second stage of a two-stage group-and-aggregate, it receives the MapEntry items AccumulateByKeyP
+// emits, combines the partial accumulators of each key with the combine primitive and emits the finished results
+type CombineByKeyP struct {
+	*GroupP
+}
+
+func NewCombineByKeyP(aggrOp AggregateOperation, mapToOutputFn BiApplyFn) *CombineByKeyP {
+	entryKeyFn := func(t interface{}) interface{} {
+		return t.(MapEntry).key
+	}
+	return &CombineByKeyP{GroupP: NewGroupP([]ApplyFn{entryKeyFn}, aggrOp.withCombiningAccumulateFn(func(t interface{}) interface{} {
+		return t.(MapEntry).value
+	}), mapToOutputFn)}
+}
+
+// MapStatefulP keeps a state object createFn creates for each key keyFn extracts and emits all the items of the
+// traverser statefulFlatMapFn returns for the state, the key and the item. the states are saved to the snapshots
+type MapStatefulP struct {
+	*AbstractProcessor
+	keyFn             ApplyFn
+	createFn          GetFn
+	statefulFlatMapFn TriApplyFn
+	keyToState        map[interface{}]interface{}
+	flatMapper        *FlatMapper
+	snapshotEntries   []MapEntry
+}
+
+func NewMapStatefulP(keyFn ApplyFn, createFn GetFn, statefulFlatMapFn TriApplyFn) *MapStatefulP {
+	p := &MapStatefulP{keyFn: keyFn, createFn: createFn, statefulFlatMapFn: statefulFlatMapFn, keyToState: make(map[interface{}]interface{})}
+	p.AbstractProcessor = NewAbstractProcessor(p)
+	p.flatMapper = NewFlatMapper(nil, func(item interface{}) interface{} {
+		key := p.keyFn(item)
+		state, ok := p.keyToState[key]
+		if !ok {
+			state = p.createFn()
+			p.keyToState[key] = state
+		}
+		return p.statefulFlatMapFn(state, key, item)
+	}, p.AbstractProcessor)
 	return p
 }
 
+func (p *MapStatefulP) tryProcess(ordinal int, item interface{}) bool {
+	return p.flatMapper.tryProcess(item)
+}
+
+func (p *MapStatefulP) saveToSnapshot() bool {
+	if p.snapshotEntries == nil {
+		for key, state := range p.keyToState {
+			p.snapshotEntries = append(p.snapshotEntries, MapEntry{key: key, value: state})
+		}
+	}
+	for ; len(p.snapshotEntries) > 0; p.snapshotEntries = p.snapshotEntries[1:] {
+		if !p.outbox.offerToSnapshot(p.snapshotEntries[0].key, p.snapshotEntries[0].value) {
+			return false
+		}
+	}
+	p.snapshotEntries = nil
+	return true
+}
+
+func (p *MapStatefulP) restoreFromSnapshotWithMapEntry(entry MapEntry) {
+	p.keyToState[entry.key] = entry.value
+}
+
+// TransformUsingServiceP emits all the items of the traverser flatMapFn returns for the service, the key keyFn extracts
+// and the item. a nil keyFn passes a nil key. the processor creates its service when it's initialized and destroys it
+// once its input is exhausted
+type TransformUsingServiceP struct {
+	*AbstractProcessor
+	serviceFactory ServiceFactory
+	service        interface{}
+	flatMapper     *FlatMapper
+}
+
+func NewTransformUsingServiceP(serviceFactory ServiceFactory, keyFn ApplyFn, flatMapFn TriApplyFn) *TransformUsingServiceP {
+	p := &TransformUsingServiceP{serviceFactory: serviceFactory}
+	p.AbstractProcessor = NewAbstractProcessor(p)
+	p.flatMapper = NewFlatMapper(nil, func(item interface{}) interface{} {
+		var key interface{}
+		if keyFn != nil {
+			key = keyFn(item)
+		}
+		return flatMapFn(p.service, key, item)
+	}, p.AbstractProcessor)
+	return p
+}
+
+func (p *TransformUsingServiceP) init(ctx context.Context, outbox Outbox) {
+	p.AbstractProcessor.init(ctx, outbox)
+	p.service = p.serviceFactory.createService()
+}
+
+func (p *TransformUsingServiceP) tryProcess(ordinal int, item interface{}) bool {
+	return p.flatMapper.tryProcess(item)
+}
+
+func (p *TransformUsingServiceP) complete() bool {
+	p.serviceFactory.destroyService(p.service)
+	return true
+}
+
+// asyncOp an item mapped on its own goroutine, or a watermark waiting for the items received before it
+type asyncOp struct {
+	done      chan struct{}
+	traverser Traverser
+	panicked  interface{}
+	watermark *Watermark
+}
+
+// AsyncTransformUsingServiceP calls flatMapFn on a separate goroutine for each item, at most maxConcurrentOps of them at
+// a time, and emits the items of the returned traversers. unless preserveOrder is set, the results are emitted in the
+// order they are ready. a watermark is emitted after the results of all the items received before it. the in-flight
+// items are finished before a snapshot is saved, so the snapshot holds none of them
+type AsyncTransformUsingServiceP struct {
+	*AbstractProcessor
+	serviceFactory   ServiceFactory
+	keyFn            ApplyFn
+	maxConcurrentOps int
+	preserveOrder    bool
+	flatMapFn        TriApplyFn
+	service          interface{}
+	// pending the in-flight items and the watermarks in the order they were received
+	pending  []*asyncOp
+	inFlight int
+}
+
+func NewAsyncTransformUsingServiceP(serviceFactory ServiceFactory, keyFn ApplyFn, maxConcurrentOps int, preserveOrder bool, flatMapFn TriApplyFn) *AsyncTransformUsingServiceP {
+	if maxConcurrentOps <= 0 {
+		panic(fmt.Sprintf("maxConcurrentOps must be positive, got %d", maxConcurrentOps))
+	}
+	p := &AsyncTransformUsingServiceP{serviceFactory: serviceFactory, keyFn: keyFn, maxConcurrentOps: maxConcurrentOps, preserveOrder: preserveOrder, flatMapFn: flatMapFn}
+	p.AbstractProcessor = NewAbstractProcessor(p)
+	return p
+}
+
+func (p *AsyncTransformUsingServiceP) init(ctx context.Context, outbox Outbox) {
+	p.AbstractProcessor.init(ctx, outbox)
+	p.service = p.serviceFactory.createService()
+}
+
+func (p *AsyncTransformUsingServiceP) tryProcess(ordinal int, item interface{}) bool {
+	p.tryFlush()
+	if p.inFlight >= p.maxConcurrentOps {
+		return false
+	}
+	var key interface{}
+	if p.keyFn != nil {
+		key = p.keyFn(item)
+	}
+	op := &asyncOp{done: make(chan struct{})}
+	go func(service interface{}) {
+		defer close(op.done)
+		defer func() {
+			op.panicked = recover()
+		}()
+		op.traverser, _ = p.flatMapFn(service, key, item).(Traverser)
+	}(p.service)
+	p.pending = append(p.pending, op)
+	p.inFlight++
+	return true
+}
+
+func (p *AsyncTransformUsingServiceP) tryProcessWatermark(watermark Watermark) bool {
+	p.pending = append(p.pending, &asyncOp{watermark: &watermark})
+	p.tryFlush()
+	return true
+}
+
+func (p *AsyncTransformUsingServiceP) tryProcessIdle() bool {
+	p.tryFlush()
+	return true
+}
+
+func (p *AsyncTransformUsingServiceP) complete() bool {
+	if !p.tryFlush() || len(p.pending) > 0 {
+		return false
+	}
+	p.serviceFactory.destroyService(p.service)
+	return true
+}
+
+func (p *AsyncTransformUsingServiceP) saveToSnapshot() bool {
+	return p.tryFlush() && len(p.pending) == 0
+}
+
+// tryFlush emits the results of the finished items and the watermarks whose preceding items were all emitted, with
+// preserveOrder it stops at the first unfinished item. it returns false if the outbox refused an item
+func (p *AsyncTransformUsingServiceP) tryFlush() bool {
+	kept := p.pending[:0]
+	for i, op := range p.pending {
+		emitted, ok := p.tryEmitOp(op, len(kept) == 0)
+		if !ok {
+			p.pending = append(kept, p.pending[i:]...)
+			return false
+		}
+		if !emitted {
+			kept = append(kept, op)
+			if p.preserveOrder {
+				kept = append(kept, p.pending[i+1:]...)
+				break
+			}
+		}
+	}
+	p.pending = kept
+	return true
+}
+
+// tryEmitOp emitted is false if the item isn't finished yet, or the watermark isn't first, ok is false if the outbox
+// refused an item. a panic of flatMapFn is raised again here, so that it fails the job like any processor panic
+func (p *AsyncTransformUsingServiceP) tryEmitOp(op *asyncOp, first bool) (emitted bool, ok bool) {
+	if op.watermark != nil {
+		if !first {
+			return false, true
+		}
+		ok = p.tryEmit(-1, op.watermark)
+		return ok, ok
+	}
+	select {
+	case <-op.done:
+	default:
+		return false, true
+	}
+	if op.panicked != nil {
+		panic(op.panicked)
+	}
+	if op.traverser != nil && !p.emitFromTraverser(-1, op.traverser) {
+		return false, false
+	}
+	p.inFlight--
+	return true, true
+}
+
+// SortP a batch processor that collects all the items and emits them in their natural order once the input is exhausted
+type SortP struct {
+	*AbstractProcessor
+	items           []interface{}
+	resultTraverser Traverser
+}
+
+func NewSortP() *SortP {
+	p := &SortP{}
+	p.AbstractProcessor = NewAbstractProcessor(p)
+	return p
+}
+
+func (p *SortP) tryProcess(ordinal int, item interface{}) bool {
+	p.items = append(p.items, item)
+	return true
+}
+
+func (p *SortP) complete() bool {
+	if p.resultTraverser == nil {
+		sort.SliceStable(p.items, func(i, j int) bool {
+			return naturalOrderComparator(p.items[i], p.items[j]) < 0
+		})
+		p.resultTraverser = NewAbstractTraverser().traverseItems(p.items...)
+		p.items = nil
+	}
+	return p.emitFromTraverser(-1, p.resultTraverser)
+}
+
+// naturalOrderComparator compares the numbers and the strings by their natural order, both items must be of the same type
+func naturalOrderComparator(a, b interface{}) int {
+	switch a.(type) {
+	case int:
+		return utils.IntComparator(a, b)
+	case int8:
+		return utils.Int8Comparator(a, b)
+	case int16:
+		return utils.Int16Comparator(a, b)
+	case int32:
+		return utils.Int32Comparator(a, b)
+	case int64:
+		return utils.Int64Comparator(a, b)
+	case uint:
+		return utils.UIntComparator(a, b)
+	case uint8:
+		return utils.UInt8Comparator(a, b)
+	case uint16:
+		return utils.UInt16Comparator(a, b)
+	case uint32:
+		return utils.UInt32Comparator(a, b)
+	case uint64:
+		return utils.UInt64Comparator(a, b)
+	case float32:
+		return utils.Float32Comparator(a, b)
+	case float64:
+		return utils.Float64Comparator(a, b)
+	case string:
+		return utils.StringComparator(a, b)
+	}
+	panic(fmt.Sprintf("Items of type %T have no natural order", a))
+}
+
 // FlatMapper a helper that simplifies the implementation of tryProcess for emit collection
 // User supplier a mapper which takes an item and returns a traverser over all output items that should be emitted
 type FlatMapper struct {
@@ -440,6 +967,9 @@ func (m *FlatMapper) tryProcess(item interface{}) bool {
 		v := m.mapper(item)
 		if t, ok := v.(Traverser); ok {
 			m.outputTraverser = t
+		} else {
+			// the mapper returned no traverser, there is nothing to emit for this item
+			return true
 		}
 	}
 	if m.emit() {
@@ -453,6 +983,6 @@ func (m *FlatMapper) emit() bool {
 	if m.outputOrdinals != nil {
 		return m.p.emitFromTraverserWithMany(m.outputOrdinals, m.outputTraverser)
 	} else {
-		return m.p.tryEmit(-1, m.outputTraverser)
+		return m.p.emitFromTraverser(-1, m.outputTraverser)
 	}
 }
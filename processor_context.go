@@ -0,0 +1,101 @@
+package stream_processing
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// ProcessorContext the metadata of a processor instance: the job and the vertex it belongs to and its place among the
+// processors of the vertex. it is carried inside the context given to Processor.init, use ProcessorContextOf to get it
+type ProcessorContext struct {
+	jobId               int64
+	vertexName          string
+	localProcessorIndex int
+	localParallelism    int
+	memberIndex         int
+	memberCount         int
+	processingGuarantee ProcessingGuarantee
+	logger              *log.Logger
+}
+
+type processorContextKey struct{}
+
+func NewProcessorContext(jobId int64, vertexName string, localProcessorIndex, localParallelism, memberIndex, memberCount int,
+	processingGuarantee ProcessingGuarantee, config *InstanceConfig) *ProcessorContext {
+	c := &ProcessorContext{
+		jobId:               jobId,
+		vertexName:          vertexName,
+		localProcessorIndex: localProcessorIndex,
+		localParallelism:    localParallelism,
+		memberIndex:         memberIndex,
+		memberCount:         memberCount,
+		processingGuarantee: processingGuarantee,
+	}
+	c.logger = log.New(config.logOutput, fmt.Sprintf("[job %d] %s#%d ", jobId, vertexName, c.getGlobalProcessorIndex()), log.LstdFlags)
+	return c
+}
+
+// ProcessorContextOf return the ProcessorContext carried by the context, nil if there is none
+func ProcessorContextOf(ctx context.Context) *ProcessorContext {
+	if ctx == nil {
+		return nil
+	}
+	c, _ := ctx.Value(processorContextKey{}).(*ProcessorContext)
+	return c
+}
+
+// withProcessorContext return a context carrying the ProcessorContext
+func withProcessorContext(ctx context.Context, c *ProcessorContext) context.Context {
+	return context.WithValue(ctx, processorContextKey{}, c)
+}
+
+// getJobId return the ID of the job the processor runs in
+func (c *ProcessorContext) getJobId() int64 {
+	return c.jobId
+}
+
+// getVertexName return the name of the vertex the processor belongs to
+func (c *ProcessorContext) getVertexName() string {
+	return c.vertexName
+}
+
+// getLocalProcessorIndex return the index of the processor among the processors of the vertex on this member
+func (c *ProcessorContext) getLocalProcessorIndex() int {
+	return c.localProcessorIndex
+}
+
+// getGlobalProcessorIndex return the index of the processor among the processors of the vertex on all members
+func (c *ProcessorContext) getGlobalProcessorIndex() int {
+	return c.memberIndex*c.localParallelism + c.localProcessorIndex
+}
+
+// getLocalParallelism return the number of processors of the vertex on this member
+func (c *ProcessorContext) getLocalParallelism() int {
+	return c.localParallelism
+}
+
+// getTotalParallelism return the number of processors of the vertex on all members
+func (c *ProcessorContext) getTotalParallelism() int {
+	return c.localParallelism * c.memberCount
+}
+
+// getMemberIndex return the index of this member among the members running the job
+func (c *ProcessorContext) getMemberIndex() int {
+	return c.memberIndex
+}
+
+// getMemberCount return the number of members running the job
+func (c *ProcessorContext) getMemberCount() int {
+	return c.memberCount
+}
+
+// getProcessingGuarantee return the snapshotting guarantee of the job
+func (c *ProcessorContext) getProcessingGuarantee() ProcessingGuarantee {
+	return c.processingGuarantee
+}
+
+// getLogger return the logger of the processor, its messages are prefixed with the job ID and the processor name
+func (c *ProcessorContext) getLogger() *log.Logger {
+	return c.logger
+}
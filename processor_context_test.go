@@ -0,0 +1,79 @@
+package stream_processing
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ProcessorContextTest struct {
+	mu       sync.Mutex
+	contexts []*ProcessorContext
+}
+
+func ProcessorContextTestSetup(tb testing.TB) (func(tb testing.TB), *ProcessorContextTest) {
+	pt := &ProcessorContextTest{}
+
+	return func(tb testing.TB) {
+		tb.Log("ProcessorContextTestSetup teardown")
+	}, pt
+}
+
+// contextRecordingP a processor that records the ProcessorContext it was initialized with
+type contextRecordingP struct {
+	*NoopP
+	test *ProcessorContextTest
+}
+
+func (p *contextRecordingP) init(ctx context.Context, outbox Outbox) {
+	p.test.mu.Lock()
+	defer p.test.mu.Unlock()
+	p.test.contexts = append(p.test.contexts, ProcessorContextOf(ctx))
+}
+
+func TestProcessorContext_when_jobRunsOnCluster_then_processorsGetTheirIndices(t *testing.T) {
+	teardownTest, pt := ProcessorContextTestSetup(t)
+	defer teardownTest(t)
+
+	cluster := NewLoopbackCluster(3, NewInstanceConfig().setCooperativeThreadCount(2))
+	defer cluster.shutdown()
+	dag := NewDAG()
+	dag.newVertex("v", func() interface{} {
+		return &contextRecordingP{NoopP: NewNoopP(), test: pt}
+	}).setLocalParallelism(2)
+
+	job := cluster.newJobWithConfig(context.Background(), dag, NewJobConfig().setProcessingGuarantee(AT_LEAST_ONCE))
+	assert.NoError(t, job.Join())
+
+	var globalIndices []int
+	for _, c := range pt.contexts {
+		assert.Equal(t, job.getId(), c.getJobId())
+		assert.Equal(t, "v", c.getVertexName())
+		assert.Equal(t, 2, c.getLocalParallelism())
+		assert.Equal(t, 6, c.getTotalParallelism())
+		assert.Equal(t, 3, c.getMemberCount())
+		assert.Equal(t, AT_LEAST_ONCE, c.getProcessingGuarantee())
+		assert.Equal(t, c.getMemberIndex()*2+c.getLocalProcessorIndex(), c.getGlobalProcessorIndex())
+		globalIndices = append(globalIndices, c.getGlobalProcessorIndex())
+	}
+	assert.ElementsMatch(t, []int{0, 1, 2, 3, 4, 5}, globalIndices)
+}
+
+func TestProcessorContext_when_logging_then_prefixedWithProcessorName(t *testing.T) {
+	teardownTest, _ := ProcessorContextTestSetup(t)
+	defer teardownTest(t)
+
+	var buf bytes.Buffer
+	c := NewProcessorContext(7, "map", 1, 2, 1, 2, NONE, NewInstanceConfig().setLogOutput(&buf))
+	c.getLogger().Print("hello")
+	assert.Contains(t, buf.String(), "[job 7] map#3 ")
+	assert.Contains(t, buf.String(), "hello")
+}
+
+func TestProcessorContext_when_noContext_then_nil(t *testing.T) {
+	assert.Nil(t, ProcessorContextOf(context.Background()))
+	assert.Nil(t, ProcessorContextOf(nil))
+}
@@ -1,5 +1,13 @@
 package stream_processing
 
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
 const (
 	MOCK_ITEM           = "x"
 	OUTBOX_BUCKET_COUNT = 4
@@ -17,5 +25,171 @@ var (
 )
 
 type ProcessorTest struct {
+}
+
+// lifecycleSupplier a ProcessorSupplier that records the calls of its lifecycle methods
+type lifecycleSupplier struct {
+	*ProcessorSupplierFromGetFn
+	initCalled  bool
+	getCount    int
+	closeCalled bool
+	closeErr    error
+}
+
+func (s *lifecycleSupplier) init(ctx context.Context) {
+	s.initCalled = true
+}
+
+func (s *lifecycleSupplier) Get(count int) []Processor {
+	s.getCount = count
+	return s.ProcessorSupplierFromGetFn.Get(count)
+}
+
+func (s *lifecycleSupplier) close(err error) {
+	s.closeCalled = true
+	s.closeErr = err
+}
+
+func TestProcessorSupplier_when_getCalled_then_distinctProcessors(t *testing.T) {
+	supplier := NewProcessorSupplierFromGetFn(func() interface{} {
+		return NewNoopP()
+	})
+	processors := supplier.Get(3)
+	assert.Len(t, processors, 3)
+	assert.NotSame(t, processors[0], processors[1])
+}
+
+func TestProcessorSupplier_when_jobRuns_then_lifecycleMethodsCalled(t *testing.T) {
+	service := NewExecutionService(NewInstanceConfig().setCooperativeThreadCount(2))
+	defer service.shutdown()
+
+	supplier := &lifecycleSupplier{ProcessorSupplierFromGetFn: NewProcessorSupplierFromGetFn(func() interface{} {
+		return NewNoopP()
+	})}
+	dag := NewDAG()
+	dag.vertex(NewVertex("v", supplier)).setLocalParallelism(3)
+
+	assert.NoError(t, service.execute(context.Background(), dag))
+	assert.True(t, supplier.initCalled)
+	assert.Equal(t, 3, supplier.getCount)
+	assert.True(t, supplier.closeCalled)
+	assert.NoError(t, supplier.closeErr)
+}
+
+func TestProcessorSupplier_when_jobFails_then_closedWithError(t *testing.T) {
+	service := NewExecutionService(NewInstanceConfig().setCooperativeThreadCount(2))
+	defer service.shutdown()
+
+	supplier := &lifecycleSupplier{ProcessorSupplierFromGetFn: NewProcessorSupplierFromGetFn(func() interface{} {
+		return neverCompletingP{NoopP: NewNoopP()}
+	})}
+	dag := NewDAG()
+	dag.vertex(NewVertex("v", supplier))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Error(t, service.execute(ctx, dag))
+	assert.Equal(t, context.DeadlineExceeded, supplier.closeErr)
+}
+
+func TestProcessorMetaSupplier_when_fromAddressFn_then_supplierPerMember(t *testing.T) {
+	var addresses []Address
+	metaSupplier := NewMetaSupplierFromAddressFn(LOCAL_PARALLELISM_USE_DEFAULT, func(address Address) ProcessorSupplier {
+		addresses = append(addresses, address)
+		return NewProcessorSupplierFromGetFn(func() interface{} {
+			return NewNoopP()
+		})
+	})
+	members := []interface{}{NewAddress("10.0.0.1", 5701), NewAddress("10.0.0.2", 5701)}
+	supplierFn := metaSupplier.get(members)
+	for _, member := range members {
+		assert.IsType(t, &ProcessorSupplierFromGetFn{}, supplierFn(member))
+	}
+	assert.Equal(t, []Address{NewAddress("10.0.0.1", 5701), NewAddress("10.0.0.2", 5701)}, addresses)
+	assert.NotNil(t, metaSupplier.getTags())
+}
+
+func TestCombineByKeyP_when_partialAccumulatorsCombined_then_sameAsSingleStage(t *testing.T) {
+	keyFn := func(t interface{}) interface{} {
+		return t.(string)[:1]
+	}
+	accumulated := [][]interface{}{{"a1", "b1", "a2"}, {"a3", "c1"}}
+	combineP := NewCombineByKeyP(counting(), func(key, result interface{}) interface{} {
+		return MapEntry{key: key, value: result}
+	})
+	combineOutbox := NewTestOutbox(10)
+	combineP.init(context.Background(), combineOutbox)
+
+	for _, items := range accumulated {
+		accumulateP := NewAccumulateByKeyP([]ApplyFn{keyFn}, counting())
+		outbox := NewTestOutbox(10)
+		accumulateP.init(context.Background(), outbox)
+		for _, item := range items {
+			assert.True(t, accumulateP.tryProcess(0, item))
+		}
+		assert.True(t, accumulateP.complete())
+		for _, entry := range outbox.drainQueueAndReset(0) {
+			assert.IsType(t, &LongAccumulator{}, entry.(MapEntry).value)
+			assert.True(t, combineP.tryProcess(0, entry))
+		}
+	}
+
+	assert.True(t, combineP.complete())
+	assert.ElementsMatch(t, []interface{}{
+		MapEntry{key: "a", value: int64(3)}, MapEntry{key: "b", value: int64(1)}, MapEntry{key: "c", value: int64(1)},
+	}, combineOutbox.drainQueueAndReset(0))
+}
+
+func TestMapStatefulP_when_restoredFromSnapshot_then_stateOfEachKeyContinues(t *testing.T) {
+	newMapStatefulP := func() (*MapStatefulP, *TestOutbox) {
+		p := NewMapStatefulP(func(t interface{}) interface{} {
+			return t.(string)[:1]
+		}, func() interface{} {
+			return NewLongAccumulator()
+		}, func(state, key, item interface{}) interface{} {
+			state.(*LongAccumulator).addAllowingOverflow(1)
+			return singletonTraverser(NewTuple2(key, state.(*LongAccumulator).get()))
+		})
+		outbox := NewTestOutbox(10)
+		p.init(context.Background(), outbox)
+		return p, outbox
+	}
+	p, outbox := newMapStatefulP()
+	for _, item := range []string{"a1", "b1", "a2"} {
+		assert.True(t, p.tryProcess(0, item))
+	}
+	assert.Equal(t, []interface{}{NewTuple2("a", int64(1)), NewTuple2("b", int64(1)), NewTuple2("a", int64(2))}, outbox.drainQueueAndReset(0))
+	assert.True(t, p.saveToSnapshot())
+
+	restored, restoredOutbox := newMapStatefulP()
+	for _, entry := range outbox.takeSnapshotEntries() {
+		restored.restoreFromSnapshotWithMapEntry(entry)
+	}
+	assert.True(t, restored.tryProcess(0, "a3"))
+	assert.True(t, restored.tryProcess(0, "c1"))
+	assert.Equal(t, []interface{}{NewTuple2("a", int64(3)), NewTuple2("c", int64(1))}, restoredOutbox.drainQueueAndReset(0))
+}
+
+func TestAsyncTransformUsingServiceP_when_preserveOrder_then_resultsAndWatermarkInInputOrder(t *testing.T) {
+	release := map[int]chan struct{}{1: make(chan struct{}), 2: make(chan struct{})}
+	p := NewAsyncTransformUsingServiceP(NewServiceFactory(func() interface{} {
+		return 10
+	}, nil), nil, 2, true, func(service, key, item interface{}) interface{} {
+		<-release[item.(int)]
+		return singletonTraverser(service.(int) * item.(int))
+	})
+	outbox := NewTestOutbox(10)
+	p.init(context.Background(), outbox)
+
+	assert.True(t, p.tryProcess(0, 1))
+	assert.True(t, p.tryProcess(0, 2))
+	assert.True(t, p.tryProcessWatermark(Watermark{timestamp: 5}))
+	assert.False(t, p.tryProcess(0, 3), "the third item exceeds maxConcurrentOps")
+	close(release[2])
+	assert.False(t, p.complete())
+	assert.Empty(t, outbox.drainQueueAndReset(0), "the second result waits for the first one")
 
+	close(release[1])
+	assert.Eventually(t, p.complete, time.Second, time.Millisecond)
+	assert.Equal(t, []interface{}{10, 20, &Watermark{timestamp: 5}}, outbox.drainQueueAndReset(0))
 }
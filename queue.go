@@ -0,0 +1,19 @@
+package stream_processing
+
+// Queue a FIFO queue that connects the processor instances of two vertices.
+// a single upstream processor offers to it and a single downstream processor drains it
+type Queue interface {
+
+	// offer adds the item to the tail of the queue, return false if the queue cannot accept it now
+	offer(item interface{}) bool
+
+	// poll retrieves and removes the head of the queue, return nil if the queue is empty
+	poll() interface{}
+
+	// drain removes the items and passes them to the supplied function until the queue is empty or the function
+	// returns false. the item for which the function returned false is removed as well. return the number of removed items
+	drain(dest TestFn) int
+
+	// size return the number of items in the queue
+	size() int
+}
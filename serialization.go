@@ -0,0 +1,635 @@
+package stream_processing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+// the type ids of the built-in serializers, each serialized value starts with the type id of its serializer
+const (
+	NIL_TYPE_ID int32 = iota
+	BOOL_TYPE_ID
+	INT_TYPE_ID
+	INT8_TYPE_ID
+	INT16_TYPE_ID
+	INT32_TYPE_ID
+	INT64_TYPE_ID
+	UINT_TYPE_ID
+	UINT8_TYPE_ID
+	UINT16_TYPE_ID
+	UINT32_TYPE_ID
+	UINT64_TYPE_ID
+	FLOAT32_TYPE_ID
+	FLOAT64_TYPE_ID
+	STRING_TYPE_ID
+	BYTES_TYPE_ID
+	SLICE_TYPE_ID
+	TUPLE2_TYPE_ID
+	TUPLE3_TYPE_ID
+	MAP_ENTRY_TYPE_ID
+	WATERMARK_TYPE_ID
+	LONG_ACCUMULATOR_TYPE_ID
+	DOUBLE_ACCUMULATOR_TYPE_ID
+	TIMESTAMPED_ITEM_TYPE_ID
+	KEYED_WINDOW_RESULT_TYPE_ID
+	BROADCAST_KEY_TYPE_ID
+
+	// FALLBACK_TYPE_ID the values of the types without a serializer are written by the fallback serializer
+	FALLBACK_TYPE_ID
+)
+
+// USER_TYPE_ID_MIN the smallest type id of a user registered serializer, the lower ids are reserved
+const USER_TYPE_ID_MIN int32 = 1000
+
+// Serializer writes and reads the values of one type. the failures are recorded with setError on the output or the
+// input, the later writes and reads are then ignored
+type Serializer interface {
+
+	// write writes the value to the output
+	write(out *ObjectDataOutput, value interface{})
+
+	// read reads a value written by write
+	read(in *ObjectDataInput) interface{}
+}
+
+// funcSerializer a Serializer made of a write and a read function
+type funcSerializer struct {
+	writeFn func(out *ObjectDataOutput, value interface{})
+	readFn  func(in *ObjectDataInput) interface{}
+}
+
+// NewSerializer return a Serializer that uses the given functions
+func NewSerializer(writeFn func(out *ObjectDataOutput, value interface{}), readFn func(in *ObjectDataInput) interface{}) Serializer {
+	return funcSerializer{writeFn: writeFn, readFn: readFn}
+}
+
+func (s funcSerializer) write(out *ObjectDataOutput, value interface{}) {
+	s.writeFn(out, value)
+}
+
+func (s funcSerializer) read(in *ObjectDataInput) interface{} {
+	return s.readFn(in)
+}
+
+// ObjectDataOutput the output a Serializer writes to. the numbers are written in a fixed byte order, so the same value
+// is always encoded to the same bytes
+type ObjectDataOutput struct {
+	registry *SerializerRegistry
+	buf      []byte
+	err      error
+}
+
+// setError records the failure of a serializer, the first one is kept
+func (o *ObjectDataOutput) setError(err error) {
+	if o.err == nil {
+		o.err = err
+	}
+}
+
+func (o *ObjectDataOutput) writeByte(b byte) {
+	o.buf = append(o.buf, b)
+}
+
+func (o *ObjectDataOutput) writeBool(b bool) {
+	if b {
+		o.writeByte(1)
+	} else {
+		o.writeByte(0)
+	}
+}
+
+// writeVarint writes the signed number in the zig-zag variable length encoding
+func (o *ObjectDataOutput) writeVarint(v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+	o.buf = append(o.buf, buf[:n]...)
+}
+
+// writeUvarint writes the unsigned number in the variable length encoding
+func (o *ObjectDataOutput) writeUvarint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	o.buf = append(o.buf, buf[:n]...)
+}
+
+func (o *ObjectDataOutput) writeFloat32(v float32) {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], math.Float32bits(v))
+	o.buf = append(o.buf, buf[:]...)
+}
+
+func (o *ObjectDataOutput) writeFloat64(v float64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], math.Float64bits(v))
+	o.buf = append(o.buf, buf[:]...)
+}
+
+// writeBytes writes the length followed by the bytes
+func (o *ObjectDataOutput) writeBytes(b []byte) {
+	o.writeUvarint(uint64(len(b)))
+	o.buf = append(o.buf, b...)
+}
+
+func (o *ObjectDataOutput) writeString(s string) {
+	o.writeUvarint(uint64(len(s)))
+	o.buf = append(o.buf, s...)
+}
+
+// writeObject writes the type id of the value's serializer followed by the value. the typed tuples are written as
+// the untyped ones
+func (o *ObjectDataOutput) writeObject(value interface{}) {
+	if o.err != nil {
+		return
+	}
+	if item, ok := value.(untypedItem); ok {
+		value = item.asUntyped()
+	}
+	typeId, serializer := o.registry.serializerOf(value)
+	o.writeVarint(int64(typeId))
+	serializer.write(o, value)
+}
+
+// ObjectDataInput the input a Serializer reads from
+type ObjectDataInput struct {
+	registry *SerializerRegistry
+	data     []byte
+	pos      int
+	err      error
+}
+
+// setError records the failure of a serializer, the first one is kept
+func (in *ObjectDataInput) setError(err error) {
+	if in.err == nil {
+		in.err = err
+	}
+}
+
+// next return the next n bytes, nil if there are less left
+func (in *ObjectDataInput) next(n int) []byte {
+	if in.err != nil {
+		return nil
+	}
+	if n < 0 || len(in.data)-in.pos < n {
+		in.setError(io.ErrUnexpectedEOF)
+		return nil
+	}
+	b := in.data[in.pos : in.pos+n]
+	in.pos += n
+	return b
+}
+
+func (in *ObjectDataInput) readByte() byte {
+	if b := in.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (in *ObjectDataInput) readBool() bool {
+	return in.readByte() != 0
+}
+
+func (in *ObjectDataInput) readVarint() int64 {
+	if in.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(in.data[in.pos:])
+	if n <= 0 {
+		in.setError(io.ErrUnexpectedEOF)
+		return 0
+	}
+	in.pos += n
+	return v
+}
+
+func (in *ObjectDataInput) readUvarint() uint64 {
+	if in.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(in.data[in.pos:])
+	if n <= 0 {
+		in.setError(io.ErrUnexpectedEOF)
+		return 0
+	}
+	in.pos += n
+	return v
+}
+
+func (in *ObjectDataInput) readFloat32() float32 {
+	if b := in.next(4); b != nil {
+		return math.Float32frombits(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (in *ObjectDataInput) readFloat64() float64 {
+	if b := in.next(8); b != nil {
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// readBytes reads bytes written by writeBytes, the returned slice is a copy
+func (in *ObjectDataInput) readBytes() []byte {
+	b := in.next(int(in.readUvarint()))
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+func (in *ObjectDataInput) readString() string {
+	return string(in.next(int(in.readUvarint())))
+}
+
+// readObject reads a value written by writeObject
+func (in *ObjectDataInput) readObject() interface{} {
+	typeId := int32(in.readVarint())
+	if in.err != nil {
+		return nil
+	}
+	serializer, ok := in.registry.serializerOfId(typeId)
+	if !ok {
+		in.setError(fmt.Errorf("no serializer registered for type id %d", typeId))
+		return nil
+	}
+	return serializer.read(in)
+}
+
+// SerializerRegistry encodes the items sent over the distributed edges and the snapshot state. it has serializers for
+// the basic types, []interface{}, Tuple2, Tuple3, MapEntry, *Watermark, *LongAccumulator and *DoubleAccumulator,
+// other types get a serializer with register. the values of the types without a serializer are written by the
+// fallback, gob by default. all members must have the same serializers registered before the jobs start
+type SerializerRegistry struct {
+	byType   map[reflect.Type]int32
+	byId     map[int32]Serializer
+	fallback Serializer
+}
+
+func NewSerializerRegistry() *SerializerRegistry {
+	r := &SerializerRegistry{
+		byType:   make(map[reflect.Type]int32),
+		byId:     make(map[int32]Serializer),
+		fallback: NewGobFallback(),
+	}
+	r.registerBuiltins()
+	return r
+}
+
+// register sets the serializer of the prototype's type, typeId must be at least USER_TYPE_ID_MIN and not used yet
+func (r *SerializerRegistry) register(typeId int32, prototype interface{}, serializer Serializer) *SerializerRegistry {
+	if typeId < USER_TYPE_ID_MIN {
+		panic(fmt.Sprintf("Type id %d is reserved, the user type ids start from %d", typeId, USER_TYPE_ID_MIN))
+	}
+	r.add(typeId, prototype, serializer)
+	return r
+}
+
+// setFallback sets the serializer of the values whose type has no serializer, see NewGobFallback and NewJsonFallback
+func (r *SerializerRegistry) setFallback(fallback Serializer) *SerializerRegistry {
+	r.fallback = fallback
+	return r
+}
+
+func (r *SerializerRegistry) add(typeId int32, prototype interface{}, serializer Serializer) {
+	t := reflect.TypeOf(prototype)
+	if _, ok := r.byId[typeId]; ok {
+		panic(fmt.Sprintf("Type id %d is already registered", typeId))
+	}
+	if _, ok := r.byType[t]; ok {
+		panic(fmt.Sprintf("Type %v already has a serializer", t))
+	}
+	r.byType[t] = typeId
+	r.byId[typeId] = serializer
+}
+
+// serializerOf return the type id and the serializer of the value
+func (r *SerializerRegistry) serializerOf(value interface{}) (int32, Serializer) {
+	if value == nil {
+		return NIL_TYPE_ID, r.byId[NIL_TYPE_ID]
+	}
+	if typeId, ok := r.byType[reflect.TypeOf(value)]; ok {
+		return typeId, r.byId[typeId]
+	}
+	return FALLBACK_TYPE_ID, r.fallback
+}
+
+func (r *SerializerRegistry) serializerOfId(typeId int32) (Serializer, bool) {
+	if typeId == FALLBACK_TYPE_ID {
+		return r.fallback, true
+	}
+	serializer, ok := r.byId[typeId]
+	return serializer, ok
+}
+
+// serialize encodes the value
+func (r *SerializerRegistry) serialize(value interface{}) ([]byte, error) {
+	out := &ObjectDataOutput{registry: r}
+	out.writeObject(value)
+	return out.buf, out.err
+}
+
+// deserialize decodes a value encoded by serialize
+func (r *SerializerRegistry) deserialize(data []byte) (interface{}, error) {
+	in := &ObjectDataInput{registry: r, data: data}
+	value := in.readObject()
+	return value, in.finish()
+}
+
+// serializeBatch encodes the items of a DATA_PACKET, an empty batch is encoded to no bytes
+func (r *SerializerRegistry) serializeBatch(items []interface{}) ([]byte, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	out := &ObjectDataOutput{registry: r}
+	out.writeUvarint(uint64(len(items)))
+	for _, item := range items {
+		out.writeObject(item)
+	}
+	return out.buf, out.err
+}
+
+// deserializeBatch decodes the items encoded by serializeBatch
+func (r *SerializerRegistry) deserializeBatch(data []byte) ([]interface{}, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	in := &ObjectDataInput{registry: r, data: data}
+	count := in.readUvarint()
+	var items []interface{}
+	for i := uint64(0); i < count && in.err == nil; i++ {
+		items = append(items, in.readObject())
+	}
+	return items, in.finish()
+}
+
+// finish return the error of the input, the data must have been read completely
+func (in *ObjectDataInput) finish() error {
+	if in.err == nil && in.pos != len(in.data) {
+		in.setError(fmt.Errorf("%d bytes left after the value", len(in.data)-in.pos))
+	}
+	return in.err
+}
+
+func (r *SerializerRegistry) registerBuiltins() {
+	r.add(NIL_TYPE_ID, nil, NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+	}, func(in *ObjectDataInput) interface{} {
+		return nil
+	}))
+	r.add(BOOL_TYPE_ID, false, NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		out.writeBool(value.(bool))
+	}, func(in *ObjectDataInput) interface{} {
+		return in.readBool()
+	}))
+	r.add(INT_TYPE_ID, 0, NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		out.writeVarint(int64(value.(int)))
+	}, func(in *ObjectDataInput) interface{} {
+		return int(in.readVarint())
+	}))
+	r.add(INT8_TYPE_ID, int8(0), NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		out.writeVarint(int64(value.(int8)))
+	}, func(in *ObjectDataInput) interface{} {
+		return int8(in.readVarint())
+	}))
+	r.add(INT16_TYPE_ID, int16(0), NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		out.writeVarint(int64(value.(int16)))
+	}, func(in *ObjectDataInput) interface{} {
+		return int16(in.readVarint())
+	}))
+	r.add(INT32_TYPE_ID, int32(0), NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		out.writeVarint(int64(value.(int32)))
+	}, func(in *ObjectDataInput) interface{} {
+		return int32(in.readVarint())
+	}))
+	r.add(INT64_TYPE_ID, int64(0), NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		out.writeVarint(value.(int64))
+	}, func(in *ObjectDataInput) interface{} {
+		return in.readVarint()
+	}))
+	r.add(UINT_TYPE_ID, uint(0), NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		out.writeUvarint(uint64(value.(uint)))
+	}, func(in *ObjectDataInput) interface{} {
+		return uint(in.readUvarint())
+	}))
+	r.add(UINT8_TYPE_ID, uint8(0), NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		out.writeByte(value.(uint8))
+	}, func(in *ObjectDataInput) interface{} {
+		return in.readByte()
+	}))
+	r.add(UINT16_TYPE_ID, uint16(0), NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		out.writeUvarint(uint64(value.(uint16)))
+	}, func(in *ObjectDataInput) interface{} {
+		return uint16(in.readUvarint())
+	}))
+	r.add(UINT32_TYPE_ID, uint32(0), NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		out.writeUvarint(uint64(value.(uint32)))
+	}, func(in *ObjectDataInput) interface{} {
+		return uint32(in.readUvarint())
+	}))
+	r.add(UINT64_TYPE_ID, uint64(0), NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		out.writeUvarint(value.(uint64))
+	}, func(in *ObjectDataInput) interface{} {
+		return in.readUvarint()
+	}))
+	r.add(FLOAT32_TYPE_ID, float32(0), NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		out.writeFloat32(value.(float32))
+	}, func(in *ObjectDataInput) interface{} {
+		return in.readFloat32()
+	}))
+	r.add(FLOAT64_TYPE_ID, float64(0), NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		out.writeFloat64(value.(float64))
+	}, func(in *ObjectDataInput) interface{} {
+		return in.readFloat64()
+	}))
+	r.add(STRING_TYPE_ID, "", NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		out.writeString(value.(string))
+	}, func(in *ObjectDataInput) interface{} {
+		return in.readString()
+	}))
+	r.add(BYTES_TYPE_ID, []byte{}, NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		out.writeBytes(value.([]byte))
+	}, func(in *ObjectDataInput) interface{} {
+		return in.readBytes()
+	}))
+	r.add(SLICE_TYPE_ID, []interface{}{}, NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		items := value.([]interface{})
+		out.writeUvarint(uint64(len(items)))
+		for _, item := range items {
+			out.writeObject(item)
+		}
+	}, func(in *ObjectDataInput) interface{} {
+		count := in.readUvarint()
+		items := make([]interface{}, 0)
+		for i := uint64(0); i < count && in.err == nil; i++ {
+			items = append(items, in.readObject())
+		}
+		return items
+	}))
+	r.add(TUPLE2_TYPE_ID, Tuple2{}, NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		t := value.(Tuple2)
+		out.writeObject(t.f0)
+		out.writeObject(t.f1)
+	}, func(in *ObjectDataInput) interface{} {
+		f0 := in.readObject()
+		return NewTuple2(f0, in.readObject())
+	}))
+	r.add(TUPLE3_TYPE_ID, Tuple3{}, NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		t := value.(Tuple3)
+		out.writeObject(t.f0)
+		out.writeObject(t.f1)
+		out.writeObject(t.f2)
+	}, func(in *ObjectDataInput) interface{} {
+		f0 := in.readObject()
+		f1 := in.readObject()
+		return NewTuple3(f0, f1, in.readObject())
+	}))
+	r.add(MAP_ENTRY_TYPE_ID, MapEntry{}, NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		entry := value.(MapEntry)
+		out.writeObject(entry.key)
+		out.writeObject(entry.value)
+	}, func(in *ObjectDataInput) interface{} {
+		key := in.readObject()
+		return MapEntry{key: key, value: in.readObject()}
+	}))
+	r.add(WATERMARK_TYPE_ID, &Watermark{}, NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		out.writeVarint(value.(*Watermark).timestamp)
+	}, func(in *ObjectDataInput) interface{} {
+		timestamp := in.readVarint()
+		if timestamp == IDLE_MESSAGE.timestamp {
+			return IDLE_MESSAGE
+		}
+		return NewWatermark(timestamp)
+	}))
+	r.add(LONG_ACCUMULATOR_TYPE_ID, &LongAccumulator{}, NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		out.writeVarint(value.(*LongAccumulator).value)
+	}, func(in *ObjectDataInput) interface{} {
+		return NewLongAccumulatorWithValue(in.readVarint())
+	}))
+	r.add(DOUBLE_ACCUMULATOR_TYPE_ID, &DoubleAccumulator{}, NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		out.writeFloat64(value.(*DoubleAccumulator).value)
+	}, func(in *ObjectDataInput) interface{} {
+		return &DoubleAccumulator{value: in.readFloat64()}
+	}))
+	r.add(TIMESTAMPED_ITEM_TYPE_ID, TimestampedItem{}, NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		timestamped := value.(TimestampedItem)
+		out.writeObject(timestamped.item)
+		out.writeVarint(timestamped.timestamp)
+	}, func(in *ObjectDataInput) interface{} {
+		item := in.readObject()
+		return NewTimestampedItem(item, in.readVarint())
+	}))
+	r.add(KEYED_WINDOW_RESULT_TYPE_ID, KeyedWindowResult{}, NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		result := value.(KeyedWindowResult)
+		out.writeVarint(result.start)
+		out.writeVarint(result.end)
+		out.writeObject(result.key)
+		out.writeObject(result.result)
+		out.writeBool(result.isEarly)
+	}, func(in *ObjectDataInput) interface{} {
+		start := in.readVarint()
+		end := in.readVarint()
+		key := in.readObject()
+		result := in.readObject()
+		return NewKeyedWindowResult(start, end, key, result, in.readBool())
+	}))
+	r.add(BROADCAST_KEY_TYPE_ID, BroadcastKey{}, NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		out.writeObject(value.(BroadcastKey).key)
+	}, func(in *ObjectDataInput) interface{} {
+		return NewBroadcastKey(in.readObject())
+	}))
+}
+
+// gobFallback encodes the values with gob, their concrete types must be registered with gob.Register
+type gobFallback struct {
+}
+
+// NewGobFallback return the fallback serializer that encodes the values with gob. the concrete types must be
+// registered with gob.Register and only their exported fields are encoded
+func NewGobFallback() Serializer {
+	return gobFallback{}
+}
+
+func (gobFallback) write(out *ObjectDataOutput, value interface{}) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&value); err != nil {
+		out.setError(fmt.Errorf("failed to encode %T with gob: %v", value, err))
+		return
+	}
+	out.writeBytes(buf.Bytes())
+}
+
+func (gobFallback) read(in *ObjectDataInput) interface{} {
+	data := in.next(int(in.readUvarint()))
+	if data == nil {
+		return nil
+	}
+	var value interface{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value); err != nil {
+		in.setError(fmt.Errorf("failed to decode with gob: %v", err))
+		return nil
+	}
+	return value
+}
+
+// jsonFallback encodes the values as JSON preceded by the name of their type
+type jsonFallback struct {
+	types map[string]reflect.Type
+}
+
+// NewJsonFallback return the fallback serializer that encodes the values as JSON. only the values of the types of the
+// prototypes can be decoded, the values of other types fail to encode
+func NewJsonFallback(prototypes ...interface{}) Serializer {
+	s := jsonFallback{types: make(map[string]reflect.Type)}
+	for _, prototype := range prototypes {
+		t := reflect.TypeOf(prototype)
+		s.types[t.String()] = t
+	}
+	return s
+}
+
+func (s jsonFallback) write(out *ObjectDataOutput, value interface{}) {
+	name := reflect.TypeOf(value).String()
+	if _, ok := s.types[name]; !ok {
+		out.setError(fmt.Errorf("type %s is not registered with the JSON fallback", name))
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		out.setError(fmt.Errorf("failed to encode %s as JSON: %v", name, err))
+		return
+	}
+	out.writeString(name)
+	out.writeBytes(data)
+}
+
+func (s jsonFallback) read(in *ObjectDataInput) interface{} {
+	name := in.readString()
+	data := in.next(int(in.readUvarint()))
+	if data == nil {
+		return nil
+	}
+	t, ok := s.types[name]
+	if !ok {
+		in.setError(fmt.Errorf("type %s is not registered with the JSON fallback", name))
+		return nil
+	}
+	isPtr := t.Kind() == reflect.Ptr
+	if isPtr {
+		t = t.Elem()
+	}
+	value := reflect.New(t)
+	if err := json.Unmarshal(data, value.Interface()); err != nil {
+		in.setError(fmt.Errorf("failed to decode %s from JSON: %v", name, err))
+		return nil
+	}
+	if isPtr {
+		return value.Interface()
+	}
+	return value.Elem().Interface()
+}
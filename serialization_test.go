@@ -0,0 +1,143 @@
+package stream_processing
+
+import (
+	"encoding/gob"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type SerializationTest struct {
+	registry *SerializerRegistry
+}
+
+func SerializationTestSetup(tb testing.TB) (func(tb testing.TB), SerializationTest) {
+	st := SerializationTest{}
+	st.registry = NewSerializerRegistry()
+
+	return func(tb testing.TB) {
+		tb.Log("SerializationTestSetup teardown")
+	}, st
+}
+
+func (st SerializationTest) roundTrip(tb testing.TB, value interface{}) interface{} {
+	data, err := st.registry.serialize(value)
+	assert.NoError(tb, err)
+	result, err := st.registry.deserialize(data)
+	assert.NoError(tb, err)
+	return result
+}
+
+// point a user type with unexported fields, it needs a registered serializer
+type point struct {
+	x, y int
+}
+
+// GobEvent a user type encoded by the gob fallback
+type GobEvent struct {
+	Name  string
+	Count int
+}
+
+// JsonEvent a user type encoded by the JSON fallback
+type JsonEvent struct {
+	Name string `json:"name"`
+}
+
+func init() {
+	gob.Register(GobEvent{})
+}
+
+func TestSerializerRegistry_when_builtinTypes_then_roundTrip(t *testing.T) {
+	teardownTest, st := SerializationTestSetup(t)
+	defer teardownTest(t)
+
+	values := []interface{}{
+		nil, true, -7, int8(-8), int16(300), int32(-70000), int64(1) << 40,
+		uint(7), uint8(255), uint16(65535), uint32(1) << 31, uint64(1) << 63,
+		float32(1.5), 3.25, "", "text", []byte("bytes"), []interface{}{1, "a", nil}, []interface{}{},
+		NewTuple2("key", int64(3)), NewTuple3(1, NewTuple2(2, 3), "c"),
+		MapEntry{key: "k", value: []interface{}{1.5}}, NewWatermark(42),
+		NewLongAccumulatorWithValue(-5), &DoubleAccumulator{value: 0.5}, NewBroadcastKey(NewTuple2("k", 1)),
+	}
+	for _, value := range values {
+		assert.Equal(t, value, st.roundTrip(t, value))
+	}
+	assert.Same(t, IDLE_MESSAGE, st.roundTrip(t, IDLE_MESSAGE))
+}
+
+func TestSerializerRegistry_when_sameValue_then_sameBytes(t *testing.T) {
+	teardownTest, st := SerializationTestSetup(t)
+	defer teardownTest(t)
+
+	data, err := st.registry.serialize(NewTuple2("a", int64(-1)))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{byte(TUPLE2_TYPE_ID * 2), byte(STRING_TYPE_ID * 2), 1, 'a', byte(INT64_TYPE_ID * 2), 1}, data)
+	again, _ := NewSerializerRegistry().serialize(NewTuple2("a", int64(-1)))
+	assert.Equal(t, data, again)
+}
+
+func TestSerializerRegistry_when_userSerializerRegistered_then_usedForNestedValues(t *testing.T) {
+	teardownTest, st := SerializationTestSetup(t)
+	defer teardownTest(t)
+	st.registry.register(USER_TYPE_ID_MIN, point{}, NewSerializer(func(out *ObjectDataOutput, value interface{}) {
+		p := value.(point)
+		out.writeVarint(int64(p.x))
+		out.writeVarint(int64(p.y))
+	}, func(in *ObjectDataInput) interface{} {
+		x := in.readVarint()
+		return point{x: int(x), y: int(in.readVarint())}
+	}))
+
+	assert.Equal(t, NewTuple2(point{1, 2}, point{-3, 4}), st.roundTrip(t, NewTuple2(point{1, 2}, point{-3, 4})))
+	assert.Panics(t, func() {
+		st.registry.register(USER_TYPE_ID_MIN, "", NewGobFallback())
+	})
+	assert.Panics(t, func() {
+		st.registry.register(USER_TYPE_ID_MIN-1, struct{}{}, NewGobFallback())
+	})
+}
+
+func TestSerializerRegistry_when_noSerializer_then_fallbackUsed(t *testing.T) {
+	teardownTest, st := SerializationTestSetup(t)
+	defer teardownTest(t)
+
+	assert.Equal(t, GobEvent{Name: "a", Count: 2}, st.roundTrip(t, GobEvent{Name: "a", Count: 2}))
+	_, err := st.registry.serialize(NewTuple2(1, point{}))
+	assert.Error(t, err)
+
+	st.registry.setFallback(NewJsonFallback(&JsonEvent{}))
+	assert.Equal(t, &JsonEvent{Name: "b"}, st.roundTrip(t, &JsonEvent{Name: "b"}))
+	_, err = st.registry.serialize(JsonEvent{})
+	assert.Error(t, err)
+}
+
+func TestSerializerRegistry_when_invalidData_then_error(t *testing.T) {
+	teardownTest, st := SerializationTestSetup(t)
+	defer teardownTest(t)
+
+	data, _ := st.registry.serialize("text")
+	_, err := st.registry.deserialize(data[:len(data)-1])
+	assert.Error(t, err)
+	_, err = st.registry.deserialize(append(data, 0))
+	assert.Error(t, err)
+	unknown := &ObjectDataOutput{}
+	unknown.writeVarint(int64(USER_TYPE_ID_MIN))
+	_, err = st.registry.deserialize(unknown.buf)
+	assert.Error(t, err)
+}
+
+func TestSerializerRegistry_when_batch_then_roundTrip(t *testing.T) {
+	teardownTest, st := SerializationTestSetup(t)
+	defer teardownTest(t)
+
+	data, err := st.registry.serializeBatch(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+	items := []interface{}{NewTuple2(1, 2), "a", MapEntry{key: 1, value: nil}}
+	data, err = st.registry.serializeBatch(items)
+	assert.NoError(t, err)
+	result, err := st.registry.deserializeBatch(data)
+	assert.NoError(t, err)
+	assert.Equal(t, items, result)
+}
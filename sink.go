@@ -0,0 +1,18 @@
+package stream_processing
+
+// WriteFnSinkP sink processor that passes each received item to writeFn
+type WriteFnSinkP struct {
+	*AbstractProcessor
+	writeFn AcceptFn
+}
+
+func NewWriteFnSinkP(writeFn AcceptFn) *WriteFnSinkP {
+	p := &WriteFnSinkP{writeFn: writeFn}
+	p.AbstractProcessor = NewAbstractProcessor(p)
+	return p
+}
+
+func (p *WriteFnSinkP) tryProcess(ordinal int, item interface{}) bool {
+	p.writeFn(item)
+	return true
+}
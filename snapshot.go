@@ -0,0 +1,263 @@
+package stream_processing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NO_SNAPSHOT the snapshot id that stands for no snapshot, the ids of the snapshots of a job start from 1
+const NO_SNAPSHOT = int64(0)
+
+// SnapshotBarrier separates the items emitted before a snapshot from the items emitted after it. the sources emit it
+// after they saved their state, every other processor saves its state when the barrier arrived on all its inputs
+// and then forwards it
+type SnapshotBarrier struct {
+	snapshotId int64
+}
+
+func NewSnapshotBarrier(snapshotId int64) *SnapshotBarrier {
+	return &SnapshotBarrier{snapshotId: snapshotId}
+}
+
+// Snapshot the state the processors of a job saved for one snapshot, the entries of all the processors of a vertex
+// are kept together
+type Snapshot struct {
+	id     int64
+	states map[string][]MapEntry
+}
+
+func NewSnapshot(id int64) *Snapshot {
+	return &Snapshot{id: id, states: make(map[string][]MapEntry)}
+}
+
+// getId return the id of the snapshot
+func (s *Snapshot) getId() int64 {
+	return s.id
+}
+
+// getState return the entries saved by the processors of the vertex
+func (s *Snapshot) getState(vertexName string) []MapEntry {
+	return s.states[vertexName]
+}
+
+// addState adds the entries saved by processors of the vertex
+func (s *Snapshot) addState(vertexName string, entries []MapEntry) {
+	s.states[vertexName] = append(s.states[vertexName], entries...)
+}
+
+type snapshotPhase int
+
+const (
+	// IDLE_PHASE no snapshot is in progress
+	IDLE_PHASE snapshotPhase = iota
+
+	// SAVE_PHASE the processors save their state and forward the barrier
+	SAVE_PHASE
+
+	// COMMIT_PHASE the snapshot is complete on all members, the processors commit it
+	COMMIT_PHASE
+)
+
+// SnapshotContext the snapshot in progress on one member. the coordinator of the job starts the phases of a snapshot,
+// the processor tasklets of the member report when they finished them
+type SnapshotContext struct {
+	// activeSnapshotId the snapshot the sources must take, commitSnapshotId the snapshot the processors must commit.
+	// the tasklets read them without locking
+	activeSnapshotId int64
+	commitSnapshotId int64
+	commitSuccess    int32
+
+	// registry copies the entries the processors saved, they go on changing their state once they saved it
+	registry *SerializerRegistry
+
+	mu           sync.Mutex
+	liveTasklets int
+	phase        snapshotPhase
+	snapshotId   int64
+	remaining    int
+	phaseDone    chan struct{}
+	snapshot     *Snapshot
+}
+
+func NewSnapshotContext(taskletCount int, registry *SerializerRegistry) *SnapshotContext {
+	return &SnapshotContext{liveTasklets: taskletCount, registry: registry}
+}
+
+// getActiveSnapshotId return the id of the latest snapshot the sources were asked to take
+func (c *SnapshotContext) getActiveSnapshotId() int64 {
+	return atomic.LoadInt64(&c.activeSnapshotId)
+}
+
+// getCommitSnapshotId return the id of the latest snapshot the processors were asked to commit and whether it succeeded
+func (c *SnapshotContext) getCommitSnapshotId() (int64, bool) {
+	return atomic.LoadInt64(&c.commitSnapshotId), atomic.LoadInt32(&c.commitSuccess) == 1
+}
+
+// beginSnapshot prepares the member for the snapshot, the returned channel is closed when all its tasklets saved the
+// state. it must be called on all members before the snapshot is requested from any of them, otherwise a barrier
+// could arrive at a member that doesn't expect it yet
+func (c *SnapshotContext) beginSnapshot(snapshot *Snapshot) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.snapshot = snapshot
+	return c.beginPhase(SAVE_PHASE, snapshot.id)
+}
+
+// requestSnapshot asks the sources to save their state and emit the barrier
+func (c *SnapshotContext) requestSnapshot(snapshotId int64) {
+	atomic.StoreInt64(&c.activeSnapshotId, snapshotId)
+}
+
+// beginCommit asks the processors to commit the snapshot, the returned channel is closed when all of them did
+func (c *SnapshotContext) beginCommit(snapshotId int64, success bool) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	done := c.beginPhase(COMMIT_PHASE, snapshotId)
+	if success {
+		atomic.StoreInt32(&c.commitSuccess, 1)
+	} else {
+		atomic.StoreInt32(&c.commitSuccess, 0)
+	}
+	atomic.StoreInt64(&c.commitSnapshotId, snapshotId)
+	return done
+}
+
+func (c *SnapshotContext) beginPhase(phase snapshotPhase, snapshotId int64) <-chan struct{} {
+	c.phase = phase
+	c.snapshotId = snapshotId
+	c.remaining = c.liveTasklets
+	c.phaseDone = make(chan struct{})
+	c.checkPhaseDone()
+	return c.phaseDone
+}
+
+// snapshotDone called by a tasklet after it saved the state of its processor and emitted the barrier. the entries are
+// copied before the processor goes on, an entry that can't be serialized fails the tasklet
+func (c *SnapshotContext) snapshotDone(vertexName string, entries []MapEntry) {
+	entries = c.copyEntries(vertexName, entries)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.snapshot.addState(vertexName, entries)
+	c.remaining--
+	c.checkPhaseDone()
+}
+
+// copyEntries returns a deep copy of the entries made by serializing and deserializing them
+func (c *SnapshotContext) copyEntries(vertexName string, entries []MapEntry) []MapEntry {
+	items := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		items[i] = entry
+	}
+	data, err := c.registry.serializeBatch(items)
+	if err == nil {
+		items, err = c.registry.deserializeBatch(data)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("failed to copy the snapshot state of vertex %s: %v", vertexName, err))
+	}
+	copied := make([]MapEntry, len(items))
+	for i, item := range items {
+		copied[i] = item.(MapEntry)
+	}
+	return copied
+}
+
+// commitDone called by a tasklet after its processor committed the snapshot
+func (c *SnapshotContext) commitDone() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remaining--
+	c.checkPhaseDone()
+}
+
+// taskletDone called by a tasklet after its processor completed, it takes no part in the later snapshots.
+// savedSnapshotId and committedSnapshotId are the last snapshot it saved and committed
+func (c *SnapshotContext) taskletDone(savedSnapshotId, committedSnapshotId int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.liveTasklets--
+	if c.phase == SAVE_PHASE && savedSnapshotId < c.snapshotId || c.phase == COMMIT_PHASE && committedSnapshotId < c.snapshotId {
+		c.remaining--
+		c.checkPhaseDone()
+	}
+}
+
+func (c *SnapshotContext) checkPhaseDone() {
+	if c.remaining == 0 && c.phase != IDLE_PHASE {
+		c.phase = IDLE_PHASE
+		close(c.phaseDone)
+	}
+}
+
+// snapshotCoordinator takes the snapshots of a running execution of a job. it periodically injects a barrier at the
+// sources of every member and, once the processors of all members saved their state, lets them commit it. one snapshot
+// is taken at a time. onComplete gets the complete snapshot, it returns whether the snapshot was stored successfully
+type snapshotCoordinator struct {
+	contexts       []*SnapshotContext
+	interval       time.Duration
+	lastSnapshotId int64
+	onComplete     func(snapshot *Snapshot) bool
+}
+
+func newSnapshotCoordinator(contexts []*SnapshotContext, interval time.Duration, lastSnapshotId int64,
+	onComplete func(snapshot *Snapshot) bool) *snapshotCoordinator {
+	return &snapshotCoordinator{contexts: contexts, interval: interval, lastSnapshotId: lastSnapshotId, onComplete: onComplete}
+}
+
+// run takes the snapshots until the context is cancelled
+func (c *snapshotCoordinator) run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !c.takeSnapshot(ctx) {
+				return
+			}
+		}
+	}
+}
+
+// takeSnapshot takes the next snapshot, return false if the context was cancelled before it was committed
+func (c *snapshotCoordinator) takeSnapshot(ctx context.Context) bool {
+	c.lastSnapshotId++
+	snapshot := NewSnapshot(c.lastSnapshotId)
+	phaseDone := make([]<-chan struct{}, len(c.contexts))
+	for i, sc := range c.contexts {
+		// each member collects the entries of its processors, they are merged after the phase
+		phaseDone[i] = sc.beginSnapshot(NewSnapshot(snapshot.id))
+	}
+	for _, sc := range c.contexts {
+		sc.requestSnapshot(snapshot.id)
+	}
+	if !awaitAll(ctx, phaseDone) {
+		return false
+	}
+	for _, sc := range c.contexts {
+		for vertexName, entries := range sc.snapshot.states {
+			snapshot.addState(vertexName, entries)
+		}
+	}
+	success := c.onComplete(snapshot)
+	for i, sc := range c.contexts {
+		phaseDone[i] = sc.beginCommit(snapshot.id, success)
+	}
+	return awaitAll(ctx, phaseDone)
+}
+
+// awaitAll waits until all channels are closed, return false if the context was cancelled first
+func awaitAll(ctx context.Context, channels []<-chan struct{}) bool {
+	for _, ch := range channels {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
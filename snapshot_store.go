@@ -0,0 +1,404 @@
+package stream_processing
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DEFAULT_RETAINED_SNAPSHOT_COUNT the default number of complete snapshots a SnapshotStore keeps for each job
+const DEFAULT_RETAINED_SNAPSHOT_COUNT = 2
+
+// SnapshotStore keeps the snapshots of the jobs by their name, see JobConfig.setName. the entries of a snapshot are put
+// while it is being taken, the snapshot becomes the latest one of the job only when it is completed
+type SnapshotStore interface {
+
+	// put appends the entry a processor of the vertex saved for the snapshot of the job. the processors may save several
+	// entries with an equal key, all of them are kept in the order they were put
+	put(jobName string, snapshotId int64, vertexName string, key, value interface{}) error
+
+	// complete makes the snapshot the latest complete snapshot of the job. only the last retained snapshots are kept,
+	// the older ones and the incomplete ones with lower ids are removed
+	complete(jobName string, snapshotId int64) error
+
+	// latestSnapshotId return the id of the latest complete snapshot of the job, NO_SNAPSHOT if there is none
+	latestSnapshotId(jobName string) (int64, error)
+
+	// get return the value of the last entry put with the key, false if there is none
+	get(jobName string, snapshotId int64, vertexName string, key interface{}) (interface{}, bool, error)
+
+	// entries return the entries stored for the vertex in the order they were put
+	entries(jobName string, snapshotId int64, vertexName string) ([]MapEntry, error)
+}
+
+// vertexStates the entries of a snapshot by vertex name, in the order they were put
+type vertexStates map[string][]MapEntry
+
+func (s vertexStates) put(vertexName string, key, value interface{}) {
+	s[vertexName] = append(s[vertexName], MapEntry{key: key, value: value})
+}
+
+func (s vertexStates) entries(vertexName string) []MapEntry {
+	return s[vertexName]
+}
+
+// lastValue return the value of the last entry with the key
+func lastValue(entries []MapEntry, key interface{}) (interface{}, bool) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].key == key {
+			return entries[i].value, true
+		}
+	}
+	return nil, false
+}
+
+// jobSnapshots the snapshots of one job, complete holds the ids of the complete ones in ascending order
+type jobSnapshots struct {
+	snapshots map[int64]vertexStates
+	complete  []int64
+}
+
+func newJobSnapshots() *jobSnapshots {
+	return &jobSnapshots{snapshots: make(map[int64]vertexStates)}
+}
+
+func (j *jobSnapshots) states(snapshotId int64) vertexStates {
+	states, ok := j.snapshots[snapshotId]
+	if !ok {
+		states = make(vertexStates)
+		j.snapshots[snapshotId] = states
+	}
+	return states
+}
+
+// InMemorySnapshotStore a SnapshotStore that keeps the snapshots in memory, they are lost when the process exits
+type InMemorySnapshotStore struct {
+	retainedCount int
+
+	mu   sync.Mutex
+	jobs map[string]*jobSnapshots
+}
+
+func NewInMemorySnapshotStore(retainedCount int) *InMemorySnapshotStore {
+	if retainedCount <= 0 {
+		panic("Retained snapshot count must be positive")
+	}
+	return &InMemorySnapshotStore{retainedCount: retainedCount, jobs: make(map[string]*jobSnapshots)}
+}
+
+func (s *InMemorySnapshotStore) job(jobName string) *jobSnapshots {
+	job, ok := s.jobs[jobName]
+	if !ok {
+		job = newJobSnapshots()
+		s.jobs[jobName] = job
+	}
+	return job
+}
+
+func (s *InMemorySnapshotStore) put(jobName string, snapshotId int64, vertexName string, key, value interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.job(jobName).states(snapshotId).put(vertexName, key, value)
+	return nil
+}
+
+func (s *InMemorySnapshotStore) complete(jobName string, snapshotId int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.job(jobName)
+	job.states(snapshotId)
+	job.complete = append(job.complete, snapshotId)
+	if len(job.complete) > s.retainedCount {
+		job.complete = job.complete[len(job.complete)-s.retainedCount:]
+	}
+	for id := range job.snapshots {
+		if id < job.complete[0] {
+			delete(job.snapshots, id)
+		}
+	}
+	return nil
+}
+
+func (s *InMemorySnapshotStore) latestSnapshotId(jobName string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.job(jobName)
+	if len(job.complete) == 0 {
+		return NO_SNAPSHOT, nil
+	}
+	return job.complete[len(job.complete)-1], nil
+}
+
+func (s *InMemorySnapshotStore) get(jobName string, snapshotId int64, vertexName string, key interface{}) (interface{}, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := lastValue(s.job(jobName).states(snapshotId).entries(vertexName), key)
+	return value, ok, nil
+}
+
+func (s *InMemorySnapshotStore) entries(jobName string, snapshotId int64, vertexName string) ([]MapEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]MapEntry(nil), s.job(jobName).states(snapshotId).entries(vertexName)...), nil
+}
+
+// LocalDirSnapshotStore a SnapshotStore that writes the snapshots to a local directory. the entries of a snapshot are
+// kept in memory until it is completed, then they are written to a temporary directory that is renamed to
+// job-<escaped jobName>/snapshot-<snapshotId> once all files are synced, so only complete snapshots are ever visible.
+// the entries are encoded with the SerializerRegistry of the store
+type LocalDirSnapshotStore struct {
+	dir           string
+	retainedCount int
+	registry      *SerializerRegistry
+
+	mu      sync.Mutex
+	pending map[string]*jobSnapshots
+}
+
+const (
+	snapshotDirPrefix = "snapshot-"
+	tmpDirSuffix      = ".tmp"
+)
+
+func NewLocalDirSnapshotStore(dir string, retainedCount int) *LocalDirSnapshotStore {
+	if retainedCount <= 0 {
+		panic("Retained snapshot count must be positive")
+	}
+	return &LocalDirSnapshotStore{dir: dir, retainedCount: retainedCount, registry: NewSerializerRegistry(), pending: make(map[string]*jobSnapshots)}
+}
+
+// setSerializerRegistry sets the serializers of the keys and values of the entries
+func (s *LocalDirSnapshotStore) setSerializerRegistry(registry *SerializerRegistry) *LocalDirSnapshotStore {
+	s.registry = registry
+	return s
+}
+
+func (s *LocalDirSnapshotStore) jobDir(jobName string) string {
+	return filepath.Join(s.dir, "job-"+url.PathEscape(jobName))
+}
+
+func (s *LocalDirSnapshotStore) snapshotDir(jobName string, snapshotId int64) string {
+	return filepath.Join(s.jobDir(jobName), fmt.Sprintf("%s%d", snapshotDirPrefix, snapshotId))
+}
+
+// vertexFile return the file of the vertex, the name is escaped to be a valid file name
+func vertexFile(snapshotDir, vertexName string) string {
+	return filepath.Join(snapshotDir, url.PathEscape(vertexName)+".dat")
+}
+
+func (s *LocalDirSnapshotStore) put(jobName string, snapshotId int64, vertexName string, key, value interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.pending[jobName]
+	if !ok {
+		job = newJobSnapshots()
+		s.pending[jobName] = job
+	}
+	job.states(snapshotId).put(vertexName, key, value)
+	return nil
+}
+
+func (s *LocalDirSnapshotStore) complete(jobName string, snapshotId int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var states vertexStates
+	if job, ok := s.pending[jobName]; ok {
+		states = job.states(snapshotId)
+		for id := range job.snapshots {
+			if id <= snapshotId {
+				delete(job.snapshots, id)
+			}
+		}
+	}
+	if err := s.writeSnapshot(jobName, snapshotId, states); err != nil {
+		return err
+	}
+	return s.removeOldSnapshots(jobName)
+}
+
+// writeSnapshot writes the files of the snapshot to the temporary directory and renames it
+func (s *LocalDirSnapshotStore) writeSnapshot(jobName string, snapshotId int64, states vertexStates) error {
+	dir := s.snapshotDir(jobName, snapshotId)
+	tmpDir := dir + tmpDirSuffix
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return err
+	}
+	for vertexName := range states {
+		var records []interface{}
+		for _, entry := range states.entries(vertexName) {
+			records = append(records, entry)
+		}
+		data, err := s.registry.serializeBatch(records)
+		if err != nil {
+			return fmt.Errorf("failed to encode the state of vertex %s: %v", vertexName, err)
+		}
+		if err := writeFileSynced(vertexFile(tmpDir, vertexName), data); err != nil {
+			return err
+		}
+	}
+	if err := syncDir(tmpDir); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpDir, dir); err != nil {
+		return err
+	}
+	return syncDir(s.jobDir(jobName))
+}
+
+// removeOldSnapshots removes the complete snapshots beyond the retained count and the leftover temporary directories
+func (s *LocalDirSnapshotStore) removeOldSnapshots(jobName string) error {
+	ids, err := s.completeSnapshotIds(jobName)
+	if err != nil {
+		return err
+	}
+	if len(ids) <= s.retainedCount {
+		return nil
+	}
+	oldest := ids[len(ids)-s.retainedCount]
+	files, err := os.ReadDir(s.jobDir(jobName))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		id, ok := parseSnapshotDirName(strings.TrimSuffix(file.Name(), tmpDirSuffix))
+		if ok && id < oldest {
+			if err := os.RemoveAll(filepath.Join(s.jobDir(jobName), file.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// completeSnapshotIds return the ids of the complete snapshots of the job in ascending order
+func (s *LocalDirSnapshotStore) completeSnapshotIds(jobName string) ([]int64, error) {
+	files, err := os.ReadDir(s.jobDir(jobName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for _, file := range files {
+		if id, ok := parseSnapshotDirName(file.Name()); ok && file.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids, nil
+}
+
+// parseSnapshotDirName return the snapshot id of the directory name, false if it isn't the directory of a complete snapshot
+func parseSnapshotDirName(name string) (int64, bool) {
+	if !strings.HasPrefix(name, snapshotDirPrefix) {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(name, snapshotDirPrefix), 10, 64)
+	return id, err == nil
+}
+
+func (s *LocalDirSnapshotStore) latestSnapshotId(jobName string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, err := s.completeSnapshotIds(jobName)
+	if err != nil || len(ids) == 0 {
+		return NO_SNAPSHOT, err
+	}
+	return ids[len(ids)-1], nil
+}
+
+func (s *LocalDirSnapshotStore) get(jobName string, snapshotId int64, vertexName string, key interface{}) (interface{}, bool, error) {
+	entries, err := s.entries(jobName, snapshotId, vertexName)
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := lastValue(entries, key)
+	return value, ok, nil
+}
+
+func (s *LocalDirSnapshotStore) entries(jobName string, snapshotId int64, vertexName string) ([]MapEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := os.ReadFile(vertexFile(s.snapshotDir(jobName, snapshotId), vertexName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	records, err := s.registry.deserializeBatch(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the state of vertex %s: %v", vertexName, err)
+	}
+	entries := make([]MapEntry, len(records))
+	for i, record := range records {
+		entries[i] = record.(MapEntry)
+	}
+	return entries, nil
+}
+
+// writeFileSynced writes the file and syncs it to the disk
+func writeFileSynced(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir syncs the directory, so the files created or renamed in it survive a crash
+func syncDir(name string) error {
+	dir, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// loadSnapshot reads the latest complete snapshot of the job from the store, it holds the entries of the vertices of the
+// DAG. return nil if the job has no complete snapshot
+func loadSnapshot(store SnapshotStore, jobName string, dag *DAG) (*Snapshot, error) {
+	snapshotId, err := store.latestSnapshotId(jobName)
+	if err != nil || snapshotId == NO_SNAPSHOT {
+		return nil, err
+	}
+	snapshot := NewSnapshot(snapshotId)
+	for _, v := range dag.iterator() {
+		entries, err := store.entries(jobName, snapshotId, v.name)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.addState(v.name, entries)
+	}
+	return snapshot, nil
+}
+
+// storeSnapshot puts the entries of the snapshot to the store and completes it
+func storeSnapshot(store SnapshotStore, jobName string, snapshot *Snapshot) error {
+	for vertexName, entries := range snapshot.states {
+		for _, entry := range entries {
+			if err := store.put(jobName, snapshot.id, vertexName, entry.key, entry.value); err != nil {
+				return err
+			}
+		}
+	}
+	return store.complete(jobName, snapshot.id)
+}
@@ -0,0 +1,137 @@
+package stream_processing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type SnapshotStoreTest struct {
+	dir    string
+	stores map[string]SnapshotStore
+}
+
+func SnapshotStoreTestSetup(tb testing.TB) (func(tb testing.TB), SnapshotStoreTest) {
+	st := SnapshotStoreTest{}
+	st.dir = tb.TempDir()
+	st.stores = map[string]SnapshotStore{
+		"inMemory": NewInMemorySnapshotStore(2),
+		"localDir": NewLocalDirSnapshotStore(st.dir, 2),
+	}
+
+	return func(tb testing.TB) {
+		tb.Log("SnapshotStoreTestSetup teardown")
+	}, st
+}
+
+func TestSnapshotStore_when_completed_then_latestSnapshotWithEntries(t *testing.T) {
+	teardownTest, st := SnapshotStoreTestSetup(t)
+	defer teardownTest(t)
+
+	for name, store := range st.stores {
+		latest, err := store.latestSnapshotId("word-count")
+		assert.NoError(t, err, name)
+		assert.Equal(t, NO_SNAPSHOT, latest, name)
+
+		assert.NoError(t, store.put("word-count", 1, "v", "a", int64(1)), name)
+		assert.NoError(t, store.put("word-count", 1, "v", "b", int64(2)), name)
+		assert.NoError(t, store.put("word-count", 1, "v", "a", int64(3)), name)
+		latest, _ = store.latestSnapshotId("word-count")
+		assert.Equal(t, NO_SNAPSHOT, latest, name)
+
+		assert.NoError(t, store.complete("word-count", 1), name)
+		latest, _ = store.latestSnapshotId("word-count")
+		assert.Equal(t, int64(1), latest, name)
+		value, ok, err := store.get("word-count", 1, "v", "a")
+		assert.NoError(t, err, name)
+		assert.True(t, ok, name)
+		assert.Equal(t, int64(3), value, name)
+		_, ok, _ = store.get("word-count", 1, "v", "c")
+		assert.False(t, ok, name)
+		entries, err := store.entries("word-count", 1, "v")
+		assert.NoError(t, err, name)
+		assert.Equal(t, []MapEntry{{key: "a", value: int64(1)}, {key: "b", value: int64(2)}, {key: "a", value: int64(3)}}, entries, name)
+
+		latest, _ = store.latestSnapshotId("other")
+		assert.Equal(t, NO_SNAPSHOT, latest, name)
+	}
+}
+
+func TestSnapshotStore_when_moreSnapshotsThanRetained_then_oldestRemoved(t *testing.T) {
+	teardownTest, st := SnapshotStoreTestSetup(t)
+	defer teardownTest(t)
+
+	for name, store := range st.stores {
+		for id := int64(1); id <= 3; id++ {
+			assert.NoError(t, store.put("word-count", id, "v", "a", id), name)
+			assert.NoError(t, store.complete("word-count", id), name)
+		}
+		entries, _ := store.entries("word-count", 1, "v")
+		assert.Empty(t, entries, name)
+		for id := int64(2); id <= 3; id++ {
+			value, ok, _ := store.get("word-count", id, "v", "a")
+			assert.True(t, ok, name)
+			assert.Equal(t, id, value, name)
+		}
+	}
+}
+
+func TestLocalDirSnapshotStore_when_reopened_then_completeSnapshotsOnly(t *testing.T) {
+	teardownTest, st := SnapshotStoreTestSetup(t)
+	defer teardownTest(t)
+	store := st.stores["localDir"]
+	assert.NoError(t, store.put("word-count", 1, "a/b", "key", "value"))
+	assert.NoError(t, store.complete("word-count", 1))
+	assert.NoError(t, store.put("word-count", 2, "a/b", "key", "next"))
+	assert.NoError(t, os.MkdirAll(filepath.Join(st.dir, "job-word-count", "snapshot-3.tmp"), 0755))
+
+	reopened := NewLocalDirSnapshotStore(st.dir, 2)
+	latest, err := reopened.latestSnapshotId("word-count")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), latest)
+	value, ok, err := reopened.get("word-count", 1, "a/b", "key")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "value", value)
+}
+
+func TestSnapshotStore_when_windowedJobRestored_then_sameOutputAsFromSavedEntries(t *testing.T) {
+	teardownTest, st := SnapshotStoreTestSetup(t)
+	defer teardownTest(t)
+	wt := WindowTest{definition: NewSlidingWithPolicy(4, 2)}
+	dag := NewDAG()
+	dag.newVertex("window", nil)
+	restoreAndComplete := func(entries []MapEntry) []interface{} {
+		p, outbox := wt.newSlidingWindowP(0, NO_LATENESS, counting())
+		for _, entry := range entries {
+			p.restoreFromSnapshotWithMapEntry(entry)
+		}
+		assert.True(t, p.finishSnapshotRestore())
+		assert.True(t, p.complete())
+		return outbox.drainQueueAndReset(0)
+	}
+
+	p, outbox := wt.newSlidingWindowP(0, NO_LATENESS, counting())
+	for _, ts := range []int64{3, 5, 7} {
+		assert.True(t, p.tryProcess(0, NewTuple2("a", ts)))
+	}
+	assert.True(t, p.saveToSnapshot())
+	saved := outbox.takeSnapshotEntries()
+	expected := restoreAndComplete(saved)
+	assert.Equal(t, []interface{}{
+		NewKeyedWindowResult(0, 4, "a", int64(1), false), NewKeyedWindowResult(2, 6, "a", int64(2), false),
+		NewKeyedWindowResult(4, 8, "a", int64(2), false), NewKeyedWindowResult(6, 10, "a", int64(1), false),
+	}, expected)
+
+	for name, store := range st.stores {
+		snapshot := NewSnapshot(1)
+		snapshot.addState("window", saved)
+		assert.NoError(t, storeSnapshot(store, "word-count", snapshot), name)
+		loaded, err := loadSnapshot(store, "word-count", dag)
+		assert.NoError(t, err, name)
+		assert.Equal(t, saved, loaded.getState("window"), name)
+		assert.Equal(t, expected, restoreAndComplete(loaded.getState("window")), name)
+	}
+}
@@ -0,0 +1,328 @@
+package stream_processing
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type SnapshotTest struct {
+	cluster *LoopbackCluster
+	queues  []Queue
+	commits int32
+
+	// restoredSource and restoredSink the sum of the state the processors restored
+	restoredSource int64
+	restoredSink   int64
+}
+
+func SnapshotTestSetup(tb testing.TB) (func(tb testing.TB), *SnapshotTest) {
+	st := &SnapshotTest{}
+	store := NewLocalDirSnapshotStore(tb.TempDir(), DEFAULT_RETAINED_SNAPSHOT_COUNT)
+	st.cluster = NewLoopbackCluster(2, NewInstanceConfig().setCooperativeThreadCount(2).setSnapshotStore(store))
+	st.queues = []Queue{NewConveyor(16), NewConveyor(16)}
+	st.queues[0].offer(1)
+	st.queues[0].offer(NewSnapshotBarrier(1))
+	st.queues[0].offer(2)
+	st.queues[1].offer(3)
+	st.queues[1].offer(NewSnapshotBarrier(1))
+
+	return func(tb testing.TB) {
+		st.cluster.shutdown()
+		tb.Log("SnapshotTestSetup teardown")
+	}, st
+}
+
+func (st *SnapshotTest) drain(instream *InboundEdgeStream) []interface{} {
+	var items []interface{}
+	instream.drainTo(func(item interface{}) {
+		items = append(items, item)
+	})
+	return items
+}
+
+// countingSourceP an unbounded source that emits ones and saves how many it emitted
+type countingSourceP struct {
+	*AbstractProcessor
+	key      int
+	emitted  int64
+	restored *int64
+}
+
+func newCountingSourceP(restored *int64) *countingSourceP {
+	p := &countingSourceP{restored: restored}
+	p.AbstractProcessor = NewAbstractProcessor(p)
+	return p
+}
+
+func (p *countingSourceP) init(ctx context.Context, outbox Outbox) {
+	p.AbstractProcessor.init(ctx, outbox)
+	p.key = ProcessorContextOf(ctx).getGlobalProcessorIndex()
+}
+
+func (p *countingSourceP) complete() bool {
+	for i := 0; i < 100; i++ {
+		if !p.tryEmit(-1, int64(1)) {
+			return false
+		}
+		p.emitted++
+	}
+	return false
+}
+
+func (p *countingSourceP) saveToSnapshot() bool {
+	return p.outbox.offerToSnapshot(p.key, p.emitted)
+}
+
+func (p *countingSourceP) restoreFromSnapshotWithMapEntry(entry MapEntry) {
+	p.emitted += entry.value.(int64)
+	atomic.AddInt64(p.restored, entry.value.(int64))
+}
+
+// summingSinkP a sink that sums the received numbers, saves the sum and counts the commits
+type summingSinkP struct {
+	*AbstractProcessor
+	key      int
+	sum      int64
+	commits  *int32
+	restored *int64
+}
+
+func newSummingSinkP(commits *int32, restored *int64) *summingSinkP {
+	p := &summingSinkP{commits: commits, restored: restored}
+	p.AbstractProcessor = NewAbstractProcessor(p)
+	return p
+}
+
+func (p *summingSinkP) init(ctx context.Context, outbox Outbox) {
+	p.AbstractProcessor.init(ctx, outbox)
+	p.key = ProcessorContextOf(ctx).getGlobalProcessorIndex()
+}
+
+func (p *summingSinkP) tryProcess(ordinal int, item interface{}) bool {
+	p.sum += item.(int64)
+	return true
+}
+
+func (p *summingSinkP) saveToSnapshot() bool {
+	return p.outbox.offerToSnapshot(p.key, p.sum)
+}
+
+func (p *summingSinkP) snapshotCommitFinish(success bool) bool {
+	atomic.AddInt32(p.commits, 1)
+	return true
+}
+
+func (p *summingSinkP) restoreFromSnapshotWithMapEntry(entry MapEntry) {
+	p.sum += entry.value.(int64)
+	atomic.AddInt64(p.restored, entry.value.(int64))
+}
+
+// countingDag the DAG of countingSourceP instances sending to summingSinkP instances over a distributed edge
+func (st *SnapshotTest) countingDag() *DAG {
+	dag := NewDAG()
+	source := dag.newVertex("source", func() interface{} {
+		return newCountingSourceP(&st.restoredSource)
+	}).setLocalParallelism(2)
+	sink := dag.newVertex("sink", func() interface{} {
+		return newSummingSinkP(&st.commits, &st.restoredSink)
+	}).setLocalParallelism(1)
+	dag.edge(Between(source, sink).distributed())
+	return dag
+}
+
+func sumOfState(entries []MapEntry) int64 {
+	var sum int64
+	for _, entry := range entries {
+		sum += entry.value.(int64)
+	}
+	return sum
+}
+
+func TestInboundEdgeStream_when_waitForAlignment_then_queuesBlockedAfterBarrier(t *testing.T) {
+	teardownTest, st := SnapshotTestSetup(t)
+	defer teardownTest(t)
+	instream := NewInboundEdgeStream(0, 0, st.queues, NewWatermarkCoalescer(2), 0).setWaitForAlignment(true)
+
+	assert.Equal(t, []interface{}{1, 3}, st.drain(instream))
+	assert.Equal(t, int64(1), instream.receivedBarrier())
+	assert.Empty(t, st.drain(instream))
+
+	instream.releaseBarrier()
+	assert.Equal(t, NO_SNAPSHOT, instream.receivedBarrier())
+	assert.Equal(t, []interface{}{2}, st.drain(instream))
+}
+
+func TestInboundEdgeStream_when_notWaitForAlignment_then_queuesDrainedPastBarrier(t *testing.T) {
+	teardownTest, st := SnapshotTestSetup(t)
+	defer teardownTest(t)
+	instream := NewInboundEdgeStream(0, 0, st.queues, NewWatermarkCoalescer(2), 0)
+
+	assert.Equal(t, []interface{}{1, 3}, st.drain(instream))
+	assert.Equal(t, []interface{}{2}, st.drain(instream))
+	assert.Equal(t, int64(1), instream.receivedBarrier())
+}
+
+func TestInboundEdgeStream_when_barrierMissingOnDoneQueue_then_barrierReceived(t *testing.T) {
+	teardownTest, st := SnapshotTestSetup(t)
+	defer teardownTest(t)
+	queues := []Queue{st.queues[1], NewConveyor(4)}
+	queues[1].offer(DONE_ITEM)
+	instream := NewInboundEdgeStream(0, 0, queues, NewWatermarkCoalescer(2), 0).setWaitForAlignment(true)
+
+	st.drain(instream)
+	assert.Equal(t, int64(1), instream.receivedBarrier())
+}
+
+func TestJob_when_exactlyOnce_then_snapshotConsistentAcrossMembers(t *testing.T) {
+	teardownTest, st := SnapshotTestSetup(t)
+	defer teardownTest(t)
+
+	config := NewJobConfig().setProcessingGuarantee(EXACTLY_ONCE).setSnapshotIntervalMillis(10)
+	job := st.cluster.newJobWithConfig(context.Background(), st.countingDag(), config)
+	assert.Eventually(t, func() bool {
+		snapshot := job.getLastSnapshot()
+		return snapshot != nil && snapshot.getId() >= 3 && atomic.LoadInt32(&st.commits) > 0
+	}, 10*time.Second, 5*time.Millisecond)
+	job.Cancel()
+	assert.Equal(t, ErrJobCancelled, job.Join())
+
+	snapshot := job.getLastSnapshot()
+	assert.Len(t, snapshot.getState("source"), 4)
+	assert.Len(t, snapshot.getState("sink"), 2)
+	assert.Equal(t, sumOfState(snapshot.getState("source")), sumOfState(snapshot.getState("sink")))
+}
+
+func TestJob_when_guaranteeNone_then_noSnapshot(t *testing.T) {
+	teardownTest, st := SnapshotTestSetup(t)
+	defer teardownTest(t)
+	dag := NewDAG()
+	dag.newVertex("source", func() interface{} {
+		return NewListSourceP(sequence(10))
+	})
+
+	job := st.cluster.newJobWithConfig(context.Background(), dag, NewJobConfig().setSnapshotIntervalMillis(1))
+	assert.NoError(t, job.Join())
+	assert.Nil(t, job.getLastSnapshot())
+}
+
+func TestJob_when_restarted_then_stateRestoredFromLatestSnapshot(t *testing.T) {
+	teardownTest, st := SnapshotTestSetup(t)
+	defer teardownTest(t)
+
+	config := NewJobConfig().setProcessingGuarantee(EXACTLY_ONCE).setSnapshotIntervalMillis(10)
+	job := st.cluster.newJobWithConfig(context.Background(), st.countingDag(), config)
+	assert.Eventually(t, func() bool {
+		snapshot := job.getLastSnapshot()
+		return snapshot != nil && snapshot.getId() >= 2
+	}, 10*time.Second, 5*time.Millisecond)
+	job.Restart()
+	restartedAfter := job.getLastSnapshot().getId()
+	assert.Eventually(t, func() bool {
+		return job.Status() == RUNNING && job.getLastSnapshot().getId() > restartedAfter+1
+	}, 10*time.Second, 5*time.Millisecond)
+	job.Cancel()
+	assert.Equal(t, ErrJobCancelled, job.Join())
+
+	restoredSource, restoredSink := atomic.LoadInt64(&st.restoredSource), atomic.LoadInt64(&st.restoredSink)
+	assert.True(t, restoredSource > 0)
+	assert.Equal(t, restoredSource, restoredSink)
+	latest, err := st.cluster.members[0].config.snapshotStore.latestSnapshotId(job.snapshotName)
+	assert.NoError(t, err)
+	assert.Equal(t, job.getLastSnapshot().getId(), latest)
+}
+
+// slowMapP a MapP on its own goroutine, so that it can sleep
+type slowMapP struct {
+	*MapP
+}
+
+func (p slowMapP) isCooperative() bool {
+	return false
+}
+
+func TestJob_when_restartedWithExactlyOnce_then_sourceAndGroupStateGiveExactCounts(t *testing.T) {
+	teardownTest, st := SnapshotTestSetup(t)
+	defer teardownTest(t)
+
+	const itemCount = 5000
+	var executions int32
+	var mu sync.Mutex
+	counts := make(map[interface{}]interface{})
+	dag := NewDAG()
+	source := dag.newVertex("source", func() interface{} {
+		atomic.AddInt32(&executions, 1)
+		return NewListSourceP(sequence(itemCount))
+	}).setLocalParallelism(1)
+	slow := dag.newVertex("slow", func() interface{} {
+		return slowMapP{MapP: NewMapP(func(t interface{}) interface{} {
+			time.Sleep(100 * time.Microsecond)
+			return t
+		})}
+	})
+	group := dag.newVertex("group", func() interface{} {
+		return NewGroupP([]ApplyFn{func(t interface{}) interface{} {
+			return t.(int) % 5
+		}}, counting(), func(key, result interface{}) interface{} {
+			return MapEntry{key: key, value: result}
+		})
+	})
+	sink := dag.newVertex("sink", func() interface{} {
+		return NewWriteFnSinkP(func(t interface{}) {
+			mu.Lock()
+			defer mu.Unlock()
+			counts[t.(MapEntry).key] = t.(MapEntry).value
+		})
+	}).setLocalParallelism(1)
+	dag.edge(Between(source, slow)).edge(Between(slow, group).distributed().partitionedByKey(func(t interface{}) interface{} {
+		return t.(int) % 5
+	})).edge(Between(group, sink))
+
+	config := NewJobConfig().setProcessingGuarantee(EXACTLY_ONCE).setSnapshotIntervalMillis(10)
+	job := st.cluster.newJobWithConfig(context.Background(), dag, config)
+	assert.Eventually(t, func() bool {
+		snapshot := job.getLastSnapshot()
+		return snapshot != nil
+	}, 10*time.Second, time.Millisecond)
+	job.Restart()
+	assert.NoError(t, job.Join())
+
+	assert.Equal(t, int32(4), atomic.LoadInt32(&executions), "each of the 2 source processors is created once per execution")
+	expected := make(map[interface{}]interface{})
+	for key := 0; key < 5; key++ {
+		expected[key] = int64(2 * itemCount / 5)
+	}
+	assert.Equal(t, expected, counts)
+}
+
+func TestJob_when_submittedAgainInNewCluster_then_restoredOnlyWithSameName(t *testing.T) {
+	teardownTest, st := SnapshotTestSetup(t)
+	defer teardownTest(t)
+	dir := t.TempDir()
+	newCluster := func() *LoopbackCluster {
+		store := NewLocalDirSnapshotStore(dir, DEFAULT_RETAINED_SNAPSHOT_COUNT)
+		return NewLoopbackCluster(2, NewInstanceConfig().setCooperativeThreadCount(2).setSnapshotStore(store))
+	}
+	runUntilSnapshot := func(cluster *LoopbackCluster, config *JobConfig) {
+		job := cluster.newJobWithConfig(context.Background(), st.countingDag(), config.setProcessingGuarantee(EXACTLY_ONCE).setSnapshotIntervalMillis(10))
+		assert.Eventually(t, func() bool {
+			return job.getLastSnapshot() != nil
+		}, 10*time.Second, 5*time.Millisecond)
+		job.Cancel()
+		assert.Equal(t, ErrJobCancelled, job.Join())
+		cluster.shutdown()
+	}
+
+	runUntilSnapshot(newCluster(), NewJobConfig().setName("counter"))
+	assert.Zero(t, atomic.LoadInt64(&st.restoredSource))
+	runUntilSnapshot(newCluster(), NewJobConfig())
+	assert.Zero(t, atomic.LoadInt64(&st.restoredSource), "a job without the name isn't restored")
+	runUntilSnapshot(newCluster(), NewJobConfig().setName("other"))
+	assert.Zero(t, atomic.LoadInt64(&st.restoredSource), "a job with another name isn't restored")
+	runUntilSnapshot(newCluster(), NewJobConfig().setName("counter"))
+	assert.Positive(t, atomic.LoadInt64(&st.restoredSource), "a job with the same name is restored")
+}
@@ -1 +1,85 @@
 package stream_processing
+
+import "context"
+
+// ListSourceP batch source processor that emits the items of a list and completes. it saves the count of the items it
+// emitted to the snapshots, a restored processor continues after them
+type ListSourceP struct {
+	*AbstractProcessor
+	items []interface{}
+	// taken the count of the items the traverser returned, the last one may still wait in the pendingItem
+	taken     int
+	traverser Traverser
+	index     int
+	// restored whether the count was restored from the snapshot
+	restored bool
+}
+
+func NewListSourceP(items []interface{}) *ListSourceP {
+	p := &ListSourceP{items: items}
+	p.AbstractProcessor = NewAbstractProcessor(p)
+	p.traverser = &untypedTraverser{nextFn: func() (interface{}, bool) {
+		if p.taken >= len(p.items) {
+			return nil, false
+		}
+		p.taken++
+		return p.items[p.taken-1], true
+	}}
+	return p
+}
+
+func (p *ListSourceP) init(ctx context.Context, outbox Outbox) {
+	p.AbstractProcessor.init(ctx, outbox)
+	if c := ProcessorContextOf(ctx); c != nil {
+		p.index = c.getGlobalProcessorIndex()
+	}
+}
+
+func (p *ListSourceP) complete() bool {
+	return p.emitFromTraverser(-1, p.traverser)
+}
+
+// emitted the count of the items the outbox accepted
+func (p *ListSourceP) emitted() int {
+	if p.pendingItem != nil {
+		return p.taken - 1
+	}
+	return p.taken
+}
+
+// saveToSnapshot the count is broadcast, each processor picks its own by its global index
+func (p *ListSourceP) saveToSnapshot() bool {
+	return p.outbox.offerToSnapshot(NewBroadcastKey(p.index), p.emitted())
+}
+
+func (p *ListSourceP) restoreFromSnapshotWithMapEntry(entry MapEntry) {
+	if entry.key.(BroadcastKey).key == p.index {
+		p.taken = entry.value.(int)
+		p.restored = true
+	}
+}
+
+// finishSnapshotRestore a processor without a count completed before the snapshot, the downstream processors had
+// received all its items
+func (p *ListSourceP) finishSnapshotRestore() bool {
+	if !p.restored {
+		p.taken = len(p.items)
+	}
+	return true
+}
+
+// ItemsSourceP a ListSourceP that emits the items from the first processor of the cluster only, the other processors emit nothing
+type ItemsSourceP struct {
+	*ListSourceP
+}
+
+func NewItemsSourceP(items []interface{}) *ItemsSourceP {
+	return &ItemsSourceP{ListSourceP: NewListSourceP(items)}
+}
+
+func (p *ItemsSourceP) init(ctx context.Context, outbox Outbox) {
+	p.ListSourceP.init(ctx, outbox)
+	if c := ProcessorContextOf(ctx); c != nil && c.getGlobalProcessorIndex() != 0 {
+		p.items = nil
+	}
+}
@@ -0,0 +1,651 @@
+package stream_processing
+
+import (
+	"fmt"
+	"time"
+)
+
+// FunctionAdapter adapts the functions of a stage to the items it receives. the items of a stream stage with timestamps
+// are TimestampedItems, the functions receive the wrapped items and their results keep the timestamp
+type FunctionAdapter interface {
+	isTimestamped() bool
+
+	adaptMapFn(mapFn ApplyFn) ApplyFn
+
+	adaptFilterFn(filterFn TestFn) TestFn
+
+	adaptFlatMapFn(flatMapFn ApplyFn) ApplyFn
+
+	adaptStatefulFlatMapFn(flatMapFn TriApplyFn) TriApplyFn
+
+	adaptKeyFn(keyFn ApplyFn) ApplyFn
+
+	adaptTimestampFn(timestampFn ApplyAsLongFn) ApplyAsLongFn
+
+	adaptAggregateOperation(aggrOp AggregateOperation) AggregateOperation
+}
+
+var (
+	// DO_NOT_ADAPT the adapter of the stages whose items have no timestamps
+	DO_NOT_ADAPT FunctionAdapter = doNotAdapt{}
+	// ADAPT_TO_TIMESTAMPED_ITEM the adapter of the stages whose items are TimestampedItems
+	ADAPT_TO_TIMESTAMPED_ITEM FunctionAdapter = timestampedItemAdapter{}
+)
+
+type doNotAdapt struct {
+}
+
+func (a doNotAdapt) isTimestamped() bool {
+	return false
+}
+
+func (a doNotAdapt) adaptMapFn(mapFn ApplyFn) ApplyFn {
+	return mapFn
+}
+
+func (a doNotAdapt) adaptFilterFn(filterFn TestFn) TestFn {
+	return filterFn
+}
+
+func (a doNotAdapt) adaptFlatMapFn(flatMapFn ApplyFn) ApplyFn {
+	return flatMapFn
+}
+
+func (a doNotAdapt) adaptStatefulFlatMapFn(flatMapFn TriApplyFn) TriApplyFn {
+	return flatMapFn
+}
+
+func (a doNotAdapt) adaptKeyFn(keyFn ApplyFn) ApplyFn {
+	return keyFn
+}
+
+func (a doNotAdapt) adaptTimestampFn(timestampFn ApplyAsLongFn) ApplyAsLongFn {
+	return timestampFn
+}
+
+func (a doNotAdapt) adaptAggregateOperation(aggrOp AggregateOperation) AggregateOperation {
+	return aggrOp
+}
+
+type timestampedItemAdapter struct {
+}
+
+func (a timestampedItemAdapter) isTimestamped() bool {
+	return true
+}
+
+// adaptMapFn the result keeps the timestamp of the item, a nil result is still dropped
+func (a timestampedItemAdapter) adaptMapFn(mapFn ApplyFn) ApplyFn {
+	return func(t interface{}) interface{} {
+		timestamped := t.(TimestampedItem)
+		result := mapFn(timestamped.item)
+		if result == nil {
+			return nil
+		}
+		return NewTimestampedItem(result, timestamped.timestamp)
+	}
+}
+
+func (a timestampedItemAdapter) adaptFilterFn(filterFn TestFn) TestFn {
+	return func(t interface{}) bool {
+		return filterFn(t.(TimestampedItem).item)
+	}
+}
+
+func (a timestampedItemAdapter) adaptFlatMapFn(flatMapFn ApplyFn) ApplyFn {
+	return func(t interface{}) interface{} {
+		timestamped := t.(TimestampedItem)
+		traverser, _ := flatMapFn(timestamped.item).(Traverser)
+		if traverser == nil {
+			return nil
+		}
+		return traverser.mapX(func(item interface{}) interface{} {
+			return NewTimestampedItem(item, timestamped.timestamp)
+		})
+	}
+}
+
+// adaptStatefulFlatMapFn the state and the key are passed as they are, the items of the traverser keep the timestamp of the item
+func (a timestampedItemAdapter) adaptStatefulFlatMapFn(flatMapFn TriApplyFn) TriApplyFn {
+	return func(state, key, t interface{}) interface{} {
+		timestamped := t.(TimestampedItem)
+		traverser, _ := flatMapFn(state, key, timestamped.item).(Traverser)
+		if traverser == nil {
+			return nil
+		}
+		return traverser.mapX(func(item interface{}) interface{} {
+			return NewTimestampedItem(item, timestamped.timestamp)
+		})
+	}
+}
+
+// adaptKeyFn a nil keyFn stays nil, it means the items have no key
+func (a timestampedItemAdapter) adaptKeyFn(keyFn ApplyFn) ApplyFn {
+	if keyFn == nil {
+		return nil
+	}
+	return func(t interface{}) interface{} {
+		return keyFn(t.(TimestampedItem).item)
+	}
+}
+
+// adaptTimestampFn a nil timestampFn stays nil, it means the native timestamps are used
+func (a timestampedItemAdapter) adaptTimestampFn(timestampFn ApplyAsLongFn) ApplyAsLongFn {
+	if timestampFn == nil {
+		return nil
+	}
+	return func(t interface{}) int64 {
+		return timestampFn(t.(TimestampedItem).item)
+	}
+}
+
+func (a timestampedItemAdapter) adaptAggregateOperation(aggrOp AggregateOperation) AggregateOperation {
+	accumulateFns := make([]BiAcceptFn, aggrOp.arity())
+	for i := range accumulateFns {
+		accumulateFn := aggrOp.accumulateFn(i)
+		accumulateFns[i] = func(acc, t interface{}) {
+			accumulateFn(acc, t.(TimestampedItem).item)
+		}
+	}
+	return NewAggregateOperationImpl(aggrOp.getCreateFn(), accumulateFns, aggrOp.getCombineFn(), aggrOp.getDeductFn(), aggrOp.getExportFn(), aggrOp.getFinishFn())
+}
+
+// timestampOf the timestamp of a TimestampedItem
+func timestampOf(t interface{}) int64 {
+	return t.(TimestampedItem).timestamp
+}
+
+// AbstractStage the part every stage has, the transform it represents and the pipeline it belongs to
+type AbstractStage struct {
+	transform Transform
+	pipeline  *PipelineImpl
+	// rebalanceOutput whether the input of the stages attached to this one is rebalanced
+	rebalanceOutput bool
+	fnAdapter       FunctionAdapter
+}
+
+func NewAbstractStage(transform Transform, pipeline *PipelineImpl, fnAdapter FunctionAdapter) *AbstractStage {
+	return &AbstractStage{transform: transform, pipeline: pipeline, fnAdapter: fnAdapter}
+}
+
+func (s *AbstractStage) getPipeline() Pipeline {
+	return s.pipeline
+}
+
+func (s *AbstractStage) setLocalParallelism(localParallelism int) {
+	s.transform.setLocalParallelism(localParallelism)
+}
+
+func (s *AbstractStage) setName(name string) {
+	if name == "" {
+		panic("stage name must not be empty")
+	}
+	s.transform.setName(name)
+}
+
+func (s *AbstractStage) name() string {
+	return s.transform.getName()
+}
+
+func (s *AbstractStage) getTransform() Transform {
+	return s.transform
+}
+
+func (s *AbstractStage) abstractStage() *AbstractStage {
+	return s
+}
+
+// abstractStageOf returns the AbstractStage of a stage created by a PipelineImpl
+func abstractStageOf(stage Stage) *AbstractStage {
+	holder, ok := stage.(interface{ abstractStage() *AbstractStage })
+	if !ok {
+		panic(fmt.Sprintf("stage %s wasn't created by a pipeline", stage.name()))
+	}
+	return holder.abstractStage()
+}
+
+// ComputeStage implements the operations BatchStageImpl and StreamStageImpl have in common,
+// newStage wraps the stage of an attached transform into a stage of the same kind
+type ComputeStage struct {
+	*AbstractStage
+	newStage func(stage *AbstractStage) GeneralStage
+}
+
+// attach connects the transform to the output of this stage and returns the stage representing it
+func (s *ComputeStage) attach(transform Transform) GeneralStage {
+	s.pipeline.connect([]*AbstractStage{s.AbstractStage}, transform)
+	return s.newStage(NewAbstractStage(transform, s.pipeline, s.fnAdapter))
+}
+
+func (s *ComputeStage) mapX(mapFn ApplyFn) GeneralStage {
+	return s.attach(NewMapTransform("map", s.transform, s.fnAdapter.adaptMapFn(mapFn)))
+}
+
+func (s *ComputeStage) filter(filterFn TestFn) GeneralStage {
+	return s.attach(NewFilterTransform("filter", s.transform, s.fnAdapter.adaptFilterFn(filterFn)))
+}
+
+func (s *ComputeStage) flatMap(flatMapFn ApplyFn) GeneralStage {
+	return s.attach(NewFlatMapTransform("flat-map", s.transform, s.fnAdapter.adaptFlatMapFn(flatMapFn)))
+}
+
+// mapStateful the state isn't keyed, so all the items of the stage go to a single processor in the cluster. a nil
+// result of mapFn drops the item
+func (s *ComputeStage) mapStateful(createFn GetFn, mapFn BiApplyFn) GeneralStage {
+	return s.attachMapStateful("map-stateful", createFn, func(state, key, item interface{}) interface{} {
+		return singletonTraverser(mapFn(state, item))
+	})
+}
+
+// filterStateful filterFn must return a bool
+func (s *ComputeStage) filterStateful(createFn GetFn, filterFn BiApplyFn) GeneralStage {
+	return s.attachMapStateful("filter-stateful", createFn, func(state, key, item interface{}) interface{} {
+		if filterFn(state, item).(bool) {
+			return singletonTraverser(item)
+		}
+		return nil
+	})
+}
+
+// flatMapStateful flatMapFn must return a Traverser
+func (s *ComputeStage) flatMapStateful(createFn GetFn, flatMapFn BiApplyFn) GeneralStage {
+	return s.attachMapStateful("flat-map-stateful", createFn, func(state, key, item interface{}) interface{} {
+		return flatMapFn(state, item)
+	})
+}
+
+func (s *ComputeStage) attachMapStateful(name string, createFn GetFn, statefulFlatMapFn TriApplyFn) GeneralStage {
+	transform := NewMapStatefulTransform(name, s.transform, func(t interface{}) interface{} {
+		return CONSTANT_KEY
+	}, createFn, s.fnAdapter.adaptStatefulFlatMapFn(statefulFlatMapFn))
+	transform.setLocalParallelism(1)
+	return s.attach(transform)
+}
+
+// mapUsingService every processor of the stage has its own service, a nil result of mapFn drops the item
+func (s *ComputeStage) mapUsingService(serviceFactory ServiceFactory, mapFn BiApplyFn) GeneralStage {
+	return s.attach(NewServiceTransform("map-using-service", s.transform, serviceFactory, nil, s.fnAdapter.adaptStatefulFlatMapFn(func(service, key, item interface{}) interface{} {
+		return singletonTraverser(mapFn(service, item))
+	})))
+}
+
+// mapUsingServiceAsync mapAsyncFn is called on a separate goroutine for each item, at most maxConcurrentOps at a time
+// on each processor. unless preserveOrder is set, the results are emitted in the order they are ready
+func (s *ComputeStage) mapUsingServiceAsync(serviceFactory ServiceFactory, maxConcurrentOps int, preserveOrder bool, mapAsyncFn BiApplyFn) GeneralStage {
+	return s.attach(NewAsyncServiceTransform("map-using-service-async", s.transform, serviceFactory, nil, maxConcurrentOps, preserveOrder, s.fnAdapter.adaptStatefulFlatMapFn(func(service, key, item interface{}) interface{} {
+		return singletonTraverser(mapAsyncFn(service, item))
+	})))
+}
+
+func (s *ComputeStage) filterUsingService(serviceFactory ServiceFactory, filterFn BiTest) GeneralStage {
+	return s.attach(NewServiceTransform("filter-using-service", s.transform, serviceFactory, nil, s.fnAdapter.adaptStatefulFlatMapFn(func(service, key, item interface{}) interface{} {
+		if filterFn(service, item) {
+			return singletonTraverser(item)
+		}
+		return nil
+	})))
+}
+
+// flatMapUsingService flatMapFn must return a Traverser
+func (s *ComputeStage) flatMapUsingService(serviceFactory ServiceFactory, flatMapFn BiApplyFn) GeneralStage {
+	return s.attach(NewServiceTransform("flat-map-using-service", s.transform, serviceFactory, nil, s.fnAdapter.adaptStatefulFlatMapFn(func(service, key, item interface{}) interface{} {
+		return flatMapFn(service, item)
+	})))
+}
+
+// rebalance returns a stage of the same transform, the stages attached to it receive its output rebalanced
+func (s *ComputeStage) rebalance() GeneralStage {
+	stage := NewAbstractStage(s.transform, s.pipeline, s.fnAdapter)
+	stage.rebalanceOutput = true
+	return s.newStage(stage)
+}
+
+// addTimestamps the items of the returned stage are TimestampedItems, an item that already has a timestamp gets the new one
+func (s *ComputeStage) addTimestamps(timestampFn ApplyAsLongFn, allowedLag int64) StreamStage {
+	transform := NewTimestampTransform(s.transform, newLimitingLagPolicy(s.fnAdapter, timestampFn, allowedLag, 0))
+	s.pipeline.connect([]*AbstractStage{s.AbstractStage}, transform)
+	return NewStreamStageImpl(NewAbstractStage(transform, s.pipeline, ADAPT_TO_TIMESTAMPED_ITEM))
+}
+
+func (s *ComputeStage) writeTo(sink Sink) SinkStage {
+	return s.pipeline.writeToStages(sink, []*AbstractStage{s.AbstractStage})
+}
+
+// peek a nil shouldLogFn logs every item, a nil toStringFn formats the items with %v
+func (s *ComputeStage) peek(shouldLogFn TestFn, toStringFn ApplyFn) GeneralStage {
+	if shouldLogFn != nil {
+		shouldLogFn = s.fnAdapter.adaptFilterFn(shouldLogFn)
+	}
+	if toStringFn == nil {
+		toStringFn = func(t interface{}) interface{} {
+			return fmt.Sprintf("%v", t)
+		}
+	}
+	return s.attach(NewPeekTransform(s.transform, shouldLogFn, s.fnAdapter.adaptKeyFn(toStringFn)))
+}
+
+// customTransform the processors receive the items as they are, the TimestampedItems of a stage with timestamps included
+func (s *ComputeStage) customTransform(stageName string, procSupplier ProcessorMetaSupplier) {
+	s.attach(NewProcessorTransform(stageName, s.transform, procSupplier))
+}
+
+// BatchStageImpl implementation of BatchStage
+type BatchStageImpl struct {
+	*ComputeStage
+}
+
+func NewBatchStageImpl(stage *AbstractStage) *BatchStageImpl {
+	return &BatchStageImpl{ComputeStage: &ComputeStage{AbstractStage: stage, newStage: func(stage *AbstractStage) GeneralStage {
+		return NewBatchStageImpl(stage)
+	}}}
+}
+
+func (s *BatchStageImpl) groupingKey(keyFn ApplyFn) BatchStageWithKey {
+	return NewBatchStageWithKeyImpl(s.AbstractStage, keyFn)
+}
+
+// sort all the items go to a single processor in the cluster, the downstream stages receive them in order only if the
+// pipeline preserves the order
+func (s *BatchStageImpl) sort() BatchStage {
+	return s.attach(NewSortTransform(s.transform)).(BatchStage)
+}
+
+// ComputeStageWithKey implements the operations BatchStageWithKeyImpl and StreamStageWithKeyImpl have in common, the
+// items of a key go to a single processor in the cluster. newStage wraps the stage of an attached transform into a stage
+// of the kind of the keyed stage
+type ComputeStageWithKey struct {
+	stage      *AbstractStage
+	groupKeyFn ApplyFn
+	newStage   func(stage *AbstractStage) GeneralStage
+}
+
+func (s *ComputeStageWithKey) keyFn() ApplyFn {
+	return s.groupKeyFn
+}
+
+// mapStateful a nil result of mapFn drops the item
+func (s *ComputeStageWithKey) mapStateful(createFn GetFn, mapFn TriApplyFn) GeneralStage {
+	return s.attachMapStateful("map-stateful", createFn, func(state, key, item interface{}) interface{} {
+		return singletonTraverser(mapFn(state, key, item))
+	})
+}
+
+func (s *ComputeStageWithKey) filterStateful(createFn GetFn, filterFn BiTest) GeneralStage {
+	return s.attachMapStateful("filter-stateful", createFn, func(state, key, item interface{}) interface{} {
+		if filterFn(state, item) {
+			return singletonTraverser(item)
+		}
+		return nil
+	})
+}
+
+// flatMapStateful flatMapFn must return a Traverser
+func (s *ComputeStageWithKey) flatMapStateful(createFn GetFn, flatMapFn TriApplyFn) GeneralStage {
+	return s.attachMapStateful("flat-map-stateful", createFn, flatMapFn)
+}
+
+// mapUsingService the items of a key go to the same processor, a nil result of mapFn drops the item
+func (s *ComputeStageWithKey) mapUsingService(serviceFactory ServiceFactory, mapFn TriApplyFn) GeneralStage {
+	return s.attachUsingService("map-using-service", serviceFactory, func(service, key, item interface{}) interface{} {
+		return singletonTraverser(mapFn(service, key, item))
+	})
+}
+
+// mapUsingServiceAsync attaches the stage without returning it, the output of the stage can't be used by other stages
+func (s *ComputeStageWithKey) mapUsingServiceAsync(serviceFactory ServiceFactory, maxConcurrentOps int, preserveOrder bool, mapAsyncFn TriApplyFn) {
+	fnAdapter := s.stage.fnAdapter
+	s.attach(NewAsyncServiceTransform("map-using-service-async", s.stage.transform, serviceFactory, fnAdapter.adaptKeyFn(s.groupKeyFn), maxConcurrentOps, preserveOrder,
+		fnAdapter.adaptStatefulFlatMapFn(func(service, key, item interface{}) interface{} {
+			return singletonTraverser(mapAsyncFn(service, key, item))
+		})))
+}
+
+func (s *ComputeStageWithKey) filterUsingService(serviceFactory ServiceFactory, filterFn TriTestFn) GeneralStage {
+	return s.attachUsingService("filter-using-service", serviceFactory, func(service, key, item interface{}) interface{} {
+		if filterFn(service, key, item) {
+			return singletonTraverser(item)
+		}
+		return nil
+	})
+}
+
+func (s *ComputeStageWithKey) attachUsingService(name string, serviceFactory ServiceFactory, flatMapFn TriApplyFn) GeneralStage {
+	fnAdapter := s.stage.fnAdapter
+	return s.attach(NewServiceTransform(name, s.stage.transform, serviceFactory, fnAdapter.adaptKeyFn(s.groupKeyFn), fnAdapter.adaptStatefulFlatMapFn(flatMapFn)))
+}
+
+// customTransform the processors receive the items as they are, the TimestampedItems of a stage with timestamps included
+func (s *ComputeStageWithKey) customTransform(stageName string, procSupplier GetFn) GeneralStage {
+	metaSupplier := NewMetaSupplierFromProcessorSupplier(LOCAL_PARALLELISM_USE_DEFAULT, NewProcessorSupplierFromGetFn(procSupplier))
+	return s.attach(NewKeyedProcessorTransform(stageName, s.stage.transform, metaSupplier, s.stage.fnAdapter.adaptKeyFn(s.groupKeyFn)))
+}
+
+func (s *ComputeStageWithKey) attachMapStateful(name string, createFn GetFn, statefulFlatMapFn TriApplyFn) GeneralStage {
+	fnAdapter := s.stage.fnAdapter
+	return s.attach(NewMapStatefulTransform(name, s.stage.transform, fnAdapter.adaptKeyFn(s.groupKeyFn), createFn, fnAdapter.adaptStatefulFlatMapFn(statefulFlatMapFn)))
+}
+
+// attach connects the transform to the output of the keyed stage and returns the stage representing it
+func (s *ComputeStageWithKey) attach(transform Transform) GeneralStage {
+	s.stage.pipeline.connect([]*AbstractStage{s.stage}, transform)
+	return s.newStage(NewAbstractStage(transform, s.stage.pipeline, s.stage.fnAdapter))
+}
+
+// BatchStageWithKeyImpl implementation of BatchStageWithKey
+type BatchStageWithKeyImpl struct {
+	*ComputeStageWithKey
+}
+
+func NewBatchStageWithKeyImpl(stage *AbstractStage, groupKeyFn ApplyFn) *BatchStageWithKeyImpl {
+	return &BatchStageWithKeyImpl{ComputeStageWithKey: &ComputeStageWithKey{stage: stage, groupKeyFn: groupKeyFn, newStage: func(stage *AbstractStage) GeneralStage {
+		return NewBatchStageImpl(stage)
+	}}}
+}
+
+// distinct attaches the stage without returning it, attachDistinct returns it
+func (s *BatchStageWithKeyImpl) distinct() {
+	s.attachDistinct()
+}
+
+// attachDistinct attaches a stage that emits the first item of each key
+func (s *BatchStageWithKeyImpl) attachDistinct() BatchStage {
+	return s.attachMapStateful("distinct", func() interface{} {
+		return NewLongAccumulator()
+	}, func(seen, key, item interface{}) interface{} {
+		acc := seen.(*LongAccumulator)
+		if acc.get() > 0 {
+			return nil
+		}
+		acc.addAllowingOverflow(1)
+		return singletonTraverser(item)
+	}).(BatchStage)
+}
+
+func (s *BatchStageWithKeyImpl) aggregate(aggrOp AggregateOperation1) BatchStage {
+	transform := NewGroupTransform([]Transform{s.stage.transform}, []ApplyFn{s.groupKeyFn}, aggrOp, func(key, result interface{}) interface{} {
+		return MapEntry{key: key, value: result}
+	})
+	s.stage.pipeline.connect([]*AbstractStage{s.stage}, transform)
+	return NewBatchStageImpl(NewAbstractStage(transform, s.stage.pipeline, DO_NOT_ADAPT))
+}
+
+// StreamStageImpl implementation of StreamStage
+type StreamStageImpl struct {
+	*ComputeStage
+}
+
+func NewStreamStageImpl(stage *AbstractStage) *StreamStageImpl {
+	return &StreamStageImpl{ComputeStage: &ComputeStage{AbstractStage: stage, newStage: func(stage *AbstractStage) GeneralStage {
+		return NewStreamStageImpl(stage)
+	}}}
+}
+
+func (s *StreamStageImpl) window(wDef WindowDefinition) StageWithWindow {
+	return NewStageWithWindowImpl(s, wDef)
+}
+
+// merge both stages must either have timestamps or not
+func (s *StreamStageImpl) merge(other StreamStage) StreamStage {
+	otherStage := abstractStageOf(other)
+	if s.fnAdapter.isTimestamped() != otherStage.fnAdapter.isTimestamped() {
+		panic(fmt.Sprintf("can't merge stage %s with stage %s, only one of them has timestamps", s.name(), otherStage.name()))
+	}
+	transform := NewMergeTransform(s.transform, otherStage.transform)
+	s.pipeline.connect([]*AbstractStage{s.AbstractStage, otherStage}, transform)
+	return NewStreamStageImpl(NewAbstractStage(transform, s.pipeline, s.fnAdapter))
+}
+
+func (s *StreamStageImpl) groupingKey(keyFn ApplyFn) StreamStageWithKey {
+	return NewStreamStageWithKeyImpl(s.AbstractStage, keyFn)
+}
+
+// StreamStageWithKeyImpl implementation of StreamStageWithKey
+type StreamStageWithKeyImpl struct {
+	*ComputeStageWithKey
+}
+
+func NewStreamStageWithKeyImpl(stage *AbstractStage, groupKeyFn ApplyFn) *StreamStageWithKeyImpl {
+	return &StreamStageWithKeyImpl{ComputeStageWithKey: &ComputeStageWithKey{stage: stage, groupKeyFn: groupKeyFn, newStage: func(stage *AbstractStage) GeneralStage {
+		return NewStreamStageImpl(stage)
+	}}}
+}
+
+func (s *StreamStageWithKeyImpl) window(wDef WindowDefinition) StageWithKeyAndWindow {
+	return NewStageWithKeyAndWindowImpl(s.stage, s.groupKeyFn, wDef)
+}
+
+// StageWithWindowImpl implementation of StageWithWindow
+type StageWithWindowImpl struct {
+	stage *StreamStageImpl
+	wDef  WindowDefinition
+}
+
+func NewStageWithWindowImpl(stage *StreamStageImpl, wDef WindowDefinition) *StageWithWindowImpl {
+	return &StageWithWindowImpl{stage: stage, wDef: wDef}
+}
+
+func (s *StageWithWindowImpl) streamStage() StreamStage {
+	return s.stage
+}
+
+func (s *StageWithWindowImpl) windowDefinition() WindowDefinition {
+	return s.wDef
+}
+
+func (s *StageWithWindowImpl) groupingKey(keyFn ApplyFn) StageWithKeyAndWindow {
+	return NewStageWithKeyAndWindowImpl(s.stage.AbstractStage, keyFn, s.wDef)
+}
+
+// StageWithKeyAndWindowImpl implementation of StageWithKeyAndWindow
+type StageWithKeyAndWindowImpl struct {
+	stage      *AbstractStage
+	groupKeyFn ApplyFn
+	wDef       WindowDefinition
+}
+
+func NewStageWithKeyAndWindowImpl(stage *AbstractStage, groupKeyFn ApplyFn, wDef WindowDefinition) *StageWithKeyAndWindowImpl {
+	return &StageWithKeyAndWindowImpl{stage: stage, groupKeyFn: groupKeyFn, wDef: wDef}
+}
+
+func (s *StageWithKeyAndWindowImpl) keyFn() ApplyFn {
+	return s.groupKeyFn
+}
+
+func (s *StageWithKeyAndWindowImpl) windowDefinition() WindowDefinition {
+	return s.wDef
+}
+
+// aggregate the windows are defined by the event timestamps, so the stage must have them. the results are timestamped
+// with the end of their window
+func (s *StageWithKeyAndWindowImpl) aggregate(aggrOp AggregateOperation1) StreamStage {
+	return NewStreamStageImpl(s.attachWindowGroup(aggrOp))
+}
+
+// aggregateWithLateEvents the late items keep the timestamps of the stage
+func (s *StageWithKeyAndWindowImpl) aggregateWithLateEvents(aggrOp AggregateOperation1) (StreamStage, StreamStage) {
+	stage := s.attachWindowGroup(aggrOp)
+	transform := NewLateEventsTransform(stage.transform.(*WindowGroupTransform))
+	s.stage.pipeline.connect([]*AbstractStage{stage}, transform)
+	return NewStreamStageImpl(stage), NewStreamStageImpl(NewAbstractStage(transform, s.stage.pipeline, s.stage.fnAdapter))
+}
+
+func (s *StageWithKeyAndWindowImpl) attachWindowGroup(aggrOp AggregateOperation1) *AbstractStage {
+	if !s.stage.fnAdapter.isTimestamped() {
+		panic(fmt.Sprintf("stage %s has no timestamps, a windowed aggregation requires them", s.stage.name()))
+	}
+	fnAdapter := s.stage.fnAdapter
+	transform := NewWindowGroupTransform([]Transform{s.stage.transform}, s.wDef, []ApplyFn{fnAdapter.adaptKeyFn(s.groupKeyFn)},
+		fnAdapter.adaptAggregateOperation(aggrOp), func(start, end int64, key, result interface{}, isEarly bool) interface{} {
+			return NewTimestampedItem(NewKeyedWindowResult(start, end, key, result, isEarly), end)
+		})
+	s.stage.pipeline.connect([]*AbstractStage{s.stage}, transform)
+	return NewAbstractStage(transform, s.stage.pipeline, ADAPT_TO_TIMESTAMPED_ITEM)
+}
+
+// StreamSourceStageImpl implementation of StreamSourceStage, the declared timestamps are kept as the event time policy of the source transform
+type StreamSourceStageImpl struct {
+	transform *StreamSourceTransform
+	pipeline  *PipelineImpl
+}
+
+func NewStreamSourceStageImpl(transform *StreamSourceTransform, pipeline *PipelineImpl) *StreamSourceStageImpl {
+	return &StreamSourceStageImpl{transform: transform, pipeline: pipeline}
+}
+
+func (s *StreamSourceStageImpl) withoutTimestamps() StreamStage {
+	s.transform.setEventTimePolicy(nil)
+	return s.streamStage()
+}
+
+func (s *StreamSourceStageImpl) withIngestionTimestamps() StreamStage {
+	return s.withTimestamps(func(t interface{}) int64 {
+		return time.Now().UnixMilli()
+	}, 0)
+}
+
+func (s *StreamSourceStageImpl) withNativeTimestamps(allowedLag int64) StreamStage {
+	if !s.transform.supportNativeTimestamps() {
+		panic(fmt.Sprintf("source %s doesn't support native timestamps", s.transform.name()))
+	}
+	return s.withTimestamps(nil, allowedLag)
+}
+
+func (s *StreamSourceStageImpl) withTimestamps(timestampFn ApplyAsLongFn, allowedLag int64) StreamStage {
+	policy := newLimitingLagPolicy(DO_NOT_ADAPT, timestampFn, allowedLag, s.transform.partitionIdleTimeout())
+	s.transform.setEventTimePolicy(&policy)
+	return s.streamStage()
+}
+
+func (s *StreamSourceStageImpl) streamStage() StreamStage {
+	fnAdapter := DO_NOT_ADAPT
+	if s.transform.getEventTimePolicy() != nil {
+		fnAdapter = ADAPT_TO_TIMESTAMPED_ITEM
+	}
+	return NewStreamStageImpl(NewAbstractStage(s.transform, s.pipeline, fnAdapter))
+}
+
+// SinkStageImpl implementation of SinkStage
+type SinkStageImpl struct {
+	*AbstractStage
+}
+
+func NewSinkStageImpl(stage *AbstractStage) *SinkStageImpl {
+	return &SinkStageImpl{AbstractStage: stage}
+}
+
+// newLimitingLagPolicy returns an event time policy whose watermarks lag behind the top timestamp by allowedLag, the
+// items are wrapped in TimestampedItems. fnAdapter adapts timestampFn to the input items, the watermark throttling frame
+// is left to the planner
+func newLimitingLagPolicy(fnAdapter FunctionAdapter, timestampFn ApplyAsLongFn, allowedLag int64, idleTimeoutMillis int64) EventTimePolicy {
+	if allowedLag < 0 {
+		panic("allowedLag must not be negative")
+	}
+	return NewEventTimePolicy(fnAdapter.adaptTimestampFn(timestampFn), func() interface{} {
+		return newLimitingLag(allowedLag)
+	}, func(t interface{}, timestamp int64) interface{} {
+		if timestamped, ok := t.(TimestampedItem); ok && fnAdapter.isTimestamped() {
+			t = timestamped.item
+		}
+		return NewTimestampedItem(t, timestamp)
+	}, idleTimeoutMillis, 0, 0)
+}
@@ -0,0 +1,370 @@
+package stream_processing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Tasklet a unit of work the ExecutionService runs. a cooperative tasklet must not block and must return from call
+// quickly, so that many tasklets can share a worker goroutine
+type Tasklet interface {
+
+	// init called once before the first call
+	init(ctx context.Context)
+
+	// call does a bounded amount of work and reports whether it made progress and whether it is done
+	call() *ProgressState
+
+	// isCooperative whether this tasklet can share a worker goroutine with other tasklets
+	isCooperative() bool
+
+	// name return a descriptive name of this tasklet
+	name() string
+}
+
+type processorTaskletState int
+
+const (
+	RESTORE_SNAPSHOT processorTaskletState = iota
+	FINISH_SNAPSHOT_RESTORE
+	PROCESS_WATERMARK
+	PROCESS_INBOX
+	COMPLETE
+	SAVE_SNAPSHOT
+	EMIT_BARRIER
+	SNAPSHOT_COMMIT_FINISH
+	EMIT_DONE_ITEM
+	END
+)
+
+// ProcessorTasklet the Tasklet that drives a single Processor instance. it fills the inbox from the inbound edge streams,
+// passes the coalesced watermarks to the processor and emits DONE_ITEM after the processor completed.
+// it lets the processor save its state when the snapshot barrier arrived on all the inbound streams, or, if there are
+// none left, when the SnapshotContext asks for a snapshot, and then forwards the barrier
+type ProcessorTasklet struct {
+	context   *ProcessorContext
+	processor Processor
+	inbox     *ConcurrentInbox
+	outbox    *OutboxImpl
+	ssContext *SnapshotContext
+
+	// instreamGroups the inbound streams grouped by priority, the group with the highest priority comes first.
+	// activeInstreams the streams of the current group that are not done yet, instreamIndex is the next one to drain
+	instreamGroups   [][]*InboundEdgeStream
+	activeInstreams  []*InboundEdgeStream
+	instreamIndex    int
+	currInstream     *InboundEdgeStream
+	pendingWatermark int64
+
+	// pendingSnapshotId the snapshot being saved, the tasklet returns to stateAfterSnapshot once it is saved or committed
+	pendingSnapshotId int64
+	// pendingBarrier the barrier of the pending snapshot, the same barrier is offered until the outbox accepts it
+	pendingBarrier      *SnapshotBarrier
+	savedSnapshotId     int64
+	committedSnapshotId int64
+	stateAfterSnapshot  processorTaskletState
+
+	state       processorTaskletState
+	progTracker *ProgressTracker
+}
+
+func NewProcessorTasklet(context *ProcessorContext, processor Processor, instreams []*InboundEdgeStream, outbox *OutboxImpl,
+	ssContext *SnapshotContext) *ProcessorTasklet {
+	t := &ProcessorTasklet{
+		context:             context,
+		processor:           processor,
+		inbox:               NewConcurrentInbox(),
+		outbox:              outbox,
+		ssContext:           ssContext,
+		instreamGroups:      groupByPriority(instreams),
+		pendingWatermark:    NO_NEW_WM,
+		pendingSnapshotId:   NO_SNAPSHOT,
+		savedSnapshotId:     NO_SNAPSHOT,
+		committedSnapshotId: NO_SNAPSHOT,
+		state:               PROCESS_INBOX,
+		progTracker:         NewProgressTracker(),
+	}
+	t.nextInstreamGroup()
+	return t
+}
+
+// groupByPriority groups the streams with equal priority, the groups are ordered by priority, a lower number first
+func groupByPriority(instreams []*InboundEdgeStream) [][]*InboundEdgeStream {
+	sorted := make([]*InboundEdgeStream, len(instreams))
+	copy(sorted, instreams)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].priority < sorted[j].priority
+	})
+	var groups [][]*InboundEdgeStream
+	for i, instream := range sorted {
+		if i == 0 || instream.priority != sorted[i-1].priority {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], instream)
+	}
+	return groups
+}
+
+// restoreFrom makes the processor restore the entries before it processes any item, the inbox holds them until then
+func (t *ProcessorTasklet) restoreFrom(entries []MapEntry) {
+	for _, entry := range entries {
+		t.inbox.add(entry)
+	}
+	t.state = RESTORE_SNAPSHOT
+}
+
+// nextInstreamGroup starts draining the next priority group, if there is one
+func (t *ProcessorTasklet) nextInstreamGroup() {
+	if len(t.instreamGroups) == 0 {
+		return
+	}
+	t.activeInstreams = t.instreamGroups[0]
+	t.instreamGroups = t.instreamGroups[1:]
+	t.instreamIndex = 0
+}
+
+func (t *ProcessorTasklet) init(ctx context.Context) {
+	t.processor.init(withProcessorContext(ctx, t.context), t.outbox)
+}
+
+func (t *ProcessorTasklet) isCooperative() bool {
+	return t.processor.isCooperative()
+}
+
+func (t *ProcessorTasklet) name() string {
+	return fmt.Sprintf("%s#%d", t.context.vertexName, t.context.getGlobalProcessorIndex())
+}
+
+func (t *ProcessorTasklet) call() *ProgressState {
+	t.progTracker.reset()
+	t.outbox.reset()
+	t.stateMachineStep()
+	return t.progTracker.toProgressState()
+}
+
+func (t *ProcessorTasklet) stateMachineStep() {
+	switch t.state {
+	case RESTORE_SNAPSHOT:
+		t.progTracker.notDone()
+		if !t.inbox.isEmpty() {
+			sizeBefore := t.inbox.size()
+			t.processor.restoreFromSnapshot(t.inbox)
+			if t.inbox.size() != sizeBefore {
+				t.progTracker.madeProgress()
+			}
+		}
+		if t.inbox.isEmpty() {
+			t.progTracker.madeProgress()
+			t.state = FINISH_SNAPSHOT_RESTORE
+		}
+	case FINISH_SNAPSHOT_RESTORE:
+		t.progTracker.notDone()
+		if t.processor.finishSnapshotRestore() {
+			t.progTracker.madeProgress()
+			t.state = PROCESS_INBOX
+		}
+	case PROCESS_WATERMARK:
+		t.progTracker.notDone()
+		if t.doProcessWatermark() {
+			t.progTracker.madeProgress()
+			t.pendingWatermark = NO_NEW_WM
+			t.state = PROCESS_INBOX
+		}
+	case PROCESS_INBOX:
+		t.progTracker.notDone()
+		if t.startCommit() {
+			return
+		}
+		t.processInbox()
+	case COMPLETE:
+		t.progTracker.notDone()
+		if t.startCommit() || t.startSourceSnapshot() {
+			return
+		}
+		t.complete()
+	case SAVE_SNAPSHOT:
+		t.progTracker.notDone()
+		if t.processor.saveToSnapshot() {
+			t.progTracker.madeProgress()
+			t.pendingBarrier = NewSnapshotBarrier(t.pendingSnapshotId)
+			t.state = EMIT_BARRIER
+		}
+	case EMIT_BARRIER:
+		t.progTracker.notDone()
+		if t.outbox.offerToEdges(t.pendingBarrier) {
+			t.progTracker.madeProgress()
+			t.pendingBarrier = nil
+			t.releaseBarriers()
+			t.savedSnapshotId = t.pendingSnapshotId
+			t.pendingSnapshotId = NO_SNAPSHOT
+			t.state = t.stateAfterSnapshot
+			t.ssContext.snapshotDone(t.context.vertexName, t.outbox.takeSnapshotEntries())
+		}
+	case SNAPSHOT_COMMIT_FINISH:
+		t.progTracker.notDone()
+		snapshotId, success := t.ssContext.getCommitSnapshotId()
+		if t.processor.snapshotCommitFinish(success) {
+			t.progTracker.madeProgress()
+			t.committedSnapshotId = snapshotId
+			t.state = t.stateAfterSnapshot
+			t.ssContext.commitDone()
+		}
+	case EMIT_DONE_ITEM:
+		if !t.outbox.offerToEdges(DONE_ITEM) {
+			t.progTracker.notDone()
+			return
+		}
+		t.progTracker.madeProgress()
+		t.state = END
+		t.ssContext.taskletDone(t.savedSnapshotId, t.committedSnapshotId)
+	case END:
+	default:
+		panic(fmt.Sprintf("Unexpected state %d", t.state))
+	}
+}
+
+// complete calls complete on the processor, which emits the items of a source
+func (t *ProcessorTasklet) complete() {
+	acceptedCount := t.outbox.acceptedCount
+	if t.processor.complete() {
+		t.progTracker.madeProgress()
+		t.state = EMIT_DONE_ITEM
+	} else if t.outbox.acceptedCount != acceptedCount {
+		t.progTracker.madeProgress()
+	}
+}
+
+// startCommit moves to SNAPSHOT_COMMIT_FINISH if the processor didn't commit the latest snapshot yet
+func (t *ProcessorTasklet) startCommit() bool {
+	if snapshotId, _ := t.ssContext.getCommitSnapshotId(); snapshotId <= t.committedSnapshotId {
+		return false
+	}
+	t.progTracker.madeProgress()
+	t.stateAfterSnapshot = t.state
+	t.state = SNAPSHOT_COMMIT_FINISH
+	return true
+}
+
+// startSourceSnapshot moves to SAVE_SNAPSHOT if the job asked for a snapshot this processor didn't save yet. it is
+// used once all inbound streams are done, no barrier arrives anymore then. an item the outbox accepted only partly
+// must be completed first, the outbox is blocked so that the processor doesn't emit anything else
+func (t *ProcessorTasklet) startSourceSnapshot() bool {
+	snapshotId := t.ssContext.getActiveSnapshotId()
+	if snapshotId <= t.savedSnapshotId {
+		return false
+	}
+	if t.outbox.hasUnfinishedItem() {
+		t.outbox.block()
+		t.complete()
+		t.outbox.unblock()
+		return true
+	}
+	t.progTracker.madeProgress()
+	t.pendingSnapshotId = snapshotId
+	t.stateAfterSnapshot = COMPLETE
+	t.state = SAVE_SNAPSHOT
+	return true
+}
+
+// alignedBarrier return the id of the snapshot whose barrier arrived on all the inbound streams that are not done,
+// NO_SNAPSHOT if it is still missing on some of them or there are no streams left
+func (t *ProcessorTasklet) alignedBarrier() int64 {
+	snapshotId := NO_SNAPSHOT
+	for _, group := range t.instreamGroups {
+		for _, instream := range group {
+			if snapshotId = instream.receivedBarrier(); snapshotId == NO_SNAPSHOT {
+				return NO_SNAPSHOT
+			}
+		}
+	}
+	for _, instream := range t.activeInstreams {
+		if snapshotId = instream.receivedBarrier(); snapshotId == NO_SNAPSHOT {
+			return NO_SNAPSHOT
+		}
+	}
+	return snapshotId
+}
+
+// releaseBarriers lets the inbound streams drain the items after the barrier
+func (t *ProcessorTasklet) releaseBarriers() {
+	for _, group := range t.instreamGroups {
+		for _, instream := range group {
+			instream.releaseBarrier()
+		}
+	}
+	for _, instream := range t.activeInstreams {
+		instream.releaseBarrier()
+	}
+}
+
+// doProcessWatermark the idle message is forwarded directly, any other watermark is given to the processor
+func (t *ProcessorTasklet) doProcessWatermark() bool {
+	if t.pendingWatermark == IDLE_MESSAGE.timestamp {
+		return t.outbox.offerToEdges(IDLE_MESSAGE)
+	}
+	return t.processor.tryProcessWatermark(Watermark{timestamp: t.pendingWatermark})
+}
+
+func (t *ProcessorTasklet) processInbox() {
+	if t.inbox.isEmpty() && t.tryProcessIdle() {
+		t.fillInbox()
+	}
+	if !t.inbox.isEmpty() {
+		sizeBefore := t.inbox.size()
+		t.processor.process(t.currInstream.ordinal, t.inbox)
+		if t.inbox.size() != sizeBefore {
+			t.progTracker.madeProgress()
+		}
+	}
+	if t.inbox.isEmpty() {
+		if t.pendingWatermark != NO_NEW_WM {
+			t.state = PROCESS_WATERMARK
+		} else if snapshotId := t.alignedBarrier(); snapshotId != NO_SNAPSHOT {
+			t.pendingSnapshotId = snapshotId
+			t.stateAfterSnapshot = PROCESS_INBOX
+			t.state = SAVE_SNAPSHOT
+		} else if len(t.activeInstreams) == 0 && len(t.instreamGroups) == 0 {
+			t.state = COMPLETE
+		}
+	}
+}
+
+// tryProcessIdle gives an idleProcessor the chance to work before the inbox is filled
+func (t *ProcessorTasklet) tryProcessIdle() bool {
+	processor, ok := t.processor.(idleProcessor)
+	if !ok {
+		return true
+	}
+	acceptedCount := t.outbox.acceptedCount
+	done := processor.tryProcessIdle()
+	if t.outbox.acceptedCount != acceptedCount {
+		t.progTracker.madeProgress()
+	}
+	return done
+}
+
+// fillInbox drains the inbound streams of the current priority group in round-robin fashion until one of them makes
+// progress. the streams of the next group are drained only after all the streams of the current group are done
+func (t *ProcessorTasklet) fillInbox() {
+	if len(t.activeInstreams) == 0 {
+		t.nextInstreamGroup()
+	}
+	for attempts := len(t.activeInstreams); attempts > 0 && len(t.activeInstreams) > 0; attempts-- {
+		t.instreamIndex %= len(t.activeInstreams)
+		t.currInstream = t.activeInstreams[t.instreamIndex]
+		result, wm := t.inbox.drainFrom(t.currInstream)
+		if result.isDone {
+			t.activeInstreams = append(t.activeInstreams[:t.instreamIndex], t.activeInstreams[t.instreamIndex+1:]...)
+		} else {
+			t.instreamIndex++
+		}
+		if wm != NO_NEW_WM {
+			t.pendingWatermark = wm
+		}
+		if result.madeProgress {
+			t.progTracker.madeProgress()
+			return
+		}
+	}
+}
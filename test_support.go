@@ -32,7 +32,7 @@ type TestProcessor struct {
 
 func NewTestProcessorWithSupplier(supplier GetFn) *TestProcessor {
 	p := new(TestProcessor)
-	p.metaSupplier = NewMetaSupplierFromProcessorSupplier(LOCAL_PARALLELISM_USE_DEFAULT, supplier)
+	p.metaSupplier = NewMetaSupplierFromProcessorSupplier(LOCAL_PARALLELISM_USE_DEFAULT, NewProcessorSupplierFromGetFn(supplier))
 	return p
 }
 
@@ -1,9 +1,15 @@
 package stream_processing
 
-import "context"
+import (
+	"fmt"
+	"strings"
+)
 
 const (
 	LOCAL_PARALLELISM_USE_DEFAULT = -1
+
+	// DEFAULT_PARTITION_IDLE_TIMEOUT the default timeout in milliseconds after which idle source partitions are excluded from watermark coalescing
+	DEFAULT_PARTITION_IDLE_TIMEOUT int64 = 60000
 )
 
 // Transform is a pure data object and holds no implementation code for the transformation it presents
@@ -32,7 +38,8 @@ type Transform interface {
 
 	getUpstream() []Transform
 
-	addToDag(context context.Context, p Planner)
+	// addToDag adds the vertices and edges of this transform to the DAG the planner creates
+	addToDag(p *Planner)
 
 	// preferredWatermarkStride returns the optimal watermark stride for this window transform
 	preferredWatermarkStride() int64
@@ -53,6 +60,8 @@ func NewAbstractTransform(name string, upstream []Transform) *AbstractTransform
 		upstream:                   upstream,
 		localParallelism:           LOCAL_PARALLELISM_USE_DEFAULT,
 		determinedLocalParallelism: LOCAL_PARALLELISM_USE_DEFAULT,
+		upstreamRebalancingFlags:   make([]bool, len(upstream)),
+		upstreamPartitionKeyFns:    make([]ApplyFn, len(upstream)),
 	}
 }
 
@@ -104,11 +113,70 @@ func (a *AbstractTransform) preferredWatermarkStride() int64 {
 	return 0
 }
 
-func (a *AbstractTransform) addToDag(context context.Context, p Planner) {
+func (a *AbstractTransform) addToDag(p *Planner) {
 	panic("implement me")
 }
 
+// StreamSourceTransform the transform of a stream source, it also holds the event time policy the source stage was declared with
 type StreamSourceTransform struct {
+	*AbstractTransform
+	metaSupplier             ProcessorMetaSupplier
+	supportsNativeTimestamps bool
+	idleTimeout              int64
+	eventTimePolicy          *EventTimePolicy
+	isAssignedToStage        bool
+}
+
+func NewStreamSourceTransform(name string, metaSupplier ProcessorMetaSupplier, supportsNativeTimestamps bool) *StreamSourceTransform {
+	return &StreamSourceTransform{
+		AbstractTransform:        NewAbstractTransform(name, []Transform{}),
+		metaSupplier:             metaSupplier,
+		supportsNativeTimestamps: supportsNativeTimestamps,
+		idleTimeout:              DEFAULT_PARTITION_IDLE_TIMEOUT,
+	}
+}
+
+func (s *StreamSourceTransform) name() string {
+	return s.getName()
+}
+
+func (s *StreamSourceTransform) supportNativeTimestamps() bool {
+	return s.supportsNativeTimestamps
+}
+
+func (s *StreamSourceTransform) setPartitionIdleTimeout(timeout int64) StreamSource {
+	if timeout < 0 {
+		panic("partition idle timeout must not be negative")
+	}
+	s.idleTimeout = timeout
+	return s
+}
+
+func (s *StreamSourceTransform) partitionIdleTimeout() int64 {
+	return s.idleTimeout
+}
+
+// setEventTimePolicy sets the policy the source stage was declared with, nil means the events have no timestamps
+func (s *StreamSourceTransform) setEventTimePolicy(eventTimePolicy *EventTimePolicy) {
+	s.eventTimePolicy = eventTimePolicy
+}
+
+func (s *StreamSourceTransform) getEventTimePolicy() *EventTimePolicy {
+	return s.eventTimePolicy
+}
+
+// addToDag the source processors don't emit watermarks, if the stage has timestamps a vertex inserting them is added after the source
+func (s *StreamSourceTransform) addToDag(p *Planner) {
+	pv := p.addVertex(s, s.getName(), s.metaSupplier)
+	if s.eventTimePolicy == nil {
+		return
+	}
+	policy := p.withWatermarkStride(*s.eventTimePolicy)
+	wmVertex := p.dag.newUniqueVertex(s.getName()+"-add-timestamps", func() interface{} {
+		return NewInsertWatermarksP(policy)
+	}).setLocalParallelism(s.getDeterminedLocalParallelism())
+	p.dag.edge(From(pv.v, pv.nextAvailableOrdinal()).To(wmVertex, 0).isolated())
+	p.xform2vertex[s] = NewPlannerVertex(wmVertex)
 }
 
 type BatchSourceTransform struct {
@@ -124,6 +192,10 @@ func NewBatchSourceTransform(name string, metaSupplier ProcessorMetaSupplier) *B
 	return t
 }
 
+func (b *BatchSourceTransform) name() string {
+	return b.t.name
+}
+
 func (b *BatchSourceTransform) getName() string {
 	return b.t.name
 }
@@ -168,14 +240,455 @@ func (b *BatchSourceTransform) getUpstream() []Transform {
 	return b.t.getUpstream()
 }
 
-func (b *BatchSourceTransform) addToDag(context context.Context, p Planner) {
-	panic("implement me")
+func (b *BatchSourceTransform) addToDag(p *Planner) {
+	p.addVertex(b, b.getName(), b.metaSupplier)
 }
 
 func (b *BatchSourceTransform) preferredWatermarkStride() int64 {
 	return b.t.preferredWatermarkStride()
 }
 
+// MapTransform maps each item with mapFn, a nil result drops the item, so it also represents a filter
+type MapTransform struct {
+	*AbstractTransform
+	mapFn ApplyFn
+}
+
+func NewMapTransform(name string, upstream Transform, mapFn ApplyFn) *MapTransform {
+	return &MapTransform{AbstractTransform: NewAbstractTransform(name, []Transform{upstream}), mapFn: mapFn}
+}
+
+func (m *MapTransform) addToDag(p *Planner) {
+	pv := p.addVertexFromGetFn(m, m.getName(), func() interface{} {
+		return NewMapP(m.mapFn)
+	})
+	p.addEdges(m, pv.v, nil)
+}
+
+// NewFilterTransform creates a MapTransform which passes the items that match filterFn
+func NewFilterTransform(name string, upstream Transform, filterFn TestFn) *MapTransform {
+	return NewMapTransform(name, upstream, func(t interface{}) interface{} {
+		if filterFn(t) {
+			return t
+		}
+		return nil
+	})
+}
+
+// FlatMapTransform emits all the items of the Traverser flatMapFn returns for each item
+type FlatMapTransform struct {
+	*AbstractTransform
+	flatMapFn ApplyFn
+}
+
+func NewFlatMapTransform(name string, upstream Transform, flatMapFn ApplyFn) *FlatMapTransform {
+	return &FlatMapTransform{AbstractTransform: NewAbstractTransform(name, []Transform{upstream}), flatMapFn: flatMapFn}
+}
+
+func (f *FlatMapTransform) addToDag(p *Planner) {
+	pv := p.addVertexFromGetFn(f, f.getName(), func() interface{} {
+		return NewTransformP(f.flatMapFn)
+	})
+	p.addEdges(f, pv.v, nil)
+}
+
+// FusedTransform a chain of stateless transforms planned as a single vertex, its TransformP applies their functions one
+// after another to each item. the downstream transforms of the chain are connected to the vertex of the fused transform
+type FusedTransform struct {
+	*AbstractTransform
+	chain     []Transform
+	flatMapFn ApplyFn
+}
+
+func NewFusedTransform(chain []Transform) *FusedTransform {
+	first := chain[0]
+	names := make([]string, len(chain))
+	flatMapFns := make([]ApplyFn, len(chain))
+	f := &FusedTransform{chain: chain}
+	for i, t := range chain {
+		names[i] = t.getName()
+		flatMapFns[i] = statelessFlatMapFn(t)
+	}
+	f.AbstractTransform = NewAbstractTransform(fmt.Sprintf("fused(%s)", strings.Join(names, ", ")), first.getUpstream())
+	for _, t := range chain {
+		if localParallelism := t.getLocalParallelism(); localParallelism != LOCAL_PARALLELISM_USE_DEFAULT {
+			f.setLocalParallelism(localParallelism)
+		}
+	}
+	f.setRebalanceInput(0, first.shouldRebalanceInput(0))
+	f.setPartitionKeyFnForInput(0, first.partitionKeyFnForInput(0))
+	f.flatMapFn = func(item interface{}) interface{} {
+		traverser := singletonTraverser(item)
+		for _, flatMapFn := range flatMapFns {
+			traverser = traverser.flatMap(flatMapFn)
+		}
+		return traverser
+	}
+	return f
+}
+
+func (f *FusedTransform) addToDag(p *Planner) {
+	pv := p.addVertexFromGetFn(f, f.getName(), func() interface{} {
+		return NewTransformP(f.flatMapFn)
+	})
+	p.addEdges(f, pv.v, nil)
+	for _, t := range f.chain {
+		t.setDeterminedLocalParallelism(f.getDeterminedLocalParallelism())
+		p.xform2vertex[t] = pv
+	}
+}
+
+// statelessFlatMapFn returns the function of a stateless transform as a flat-mapping function which always returns a
+// Traverser, nil if the transform isn't stateless
+func statelessFlatMapFn(transform Transform) ApplyFn {
+	switch t := transform.(type) {
+	case *MapTransform:
+		return func(item interface{}) interface{} {
+			return singletonTraverser(t.mapFn(item))
+		}
+	case *FlatMapTransform:
+		return func(item interface{}) interface{} {
+			if traverser, ok := t.flatMapFn(item).(Traverser); ok {
+				return traverser
+			}
+			return singletonTraverser(nil)
+		}
+	}
+	return nil
+}
+
+// singletonTraverser returns a traverser over the single item, an empty one if the item is nil
+func singletonTraverser(item interface{}) Traverser {
+	return &untypedTraverser{nextFn: func() (interface{}, bool) {
+		next := item
+		item = nil
+		return next, next != nil
+	}}
+}
+
+// PeekTransform passes the items through unchanged and logs those that match shouldLogFn
+type PeekTransform struct {
+	*AbstractTransform
+	shouldLogFn TestFn
+	toStringFn  ApplyFn
+}
+
+func NewPeekTransform(upstream Transform, shouldLogFn TestFn, toStringFn ApplyFn) *PeekTransform {
+	return &PeekTransform{AbstractTransform: NewAbstractTransform("peek", []Transform{upstream}), shouldLogFn: shouldLogFn, toStringFn: toStringFn}
+}
+
+func (t *PeekTransform) addToDag(p *Planner) {
+	pv := p.addVertexFromGetFn(t, t.getName(), func() interface{} {
+		return NewPeekP(t.shouldLogFn, t.toStringFn)
+	})
+	p.addEdges(t, pv.v, nil)
+}
+
+// TimestampTransform assigns timestamps to the items and emits watermarks according to the eventTimePolicy
+type TimestampTransform struct {
+	*AbstractTransform
+	eventTimePolicy EventTimePolicy
+}
+
+func NewTimestampTransform(upstream Transform, eventTimePolicy EventTimePolicy) *TimestampTransform {
+	return &TimestampTransform{AbstractTransform: NewAbstractTransform("add-timestamps", []Transform{upstream}), eventTimePolicy: eventTimePolicy}
+}
+
+func (t *TimestampTransform) addToDag(p *Planner) {
+	policy := p.withWatermarkStride(t.eventTimePolicy)
+	pv := p.addVertexFromGetFn(t, t.getName(), func() interface{} {
+		return NewInsertWatermarksP(policy)
+	})
+	p.addEdges(t, pv.v, nil)
+}
+
+// MergeTransform emits all the items of all its upstream transforms
+type MergeTransform struct {
+	*AbstractTransform
+}
+
+func NewMergeTransform(upstream ...Transform) *MergeTransform {
+	return &MergeTransform{AbstractTransform: NewAbstractTransform("merge", upstream)}
+}
+
+func (m *MergeTransform) addToDag(p *Planner) {
+	pv := p.addVertexFromGetFn(m, m.getName(), func() interface{} {
+		return NewMapP(func(t interface{}) interface{} {
+			return t
+		})
+	})
+	p.addEdges(m, pv.v, nil)
+}
+
+// ProcessorTransform a transform whose processors are created by a user-supplied meta-supplier
+type ProcessorTransform struct {
+	*AbstractTransform
+	metaSupplier ProcessorMetaSupplier
+}
+
+func NewProcessorTransform(name string, upstream Transform, metaSupplier ProcessorMetaSupplier) *ProcessorTransform {
+	return &ProcessorTransform{AbstractTransform: NewAbstractTransform(name, []Transform{upstream}), metaSupplier: metaSupplier}
+}
+
+// NewKeyedProcessorTransform creates a ProcessorTransform whose processors receive all the items of a key keyFn extracts
+func NewKeyedProcessorTransform(name string, upstream Transform, metaSupplier ProcessorMetaSupplier, keyFn ApplyFn) *ProcessorTransform {
+	t := NewProcessorTransform(name, upstream, metaSupplier)
+	t.setPartitionKeyFnForInput(0, keyFn)
+	return t
+}
+
+// addToDag a keyed transform gets the items of a key on a single processor in the cluster
+func (t *ProcessorTransform) addToDag(p *Planner) {
+	pv := p.addVertex(t, t.getName(), t.metaSupplier)
+	p.addEdges(t, pv.v, func(edge *Edge, ordinal int) {
+		if t.partitionKeyFnForInput(ordinal) != nil {
+			edge.distributed()
+		}
+	})
+}
+
+// MapStatefulTransform keeps a state object for each key keyFn extracts, the items of a key are sent to a single
+// processor in the cluster. statefulFlatMapFn returns the Traverser of the items to emit for the state, the key and the item
+type MapStatefulTransform struct {
+	*AbstractTransform
+	keyFn             ApplyFn
+	createFn          GetFn
+	statefulFlatMapFn TriApplyFn
+}
+
+func NewMapStatefulTransform(name string, upstream Transform, keyFn ApplyFn, createFn GetFn, statefulFlatMapFn TriApplyFn) *MapStatefulTransform {
+	t := &MapStatefulTransform{AbstractTransform: NewAbstractTransform(name, []Transform{upstream}), keyFn: keyFn, createFn: createFn, statefulFlatMapFn: statefulFlatMapFn}
+	t.setPartitionKeyFnForInput(0, keyFn)
+	return t
+}
+
+func (t *MapStatefulTransform) addToDag(p *Planner) {
+	pv := p.addVertexFromGetFn(t, t.getName(), func() interface{} {
+		return NewMapStatefulP(t.keyFn, t.createFn, t.statefulFlatMapFn)
+	})
+	p.addEdges(t, pv.v, func(edge *Edge, ordinal int) {
+		edge.distributed()
+	})
+}
+
+// ServiceTransform emits the items of the Traverser flatMapFn returns for the service of the processor, the key and the
+// item. with a keyFn the items of a key are sent to a single processor in the cluster, without it the key is nil. an
+// async transform calls flatMapFn on separate goroutines, at most maxConcurrentOps per processor
+type ServiceTransform struct {
+	*AbstractTransform
+	serviceFactory   ServiceFactory
+	keyFn            ApplyFn
+	flatMapFn        TriApplyFn
+	async            bool
+	maxConcurrentOps int
+	preserveOrder    bool
+}
+
+func NewServiceTransform(name string, upstream Transform, serviceFactory ServiceFactory, keyFn ApplyFn, flatMapFn TriApplyFn) *ServiceTransform {
+	t := &ServiceTransform{AbstractTransform: NewAbstractTransform(name, []Transform{upstream}), serviceFactory: serviceFactory, keyFn: keyFn, flatMapFn: flatMapFn}
+	t.setPartitionKeyFnForInput(0, keyFn)
+	return t
+}
+
+// NewAsyncServiceTransform creates a ServiceTransform that calls flatMapFn asynchronously, unless preserveOrder is set
+// the results are emitted in the order they are ready
+func NewAsyncServiceTransform(name string, upstream Transform, serviceFactory ServiceFactory, keyFn ApplyFn, maxConcurrentOps int, preserveOrder bool, flatMapFn TriApplyFn) *ServiceTransform {
+	if maxConcurrentOps <= 0 {
+		panic(fmt.Sprintf("maxConcurrentOps must be positive, got %d", maxConcurrentOps))
+	}
+	t := NewServiceTransform(name, upstream, serviceFactory, keyFn, flatMapFn)
+	t.async = true
+	t.maxConcurrentOps = maxConcurrentOps
+	t.preserveOrder = preserveOrder
+	return t
+}
+
+func (t *ServiceTransform) addToDag(p *Planner) {
+	pv := p.addVertexFromGetFn(t, t.getName(), func() interface{} {
+		if t.async {
+			return NewAsyncTransformUsingServiceP(t.serviceFactory, t.keyFn, t.maxConcurrentOps, t.preserveOrder, t.flatMapFn)
+		}
+		return NewTransformUsingServiceP(t.serviceFactory, t.keyFn, t.flatMapFn)
+	})
+	p.addEdges(t, pv.v, func(edge *Edge, ordinal int) {
+		if t.keyFn != nil {
+			edge.distributed()
+		}
+	})
+}
+
+// SortTransform sends all the items to a single processor in the cluster, which emits them sorted once its input is exhausted
+type SortTransform struct {
+	*AbstractTransform
+}
+
+func NewSortTransform(upstream Transform) *SortTransform {
+	t := &SortTransform{AbstractTransform: NewAbstractTransform("sort", []Transform{upstream})}
+	t.setLocalParallelism(1)
+	return t
+}
+
+func (t *SortTransform) addToDag(p *Planner) {
+	pv := p.addVertexFromGetFn(t, t.getName(), func() interface{} {
+		return NewSortP()
+	})
+	p.addEdges(t, pv.v, func(edge *Edge, ordinal int) {
+		edge.distributed().allToOne(t.getName())
+	})
+}
+
+// GroupTransform groups the items of each input by the key groupKeyFns extract and aggregates each group. it's planned in two
+// stages if the operation can combine accumulators: the items are accumulated on the member they are on, then the partial
+// accumulators of each key are sent to a single processor in the cluster and combined. otherwise the items themselves are
+// sent to the processor of their key
+type GroupTransform struct {
+	*AbstractTransform
+	groupKeyFns   []ApplyFn
+	aggrOp        AggregateOperation
+	mapToOutputFn BiApplyFn
+}
+
+func NewGroupTransform(upstream []Transform, groupKeyFns []ApplyFn, aggrOp AggregateOperation, mapToOutputFn BiApplyFn) *GroupTransform {
+	g := &GroupTransform{AbstractTransform: NewAbstractTransform("group-and-aggregate", upstream), groupKeyFns: groupKeyFns, aggrOp: aggrOp, mapToOutputFn: mapToOutputFn}
+	for ordinal, keyFn := range groupKeyFns {
+		g.setPartitionKeyFnForInput(ordinal, keyFn)
+	}
+	return g
+}
+
+func (g *GroupTransform) addToDag(p *Planner) {
+	if g.aggrOp.getCombineFn() == nil {
+		g.addSingleStageToDag(p)
+		return
+	}
+	g.addTwoStagesToDag(p)
+}
+
+func (g *GroupTransform) addSingleStageToDag(p *Planner) {
+	pv := p.addVertexFromGetFn(g, g.getName(), func() interface{} {
+		return NewGroupP(g.groupKeyFns, g.aggrOp, g.mapToOutputFn)
+	})
+	p.addEdges(g, pv.v, func(edge *Edge, ordinal int) {
+		edge.distributed()
+	})
+}
+
+// addTwoStagesToDag the input edges of the first stage are local and partitioned, so each member has a single partial
+// accumulator of a key
+func (g *GroupTransform) addTwoStagesToDag(p *Planner) {
+	accumulatePv := p.addVertexFromGetFn(g, g.getName()+"-prepare", func() interface{} {
+		return NewAccumulateByKeyP(g.groupKeyFns, g.aggrOp)
+	})
+	p.addEdges(g, accumulatePv.v, nil)
+	combineVertex := p.dag.newUniqueVertex(g.getName(), func() interface{} {
+		return NewCombineByKeyP(g.aggrOp, g.mapToOutputFn)
+	}).setLocalParallelism(g.getDeterminedLocalParallelism())
+	p.dag.edge(From(accumulatePv.v, accumulatePv.nextAvailableOrdinal()).To(combineVertex, 0).distributed().partitionedByKey(func(t interface{}) interface{} {
+		return t.(MapEntry).key
+	}))
+	p.xform2vertex[g] = NewPlannerVertex(combineVertex)
+}
+
+// WindowGroupTransform groups the items of each input by the key groupKeyFns extract and aggregates each group in the
+// windows of the event timestamps. the items are TimestampedItems and are sent to the processor of their key. with a
+// LateEventsTransform downstream, the late items are emitted at an ordinal of their own
+type WindowGroupTransform struct {
+	*AbstractTransform
+	wDef          WindowDefinition
+	groupKeyFns   []ApplyFn
+	aggrOp        AggregateOperation
+	mapToOutputFn KeyedWindowResultFn
+	hasLateEvents bool
+	// lateEventsOrdinal the outbound ordinal of the late items, reserved when the transform is added to the DAG
+	lateEventsOrdinal int
+}
+
+func NewWindowGroupTransform(upstream []Transform, wDef WindowDefinition, groupKeyFns []ApplyFn, aggrOp AggregateOperation, mapToOutputFn KeyedWindowResultFn) *WindowGroupTransform {
+	g := &WindowGroupTransform{AbstractTransform: NewAbstractTransform("window-group-and-aggregate", upstream), wDef: wDef, groupKeyFns: groupKeyFns, aggrOp: aggrOp, mapToOutputFn: mapToOutputFn, lateEventsOrdinal: -1}
+	for ordinal, keyFn := range groupKeyFns {
+		g.setPartitionKeyFnForInput(ordinal, keyFn)
+	}
+	return g
+}
+
+func (g *WindowGroupTransform) preferredWatermarkStride() int64 {
+	return g.wDef.preferredWatermarkStride()
+}
+
+func (g *WindowGroupTransform) addToDag(p *Planner) {
+	timestampFns := make([]ApplyAsLongFn, len(g.groupKeyFns))
+	for i := range timestampFns {
+		timestampFns[i] = timestampOf
+	}
+	pv := p.addVertexFromGetFn(g, g.getName(), func() interface{} {
+		lateness := NewWindowLateness(g.wDef.allowedLateness, g.lateEventsOrdinal)
+		if g.wDef.kind == SESSION_WINDOW {
+			return NewSessionWindowP(g.wDef.sessionTimeout, g.groupKeyFns, timestampFns, g.wDef.earlyResultPeriodMs, lateness, g.aggrOp, g.mapToOutputFn)
+		}
+		return NewSlidingWindowP(g.groupKeyFns, timestampFns, g.wDef.toSlidingWindowPolicy(), g.wDef.earlyResultPeriodMs, lateness, g.aggrOp, g.mapToOutputFn)
+	})
+	if g.hasLateEvents {
+		g.lateEventsOrdinal = pv.nextAvailableOrdinal()
+	}
+	p.addEdges(g, pv.v, func(edge *Edge, ordinal int) {
+		edge.distributed()
+	})
+}
+
+// LateEventsTransform the items its WindowGroupTransform received later than the allowed lateness of their windows
+type LateEventsTransform struct {
+	*AbstractTransform
+	window *WindowGroupTransform
+}
+
+func NewLateEventsTransform(window *WindowGroupTransform) *LateEventsTransform {
+	window.hasLateEvents = true
+	return &LateEventsTransform{AbstractTransform: NewAbstractTransform(window.getName()+"-late-events", []Transform{window}), window: window}
+}
+
+// addToDag the vertex passes on the items the window vertex emits at its late events ordinal
+func (l *LateEventsTransform) addToDag(p *Planner) {
+	pv := p.addVertexFromGetFn(l, l.getName(), func() interface{} {
+		return NewMapP(func(t interface{}) interface{} {
+			return t
+		})
+	})
+	p.addEdgesFrom(l, pv.v, func(ordinal int, fromTransform Transform) *PlannerVertex {
+		return &PlannerVertex{v: p.xform2vertex[fromTransform].v, availableOrdinal: l.window.lateEventsOrdinal}
+	}, nil)
+}
+
+// SinkTransform the transform of a sink, it accepts the items of all its upstream transforms. the sink receives the items
+// without their timestamps
+type SinkTransform struct {
+	*AbstractTransform
+	sink *SinkImpl
+	// timestampedInput whether the items of an input are TimestampedItems
+	timestampedInput []bool
+}
+
+func NewSinkTransform(sink *SinkImpl, upstream []Transform) *SinkTransform {
+	return &SinkTransform{AbstractTransform: NewAbstractTransform(sink.name(), upstream), sink: sink, timestampedInput: make([]bool, len(upstream))}
+}
+
+// addToDag the TimestampedItems of an input are unwrapped by a vertex between the upstream vertex and the sink
+func (t *SinkTransform) addToDag(p *Planner) {
+	pv := p.addVertex(t, t.getName(), t.sink.metaSupplier)
+	p.addEdgesFrom(t, pv.v, func(ordinal int, fromTransform Transform) *PlannerVertex {
+		fromPv := p.xform2vertex[fromTransform]
+		if !t.timestampedInput[ordinal] {
+			return fromPv
+		}
+		unwrapVertex := p.dag.newUniqueVertex(t.getName()+"-remove-timestamps", func() interface{} {
+			return NewMapP(func(t interface{}) interface{} {
+				return t.(TimestampedItem).item
+			})
+		}).setLocalParallelism(fromTransform.getDeterminedLocalParallelism())
+		p.dag.edge(From(fromPv.v, fromPv.nextAvailableOrdinal()).To(unwrapVertex, 0).isolated())
+		return NewPlannerVertex(unwrapVertex)
+	}, nil)
+}
+
 // checkLocalParallelism whether the given integer is valid
 func checkLocalParallelism(parallelism int) int {
 	if parallelism != LOCAL_PARALLELISM_USE_DEFAULT && parallelism < 0 {
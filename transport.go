@@ -0,0 +1,74 @@
+package stream_processing
+
+import (
+	"fmt"
+)
+
+// Address the network address of a cluster member
+type Address struct {
+	host string
+	port int
+}
+
+func NewAddress(host string, port int) Address {
+	return Address{host: host, port: port}
+}
+
+func (a Address) String() string {
+	return fmt.Sprintf("[%s]:%d", a.host, a.port)
+}
+
+// LOCAL_ADDRESS the address of a member that runs standalone, without a Transport
+var LOCAL_ADDRESS = NewAddress("127.0.0.1", 5701)
+
+// PacketType the kind of the Packet
+type PacketType int
+
+const (
+	// DATA_PACKET carries a batch of items, and possibly a watermark and the end of the stream, to the receiving member
+	DATA_PACKET PacketType = iota
+
+	// ACK_PACKET acknowledges to the sending member the items the receiving member passed to its processors
+	ACK_PACKET
+)
+
+// Packet the unit of data exchanged between members over a distributed edge. it is addressed to the inbound edge
+// with the given ordinal of the destination vertex on the receiving member
+type Packet struct {
+	packetType PacketType
+	jobId      int64
+	vertexName string
+	ordinal    int
+	sender     Address
+
+	// payload the serialized items of a DATA_PACKET
+	payload []byte
+
+	// watermark the coalesced watermark that follows the items of a DATA_PACKET, NO_NEW_WM if there is none
+	watermark int64
+
+	// snapshotId the snapshot whose barrier follows the items and the watermark of a DATA_PACKET, NO_SNAPSHOT if there is none
+	snapshotId int64
+
+	// done whether all the upstream processors on the sending member are done, nothing follows this packet
+	done bool
+
+	// ackCount the number of items acknowledged by an ACK_PACKET
+	ackCount int64
+}
+
+// PacketHandler receives the packets addressed to a member
+type PacketHandler func(packet *Packet)
+
+// Transport sends packets between the members of a cluster
+type Transport interface {
+
+	// localAddress return the address of the member this transport belongs to
+	localAddress() Address
+
+	// send the packet to the member with the given address, return an error if the member is unknown
+	send(target Address, packet *Packet) error
+
+	// setPacketHandler sets the handler of the packets received from other members, it must not block
+	setPacketHandler(handler PacketHandler)
+}
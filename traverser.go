@@ -113,7 +113,7 @@ type ResultTraverser struct {
 
 func NewResultTraverser(m map[interface{}]interface{}) *ResultTraverser {
 	t := new(ResultTraverser)
-	t.queue = list.New()
+	t.AbstractTraverser = NewAbstractTraverser()
 	for k, v := range m {
 		entry := MapEntry{key: k, value: v}
 		t.queue.PushBack(entry)
@@ -135,10 +135,31 @@ func (r *ResettableSingletonTraverser) next() interface{} {
 	return v
 }
 
+// lazy return a traverser that takes its items from this one as they are requested, so an item accepted later is
+// still seen by the traversers derived from it
+func (r *ResettableSingletonTraverser) lazy() Traverser {
+	return &untypedTraverser{nextFn: func() (interface{}, bool) {
+		item := r.next()
+		return item, item != nil
+	}}
+}
+
 func (r *ResettableSingletonTraverser) mapX(mapFn ApplyFn) Traverser {
-	panic("implement me")
+	return r.lazy().mapX(mapFn)
 }
 
 func (r *ResettableSingletonTraverser) filter(filterFn TestFn) Traverser {
-	panic("implement me")
+	return r.lazy().filter(filterFn)
+}
+
+func (r *ResettableSingletonTraverser) append(item interface{}) Traverser {
+	return r.lazy().append(item)
+}
+
+func (r *ResettableSingletonTraverser) traverseItems(items ...interface{}) Traverser {
+	return r.lazy().traverseItems(items...)
+}
+
+func (r *ResettableSingletonTraverser) flatMap(fn ApplyFn) Traverser {
+	return r.lazy().flatMap(fn)
 }
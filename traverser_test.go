@@ -36,3 +36,34 @@ func TestAppendableTraverser_smoke(t *testing.T) {
 	assert.Nil(t, tt.t.next())
 }
 
+
+func TestResettableSingletonTraverser_when_derived_then_itemsTakenFromSingleton(t *testing.T) {
+	teardownTest, _ := TraverserTestSetup(t)
+	defer teardownTest(t)
+
+	r := &ResettableSingletonTraverser{}
+	mapped := r.mapX(func(item interface{}) interface{} {
+		return item.(int) * 10
+	}).filter(func(item interface{}) bool {
+		return item.(int) > 10
+	})
+	r.accept(1)
+	assert.Nil(t, mapped.next())
+	r.accept(2)
+	assert.Equal(t, 20, mapped.next())
+
+	r.accept(1)
+	appended := r.traverseItems(2, 3)
+	assert.Equal(t, 1, appended.next())
+	assert.Equal(t, 2, appended.next())
+	assert.Equal(t, 3, appended.next())
+	assert.Nil(t, appended.next())
+
+	r.accept(2)
+	flatMapped := r.flatMap(func(item interface{}) interface{} {
+		return NewAppendableTraverser().traverseItems(item, item)
+	})
+	assert.Equal(t, 2, flatMapped.next())
+	assert.Equal(t, 2, flatMapped.next())
+	assert.Nil(t, flatMapped.next())
+}
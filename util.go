@@ -18,4 +18,53 @@ func NewProgressState(madeProgress bool, isDone bool) *ProgressState {
 	return &ProgressState{madeProgress: madeProgress, isDone: isDone}
 }
 
+// progressStateValueOf returns the shared ProgressState instance with the given flags
+func progressStateValueOf(madeProgress bool, isDone bool) *ProgressState {
+	if isDone {
+		if madeProgress {
+			return DONE
+		}
+		return WAS_ALREADY_DONE
+	}
+	if madeProgress {
+		return MADE_PROGRESS
+	}
+	return NO_PROGRESS
+}
+
+// ProgressTracker tracks the overall progress and completion state of a multi-stage operation
+type ProgressTracker struct {
+	isMadeProgress bool
+	isDone         bool
+}
+
+func NewProgressTracker() *ProgressTracker {
+	return &ProgressTracker{isDone: true}
+}
+
+// reset resets the tracker to the initial state: no progress made and done
+func (t *ProgressTracker) reset() {
+	t.isMadeProgress = false
+	t.isDone = true
+}
 
+// notDone records that the operation is not done yet
+func (t *ProgressTracker) notDone() {
+	t.isDone = false
+}
+
+// madeProgress records that progress was made
+func (t *ProgressTracker) madeProgress() {
+	t.isMadeProgress = true
+}
+
+// mergeWith merges the given progress state into the tracked state
+func (t *ProgressTracker) mergeWith(state *ProgressState) {
+	t.isMadeProgress = t.isMadeProgress || state.madeProgress
+	t.isDone = t.isDone && state.isDone
+}
+
+// toProgressState returns the tracked state as a ProgressState
+func (t *ProgressTracker) toProgressState() *ProgressState {
+	return progressStateValueOf(t.isMadeProgress, t.isDone)
+}
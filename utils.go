@@ -108,4 +108,12 @@ func floorDiv(x int64, y int64) int64 {
 
 func MillsToNanos(timestamp int64) int64 {
 	return time.Unix(timestamp, 0).UnixNano()
-}
\ No newline at end of file
+}
+
+// Gcd returns the greatest common divisor of a and b
+func Gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
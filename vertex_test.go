@@ -6,7 +6,9 @@ import (
 )
 
 func TestVertex_when_constructed_then_hasDefaultParallelism(t *testing.T) {
-	v := NewVertex("v", NewNoopP())
+	v := NewVertex("v", NewProcessorSupplierFromGetFn(func() interface{} {
+		return NewNoopP()
+	}))
 
 	assert.Equal(t, -1, v.localParallelism)
 }
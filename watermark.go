@@ -1,5 +1,12 @@
 package stream_processing
 
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
 // WatermarkPolicy tracks and determines the current Watermark given the event timestamps as they occur for a single input stream
 type WatermarkPolicy interface {
 	// reportEvent called to report the observation of an event with the given timestamp
@@ -30,6 +37,131 @@ func (l *limitingLag) getCurrentWatermark() int64 {
 	return l.wm
 }
 
+// eventWatermarkPolicy a WatermarkPolicy that looks at the events themselves, the EventTimeMapper reports them instead
+// of their timestamps only
+type eventWatermarkPolicy interface {
+	reportEventItem(event interface{}, timestamp int64)
+}
+
+// limitingRealTimeLag maintains a watermark that lags behind the top observed timestamp by the given amount, once no
+// event arrived for maxLullMs of wall-clock time it advances with the wall-clock time, so the windows of a stream
+// whose events stopped still close
+type limitingRealTimeLag struct {
+	lag         int64
+	maxLullMs   int64
+	topTs       int64
+	lastEventAt int64
+	wm          int64
+	// nowFn returns the wall-clock time in milliseconds
+	nowFn func() int64
+}
+
+func newLimitingRealTimeLag(lag, maxLullMs int64) *limitingRealTimeLag {
+	return &limitingRealTimeLag{lag: lag, maxLullMs: maxLullMs, topTs: Min_Value, wm: Min_Value, nowFn: func() int64 {
+		return time.Now().UnixMilli()
+	}}
+}
+
+func (l *limitingRealTimeLag) reportEvent(timestamp int64) {
+	l.topTs = Max64(l.topTs, timestamp)
+	l.lastEventAt = l.nowFn()
+}
+
+func (l *limitingRealTimeLag) getCurrentWatermark() int64 {
+	if l.topTs == Min_Value {
+		return l.wm
+	}
+	wm := SubtractClamped(l.topTs, l.lag)
+	if lull := l.nowFn() - l.lastEventAt; lull > l.maxLullMs {
+		wm = addClamped(wm, lull-l.maxLullMs)
+	}
+	l.wm = Max64(l.wm, wm)
+	return l.wm
+}
+
+// boundedOutOfOrderness maintains a watermark that lags behind the top observed timestamp by a lag it learns from the
+// events: the percentile of how far the last sampleSize events were behind the top timestamp when they arrived
+type boundedOutOfOrderness struct {
+	percentile float64
+	sampleSize int
+	// delays the ring buffer of the sampled delays, next is the index of the oldest one once it's full
+	delays   []int64
+	next     int
+	topTs    int64
+	lag      int64
+	lagStale bool
+	wm       int64
+}
+
+func newBoundedOutOfOrderness(percentile float64, sampleSize int) *boundedOutOfOrderness {
+	if percentile <= 0 || percentile > 1 {
+		panic(fmt.Sprintf("percentile must be in (0, 1], percentile=%v", percentile))
+	}
+	if sampleSize <= 0 {
+		panic(fmt.Sprintf("sampleSize must be positive, sampleSize=%d", sampleSize))
+	}
+	return &boundedOutOfOrderness{percentile: percentile, sampleSize: sampleSize, topTs: Min_Value, wm: Min_Value}
+}
+
+func (b *boundedOutOfOrderness) reportEvent(timestamp int64) {
+	b.topTs = Max64(b.topTs, timestamp)
+	delay := SubtractClamped(b.topTs, timestamp)
+	if len(b.delays) < b.sampleSize {
+		b.delays = append(b.delays, delay)
+	} else {
+		b.delays[b.next] = delay
+		b.next = (b.next + 1) % b.sampleSize
+	}
+	b.lagStale = true
+}
+
+func (b *boundedOutOfOrderness) getCurrentWatermark() int64 {
+	if b.topTs == Min_Value {
+		return b.wm
+	}
+	if b.lagStale {
+		b.lag = b.percentileDelay()
+		b.lagStale = false
+	}
+	b.wm = Max64(b.wm, SubtractClamped(b.topTs, b.lag))
+	return b.wm
+}
+
+// percentileDelay returns the nearest-rank percentile of the sampled delays
+func (b *boundedOutOfOrderness) percentileDelay() int64 {
+	sorted := append([]int64(nil), b.delays...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	rank := int(math.Ceil(b.percentile * float64(len(sorted))))
+	return sorted[rank-1]
+}
+
+// punctuated advances the watermark to the timestamp of each marker event isMarkerFn matches, the other events don't
+// move it
+type punctuated struct {
+	isMarkerFn TestFn
+	wm         int64
+}
+
+func newPunctuated(isMarkerFn TestFn) *punctuated {
+	return &punctuated{isMarkerFn: isMarkerFn, wm: Min_Value}
+}
+
+// reportEvent a timestamp alone tells nothing about a marker
+func (p *punctuated) reportEvent(timestamp int64) {
+}
+
+func (p *punctuated) reportEventItem(event interface{}, timestamp int64) {
+	if p.isMarkerFn(event) {
+		p.wm = Max64(p.wm, timestamp)
+	}
+}
+
+func (p *punctuated) getCurrentWatermark() int64 {
+	return p.wm
+}
+
 // Watermark ...
 type Watermark struct {
 	timestamp int64
@@ -38,3 +170,93 @@ type Watermark struct {
 func NewWatermark(timestamp int64) *Watermark {
 	return &Watermark{timestamp: timestamp}
 }
+
+// IDLE_MESSAGE a watermark that signals the stream is idle: it is excluded from the watermark coalescing downstream until it emits again
+var IDLE_MESSAGE = NewWatermark(Max_Value)
+
+// isIdleMessage tells whether this watermark is the IDLE_MESSAGE
+func (w *Watermark) isIdleMessage() bool {
+	return w.timestamp == IDLE_MESSAGE.timestamp
+}
+
+// NO_NEW_WM returned by WatermarkCoalescer when there is no new watermark to forward
+const NO_NEW_WM = Min_Value
+
+// WatermarkCoalescer coalesces the watermarks observed on several input queues. the coalesced watermark is the minimum
+// of the watermarks of all queues that are neither done nor idle
+type WatermarkCoalescer struct {
+	queueWms         []int64
+	isIdle           []bool
+	isDone           []bool
+	activeQueueCount int
+	lastEmittedWm    int64
+	idleMessageSent  bool
+}
+
+func NewWatermarkCoalescer(queueCount int) *WatermarkCoalescer {
+	c := &WatermarkCoalescer{
+		queueWms:         make([]int64, queueCount),
+		isIdle:           make([]bool, queueCount),
+		isDone:           make([]bool, queueCount),
+		activeQueueCount: queueCount,
+		lastEmittedWm:    Min_Value,
+	}
+	for i := range c.queueWms {
+		c.queueWms[i] = Min_Value
+	}
+	return c
+}
+
+// observeEvent called when an event was received from the queue, an idle queue becomes active again
+func (c *WatermarkCoalescer) observeEvent(queueIndex int) {
+	c.isIdle[queueIndex] = false
+}
+
+// observeWm called when a watermark was received from the queue, return the watermark to forward or NO_NEW_WM
+func (c *WatermarkCoalescer) observeWm(queueIndex int, wmValue int64) int64 {
+	if wmValue == IDLE_MESSAGE.timestamp {
+		c.isIdle[queueIndex] = true
+	} else {
+		c.isIdle[queueIndex] = false
+		c.queueWms[queueIndex] = Max64(c.queueWms[queueIndex], wmValue)
+	}
+	return c.checkObservedWms()
+}
+
+// queueDone called when the queue received its last item, return the watermark to forward or NO_NEW_WM
+func (c *WatermarkCoalescer) queueDone(queueIndex int) int64 {
+	if c.isDone[queueIndex] {
+		panic("Duplicate done call")
+	}
+	c.isDone[queueIndex] = true
+	c.activeQueueCount--
+	return c.checkObservedWms()
+}
+
+func (c *WatermarkCoalescer) checkObservedWms() int64 {
+	if c.activeQueueCount == 0 {
+		return NO_NEW_WM
+	}
+	min := Max_Value
+	allIdle := true
+	for i, wm := range c.queueWms {
+		if c.isDone[i] || c.isIdle[i] {
+			continue
+		}
+		allIdle = false
+		min = Min64(min, wm)
+	}
+	if allIdle {
+		if c.idleMessageSent {
+			return NO_NEW_WM
+		}
+		c.idleMessageSent = true
+		return IDLE_MESSAGE.timestamp
+	}
+	if min > c.lastEmittedWm {
+		c.lastEmittedWm = min
+		c.idleMessageSent = false
+		return min
+	}
+	return NO_NEW_WM
+}
@@ -57,3 +57,52 @@ func TestWatermark_when_noEventEver_then_minValue(t *testing.T) {
 		assert.Equal(t, Min_Value, wt.p.getCurrentWatermark())
 	}
 }
+
+func TestWatermark_when_limitingRealTimeLagAndEventsStop_then_wmAdvancesWithWallClock(t *testing.T) {
+	teardownTest, wt := WatermarkTestSetup(t)
+	defer teardownTest(t)
+	now := int64(1000)
+	p := newLimitingRealTimeLag(wt.LAG, 5)
+	p.nowFn = func() int64 {
+		return now
+	}
+
+	assert.Equal(t, Min_Value, p.getCurrentWatermark())
+	p.reportEvent(100)
+	p.reportEvent(95)
+	assert.Equal(t, 100-wt.LAG, p.getCurrentWatermark())
+	now += 5
+	assert.Equal(t, 100-wt.LAG, p.getCurrentWatermark())
+	now += 3
+	assert.Equal(t, 103-wt.LAG, p.getCurrentWatermark())
+
+	// an event older than the advanced watermark doesn't move it back
+	p.reportEvent(101)
+	assert.Equal(t, 103-wt.LAG, p.getCurrentWatermark())
+}
+
+func TestWatermark_when_boundedOutOfOrderness_then_lagLearnedFromPercentile(t *testing.T) {
+	teardownTest, _ := WatermarkTestSetup(t)
+	defer teardownTest(t)
+	p := newBoundedOutOfOrderness(0.75, 4)
+
+	assert.Equal(t, Min_Value, p.getCurrentWatermark())
+	p.reportEvent(100)
+	assert.Equal(t, int64(100), p.getCurrentWatermark())
+	for _, timestamp := range []int64{98, 95, 99} {
+		p.reportEvent(timestamp)
+	}
+	// the delays are 0, 2, 5 and 1
+	assert.Equal(t, int64(100), p.getCurrentWatermark())
+	p.reportEvent(110)
+	assert.Equal(t, int64(108), p.getCurrentWatermark())
+
+	// the oldest delays leave the sample
+	for _, timestamp := range []int64{111, 112, 113} {
+		p.reportEvent(timestamp)
+	}
+	assert.Equal(t, int64(113), p.getCurrentWatermark())
+	assert.Panics(t, func() {
+		newBoundedOutOfOrderness(0, 4)
+	})
+}
@@ -1,5 +1,17 @@
 package stream_processing
 
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/emirpasic/gods/maps/treemap"
+	"github.com/emirpasic/gods/sets/hashset"
+	"github.com/emirpasic/gods/utils"
+)
+
 // StageWithWindow you can perform a global aggregation or add a grouping key to perform a group-and-aggregate operation
 type StageWithWindow interface {
 
@@ -11,11 +23,100 @@ type StageWithWindow interface {
 	groupingKey(keyFn ApplyFn) StageWithKeyAndWindow
 }
 
+// WindowKind the kind of the window a WindowDefinition describes
+type WindowKind int
+
+const (
+	// SLIDING_WINDOW a window of a fixed size that slides by a fixed step, a tumbling window slides by its size
+	SLIDING_WINDOW WindowKind = iota
+	// SESSION_WINDOW a window of the items of a key that are less than the session timeout apart
+	SESSION_WINDOW
+)
+
 // WindowDefinition The definition of the window for a windowed aggregation operation
 type WindowDefinition struct {
+	kind                WindowKind
+	windowSize          int64
+	slideBy             int64
+	sessionTimeout      int64
 	earlyResultPeriodMs int64
+	allowedLateness     int64
+}
+
+// NewSlidingWindowDefinition returns the definition of a sliding window of length windowSize that slides by slideBy,
+// windowSize must be a multiple of slideBy
+func NewSlidingWindowDefinition(windowSize, slideBy int64) WindowDefinition {
+	if windowSize <= 0 || slideBy <= 0 || windowSize%slideBy != 0 {
+		panic(fmt.Sprintf("windowSize must be a positive multiple of slideBy, windowSize=%d slideBy=%d", windowSize, slideBy))
+	}
+	return WindowDefinition{kind: SLIDING_WINDOW, windowSize: windowSize, slideBy: slideBy}
+}
+
+// NewTumblingWindowDefinition returns the definition of a tumbling window of length windowSize
+func NewTumblingWindowDefinition(windowSize int64) WindowDefinition {
+	return NewSlidingWindowDefinition(windowSize, windowSize)
+}
+
+// NewSessionWindowDefinition returns the definition of a session window, a session ends once no item of its key arrived
+// for sessionTimeout
+func NewSessionWindowDefinition(sessionTimeout int64) WindowDefinition {
+	if sessionTimeout <= 0 {
+		panic(fmt.Sprintf("sessionTimeout must be positive, sessionTimeout=%d", sessionTimeout))
+	}
+	return WindowDefinition{kind: SESSION_WINDOW, sessionTimeout: sessionTimeout}
+}
+
+// setEarlyResultsPeriod returns a copy of the definition whose windows emit early results every earlyResultPeriodMs of
+// wall-clock time until they are closed, zero disables them
+func (w WindowDefinition) setEarlyResultsPeriod(earlyResultPeriodMs int64) WindowDefinition {
+	if earlyResultPeriodMs < 0 {
+		panic(fmt.Sprintf("earlyResultPeriodMs must not be negative, earlyResultPeriodMs=%d", earlyResultPeriodMs))
+	}
+	w.earlyResultPeriodMs = earlyResultPeriodMs
+	return w
+}
+
+// setAllowedLateness returns a copy of the definition whose windows are kept for allowedLateness after the watermark
+// passed them, the late items update them and their results are emitted again
+func (w WindowDefinition) setAllowedLateness(allowedLateness int64) WindowDefinition {
+	if allowedLateness < 0 {
+		panic(fmt.Sprintf("allowedLateness must not be negative, allowedLateness=%d", allowedLateness))
+	}
+	w.allowedLateness = allowedLateness
+	return w
+}
+
+// toSlidingWindowPolicy returns the policy of the frames and windows of a sliding window definition
+func (w WindowDefinition) toSlidingWindowPolicy() *SlidingWindowPolicy {
+	return NewSlidingWithPolicy(w.windowSize, w.slideBy)
+}
+
+// preferredWatermarkStride the windows of a sliding window end at the frame boundaries, a more frequent watermark changes nothing
+// a session window has no preference
+func (w WindowDefinition) preferredWatermarkStride() int64 {
+	if w.kind == SESSION_WINDOW {
+		return 0
+	}
+	return w.slideBy
+}
+
+// KeyedWindowResult the result of the aggregation of the items with the same key in the window [start, end), an early
+// result is a partial one of a window that is not closed yet
+type KeyedWindowResult struct {
+	start   int64
+	end     int64
+	key     interface{}
+	result  interface{}
+	isEarly bool
+}
+
+func NewKeyedWindowResult(start, end int64, key, result interface{}, isEarly bool) KeyedWindowResult {
+	return KeyedWindowResult{start: start, end: end, key: key, result: result, isEarly: isEarly}
 }
 
+// KeyedWindowResultFn maps the result of a window to the item the processor emits
+type KeyedWindowResultFn func(start, end int64, key, result interface{}, isEarly bool) interface{}
+
 // SlidingWindowPolicy contains parameters that define a sliding/tumbling window over which will apply an aggregate function
 // A frame is labelled with its timestamp
 type SlidingWindowPolicy struct {
@@ -76,3 +177,779 @@ func (p *SlidingWindowPolicy) withOffset(offset int64) *SlidingWindowPolicy {
 func (p *SlidingWindowPolicy) toTumblingByFrame() *SlidingWindowPolicy {
 	return NewSlidingWindowPolicy(p.frameSize, p.frameOffset, 1)
 }
+
+// earlyResultsTimer tells a windowed aggregation when to emit the next early results, a zero period never does
+type earlyResultsTimer struct {
+	period  int64
+	next    int64
+	started bool
+}
+
+func newEarlyResultsTimer(period int64, aggrOp AggregateOperation) earlyResultsTimer {
+	if period > 0 && aggrOp.getExportFn() == nil {
+		panic("early results require an aggregate operation with exportFn")
+	}
+	return earlyResultsTimer{period: period}
+}
+
+// isDue whether the period elapsed since the last early results, the first period starts with the first call
+func (t *earlyResultsTimer) isDue(nowMs int64) bool {
+	if t.period == 0 {
+		return false
+	}
+	if !t.started {
+		t.started = true
+		t.next = nowMs + t.period
+		return false
+	}
+	if nowMs < t.next {
+		return false
+	}
+	t.next = nowMs + t.period
+	return true
+}
+
+// WindowLateness how long a windowed aggregation keeps a window after the watermark passed it, a late item within it
+// updates the window and its result is emitted again. the items later than that are emitted to lateEventsOrdinal,
+// or logged and dropped if it's -1
+type WindowLateness struct {
+	allowedLateness   int64
+	lateEventsOrdinal int
+}
+
+func NewWindowLateness(allowedLateness int64, lateEventsOrdinal int) WindowLateness {
+	if allowedLateness < 0 {
+		panic(fmt.Sprintf("allowedLateness must not be negative, allowedLateness=%d", allowedLateness))
+	}
+	return WindowLateness{allowedLateness: allowedLateness, lateEventsOrdinal: lateEventsOrdinal}
+}
+
+// NO_LATENESS closes a window as soon as the watermark passes it and drops the late items
+var NO_LATENESS = WindowLateness{lateEventsOrdinal: -1}
+
+// windowOutput emits the results and the late items of a windowed aggregation, the results go to all the ordinals
+// but the one of the late items
+type windowOutput struct {
+	lateness       WindowLateness
+	processor      *AbstractProcessor
+	resultOrdinals []int
+	logger         *log.Logger
+}
+
+func (o *windowOutput) init(ctx context.Context, processor *AbstractProcessor, outbox Outbox) {
+	o.processor = processor
+	o.logger = log.Default()
+	if c := ProcessorContextOf(ctx); c != nil {
+		o.logger = c.getLogger()
+	}
+	if o.lateness.lateEventsOrdinal < 0 {
+		return
+	}
+	o.resultOrdinals = []int{}
+	for ordinal := 0; ordinal < outbox.bucketCount(); ordinal++ {
+		if ordinal != o.lateness.lateEventsOrdinal {
+			o.resultOrdinals = append(o.resultOrdinals, ordinal)
+		}
+	}
+}
+
+func (o *windowOutput) emitResults(results Traverser) bool {
+	if o.resultOrdinals == nil {
+		return o.processor.emitFromTraverser(-1, results)
+	}
+	return o.processor.emitFromTraverserWithMany(o.resultOrdinals, results)
+}
+
+// tryEmitLateEvent emits the item to the late events ordinal, without one the item is dropped but not silently
+func (o *windowOutput) tryEmitLateEvent(item interface{}, watermark int64) bool {
+	if o.lateness.lateEventsOrdinal < 0 {
+		o.logger.Printf("Dropped late event %v, watermark %d", item, watermark)
+		return true
+	}
+	return o.processor.tryEmit(o.lateness.lateEventsOrdinal, item)
+}
+
+// NEXT_WIN_TO_EMIT_KEY the snapshot key of the end of the next window SlidingWindowP emits
+const NEXT_WIN_TO_EMIT_KEY = "nextWinToEmit"
+
+// CURRENT_WATERMARK_KEY the snapshot key of the last watermark a window processor received
+const CURRENT_WATERMARK_KEY = "currentWatermark"
+
+// LATE_UPDATED_WINDOWS_KEY the snapshot key of the ends of the windows SlidingWindowP emits again on the next watermark
+const LATE_UPDATED_WINDOWS_KEY = "lateUpdatedWindows"
+
+// SlidingWindowP aggregates the items by key and frame, a frame is labelled with its end timestamp. on a watermark it emits
+// the result of each window that ends at or before it. if the operation can deduct, the processor keeps the accumulators
+// of the last emitted window and slides it by combining the next frame and deducting the oldest one, otherwise each window
+// is combined from its frames. with an early results period the windows that are not closed emit partial results. a frame
+// is kept for the allowed lateness after the watermark passed its last window, the windows a late item updates are
+// emitted again on the next watermark
+type SlidingWindowP struct {
+	*AbstractProcessor
+	keyFns        []ApplyFn
+	timestampFns  []ApplyAsLongFn
+	winPolicy     *SlidingWindowPolicy
+	aggrOp        AggregateOperation
+	mapToOutputFn KeyedWindowResultFn
+	output        windowOutput
+	// tsToKeyToAcc the accumulators by frame and key, a frame is purged once no window that contains it can be updated
+	tsToKeyToAcc map[int64]map[interface{}]interface{}
+	// slidingWindow the accumulators of the last emitted window, nil unless the windows slide by deducting
+	slidingWindow map[interface{}]interface{}
+	// slidingWindowFrames the number of frames of the sliding window that hold an accumulator of the key, the key
+	// leaves the window once all of them are deducted
+	slidingWindowFrames map[interface{}]int
+	// nextWinToEmit the end of the next window to emit
+	nextWinToEmit   int64
+	nextWinRestored bool
+	// currentWatermark the items of the frames it passed by the allowed lateness are late
+	currentWatermark  int64
+	watermarkRestored bool
+	// lateUpdatedWindows the ends of the emitted windows late items updated
+	lateUpdatedWindows map[int64]bool
+	topTs              int64
+	flushTraverser     Traverser
+	snapshotEntries    []MapEntry
+	earlyResults       earlyResultsTimer
+	earlyTraverser     Traverser
+}
+
+func NewSlidingWindowP(keyFns []ApplyFn, timestampFns []ApplyAsLongFn, winPolicy *SlidingWindowPolicy, earlyResultsPeriod int64, lateness WindowLateness, aggrOp AggregateOperation, mapToOutputFn KeyedWindowResultFn) *SlidingWindowP {
+	if !winPolicy.isTumbling() && aggrOp.getCombineFn() == nil {
+		panic("a sliding window requires an aggregate operation with combineFn")
+	}
+	p := &SlidingWindowP{
+		keyFns:             keyFns,
+		timestampFns:       timestampFns,
+		winPolicy:          winPolicy,
+		aggrOp:             aggrOp,
+		mapToOutputFn:      mapToOutputFn,
+		output:             windowOutput{lateness: lateness},
+		tsToKeyToAcc:       make(map[int64]map[interface{}]interface{}),
+		nextWinToEmit:      Min_Value,
+		currentWatermark:   Min_Value,
+		lateUpdatedWindows: make(map[int64]bool),
+		topTs:              Min_Value,
+		earlyResults:       newEarlyResultsTimer(earlyResultsPeriod, aggrOp),
+	}
+	if !winPolicy.isTumbling() && aggrOp.getDeductFn() != nil {
+		p.resetSlidingWindow()
+	}
+	p.AbstractProcessor = NewAbstractProcessor(p)
+	return p
+}
+
+func (p *SlidingWindowP) init(ctx context.Context, outbox Outbox) {
+	p.AbstractProcessor.init(ctx, outbox)
+	p.output.init(ctx, p.AbstractProcessor, outbox)
+}
+
+func (p *SlidingWindowP) tryProcess(ordinal int, item interface{}) bool {
+	frameTs := p.winPolicy.higherFrameTs(p.timestampFns[ordinal](item))
+	if addClamped(frameTs, p.output.lateness.allowedLateness) <= p.currentWatermark {
+		return p.output.tryEmitLateEvent(item, p.currentWatermark)
+	}
+	key := p.keyFns[ordinal](item)
+	_, inFrame := p.tsToKeyToAcc[frameTs][key]
+	p.aggrOp.accumulateFn(ordinal)(p.frameAcc(frameTs, key), item)
+	if frameTs < p.nextWinToEmit {
+		p.lateUpdate(frameTs, key, !inFrame, ordinal, item)
+	}
+	return true
+}
+
+// lateUpdate marks the emitted windows that contain the frame of the late item, the sliding window gets the item
+// if it contains the frame. newInFrame tells whether the item is the first of its key in the frame
+func (p *SlidingWindowP) lateUpdate(frameTs int64, key interface{}, newInFrame bool, ordinal int, item interface{}) {
+	lastEmitted := p.nextWinToEmit - p.winPolicy.frameSize
+	for winEnd := frameTs; winEnd <= lastEmitted && winEnd < frameTs+p.winPolicy.windowSize; winEnd += p.winPolicy.frameSize {
+		p.lateUpdatedWindows[winEnd] = true
+	}
+	if p.slidingWindow == nil || frameTs <= lastEmitted-p.winPolicy.windowSize+p.winPolicy.frameSize {
+		return
+	}
+	acc, ok := p.slidingWindow[key]
+	if !ok {
+		acc = p.aggrOp.getCreateFn()()
+		p.slidingWindow[key] = acc
+	}
+	if newInFrame {
+		p.slidingWindowFrames[key]++
+	}
+	p.aggrOp.accumulateFn(ordinal)(acc, item)
+}
+
+// frameAcc returns the accumulator of the key in the frame, creating it if there is none
+func (p *SlidingWindowP) frameAcc(frameTs int64, key interface{}) interface{} {
+	keyToAcc, ok := p.tsToKeyToAcc[frameTs]
+	if !ok {
+		keyToAcc = make(map[interface{}]interface{})
+		p.tsToKeyToAcc[frameTs] = keyToAcc
+	}
+	acc, ok := keyToAcc[key]
+	if !ok {
+		acc = p.aggrOp.getCreateFn()()
+		keyToAcc[key] = acc
+	}
+	if frameTs > p.topTs {
+		p.topTs = frameTs
+	}
+	return acc
+}
+
+func (p *SlidingWindowP) tryProcessWatermark(watermark Watermark) bool {
+	if p.flushTraverser == nil {
+		p.currentWatermark = watermark.timestamp
+		p.flushTraverser = p.windowsUpTo(watermark.timestamp)
+		p.purgeFrames()
+	}
+	if !p.output.emitResults(p.flushTraverser) || !p.tryEmit(-1, NewWatermark(watermark.timestamp)) {
+		return false
+	}
+	p.flushTraverser = nil
+	return true
+}
+
+// complete emits the windows of the remaining frames, no watermark will close them
+func (p *SlidingWindowP) complete() bool {
+	if p.flushTraverser == nil {
+		if len(p.tsToKeyToAcc) == 0 {
+			return true
+		}
+		p.flushTraverser = p.windowsUpTo(addClamped(p.topTs, p.winPolicy.windowSize-p.winPolicy.frameSize))
+		p.tsToKeyToAcc = make(map[int64]map[interface{}]interface{})
+	}
+	if !p.output.emitResults(p.flushTraverser) {
+		return false
+	}
+	p.flushTraverser = nil
+	return true
+}
+
+// windowsUpTo returns the results of the windows late items updated, then of the windows that end at or before the
+// timestamp. the windows that contain no frame are empty and skipped
+func (p *SlidingWindowP) windowsUpTo(timestamp int64) Traverser {
+	results := p.lateUpdatedResults()
+	for {
+		winEnd := p.nextWinToEmit
+		if minFrameTs := p.minFrameTsFrom(SubtractClamped(winEnd, p.winPolicy.windowSize-p.winPolicy.frameSize)); minFrameTs > winEnd {
+			winEnd = minFrameTs
+			if p.slidingWindow != nil {
+				p.resetSlidingWindow()
+			}
+		}
+		if winEnd > timestamp {
+			break
+		}
+		p.emitWindow(winEnd, results)
+		p.deductFrame(winEnd - p.winPolicy.windowSize + p.winPolicy.frameSize)
+		p.nextWinToEmit = addClamped(winEnd, p.winPolicy.frameSize)
+		if winEnd == Max_Value {
+			break
+		}
+	}
+	if higherFrameTs := p.winPolicy.higherFrameTs(timestamp); higherFrameTs > p.nextWinToEmit {
+		p.nextWinToEmit = higherFrameTs
+	}
+	return results
+}
+
+// lateUpdatedResults returns the results of the windows late items updated, in the order of their ends
+func (p *SlidingWindowP) lateUpdatedResults() Traverser {
+	results := NewAbstractTraverser()
+	winEnds := make([]int64, 0, len(p.lateUpdatedWindows))
+	for winEnd := range p.lateUpdatedWindows {
+		winEnds = append(winEnds, winEnd)
+	}
+	sort.Slice(winEnds, func(i, j int) bool {
+		return winEnds[i] < winEnds[j]
+	})
+	for _, winEnd := range winEnds {
+		resultFn := p.aggrOp.getFinishFn()
+		if p.winPolicy.isTumbling() {
+			resultFn = p.exportFn()
+		}
+		for key, acc := range p.combinedWindow(winEnd) {
+			results.append(p.mapToOutputFn(winEnd-p.winPolicy.windowSize, winEnd, key, resultFn(acc), false))
+		}
+	}
+	p.lateUpdatedWindows = make(map[int64]bool)
+	return results
+}
+
+// minFrameTsFrom returns the timestamp of the earliest frame at or after the timestamp, Max_Value if there is no such frame
+func (p *SlidingWindowP) minFrameTsFrom(timestamp int64) int64 {
+	minFrameTs := Max_Value
+	for frameTs := range p.tsToKeyToAcc {
+		if frameTs >= timestamp && frameTs < minFrameTs {
+			minFrameTs = frameTs
+		}
+	}
+	return minFrameTs
+}
+
+func (p *SlidingWindowP) emitWindow(winEnd int64, results Traverser) {
+	winStart := winEnd - p.winPolicy.windowSize
+	if p.slidingWindow != nil {
+		p.addToSlidingWindow(p.tsToKeyToAcc[winEnd])
+		for key, acc := range p.slidingWindow {
+			results.append(p.mapToOutputFn(winStart, winEnd, key, p.exportFn()(acc), false))
+		}
+		return
+	}
+	resultFn := p.aggrOp.getFinishFn()
+	if p.winPolicy.isTumbling() && p.output.lateness.allowedLateness > 0 {
+		resultFn = p.exportFn()
+	}
+	for key, acc := range p.combinedWindow(winEnd) {
+		results.append(p.mapToOutputFn(winStart, winEnd, key, resultFn(acc), false))
+	}
+}
+
+// combinedWindow returns the accumulators of the window combined from its frames, a tumbling window is its frame
+func (p *SlidingWindowP) combinedWindow(winEnd int64) map[interface{}]interface{} {
+	if p.winPolicy.isTumbling() {
+		return p.tsToKeyToAcc[winEnd]
+	}
+	window := make(map[interface{}]interface{})
+	for frameTs := winEnd - p.winPolicy.windowSize + p.winPolicy.frameSize; frameTs <= winEnd; frameTs += p.winPolicy.frameSize {
+		p.combineInto(window, p.tsToKeyToAcc[frameTs])
+		if frameTs == winEnd {
+			break
+		}
+	}
+	return window
+}
+
+func (p *SlidingWindowP) tryProcessIdle() bool {
+	return p.tryEmitEarlyResults(time.Now().UnixMilli())
+}
+
+// tryEmitEarlyResults emits the partial results of the windows that have frames once the early results period elapsed
+func (p *SlidingWindowP) tryEmitEarlyResults(nowMs int64) bool {
+	if p.earlyTraverser == nil {
+		if !p.earlyResults.isDue(nowMs) {
+			return true
+		}
+		p.earlyTraverser = p.earlyWindowResults()
+	}
+	if !p.output.emitResults(p.earlyTraverser) {
+		return false
+	}
+	p.earlyTraverser = nil
+	return true
+}
+
+// earlyWindowResults the windows from the next one to emit to the last one with the top frame, the accumulators are
+// exported and stay intact
+func (p *SlidingWindowP) earlyWindowResults() Traverser {
+	results := NewAbstractTraverser()
+	winEnd := p.nextWinToEmit
+	if minFrameTs := p.minFrameTsFrom(SubtractClamped(winEnd, p.winPolicy.windowSize-p.winPolicy.frameSize)); minFrameTs > winEnd {
+		winEnd = minFrameTs
+	}
+	if winEnd == Max_Value {
+		return results
+	}
+	lastWinEnd := addClamped(p.topTs, p.winPolicy.windowSize-p.winPolicy.frameSize)
+	for ; winEnd <= lastWinEnd; winEnd += p.winPolicy.frameSize {
+		for key, acc := range p.combinedWindow(winEnd) {
+			results.append(p.mapToOutputFn(winEnd-p.winPolicy.windowSize, winEnd, key, p.aggrOp.getExportFn()(acc), true))
+		}
+		if winEnd == lastWinEnd {
+			break
+		}
+	}
+	return results
+}
+
+// combineInto combines the accumulators of a frame into those of a window
+func (p *SlidingWindowP) combineInto(window map[interface{}]interface{}, keyToAcc map[interface{}]interface{}) {
+	for key, acc := range keyToAcc {
+		windowAcc, ok := window[key]
+		if !ok {
+			windowAcc = p.aggrOp.getCreateFn()()
+			window[key] = windowAcc
+		}
+		p.aggrOp.getCombineFn()(windowAcc, acc)
+	}
+}
+
+// exportFn the accumulators of the sliding window are still needed after a result, an operation without exportFn
+// is expected to leave them intact in finishFn
+func (p *SlidingWindowP) exportFn() ApplyFn {
+	if exportFn := p.aggrOp.getExportFn(); exportFn != nil {
+		return exportFn
+	}
+	return p.aggrOp.getFinishFn()
+}
+
+// addToSlidingWindow combines the accumulators of a frame into the sliding window
+func (p *SlidingWindowP) addToSlidingWindow(keyToAcc map[interface{}]interface{}) {
+	p.combineInto(p.slidingWindow, keyToAcc)
+	for key := range keyToAcc {
+		p.slidingWindowFrames[key]++
+	}
+}
+
+// deductFrame deducts the frame from the sliding window, a key leaves the window with the last frame it has an
+// accumulator in
+func (p *SlidingWindowP) deductFrame(frameTs int64) {
+	if p.slidingWindow == nil {
+		return
+	}
+	for key, acc := range p.tsToKeyToAcc[frameTs] {
+		p.aggrOp.getDeductFn()(p.slidingWindow[key], acc)
+		if p.slidingWindowFrames[key]--; p.slidingWindowFrames[key] == 0 {
+			delete(p.slidingWindow, key)
+			delete(p.slidingWindowFrames, key)
+		}
+	}
+}
+
+// resetSlidingWindow empties the sliding window, the next window to emit has no frame in common with the last one
+func (p *SlidingWindowP) resetSlidingWindow() {
+	p.slidingWindow = make(map[interface{}]interface{})
+	p.slidingWindowFrames = make(map[interface{}]int)
+}
+
+// purgeFrames removes the frames whose last window the watermark passed by the allowed lateness, no late item can update them
+func (p *SlidingWindowP) purgeFrames() {
+	retention := p.winPolicy.windowSize - p.winPolicy.frameSize + p.output.lateness.allowedLateness
+	for frameTs := range p.tsToKeyToAcc {
+		if addClamped(frameTs, retention) <= p.currentWatermark {
+			delete(p.tsToKeyToAcc, frameTs)
+		}
+	}
+}
+
+// saveToSnapshot saves the accumulators of the frames by key, the end of the next window, the current watermark and the
+// late updated windows to all processors
+func (p *SlidingWindowP) saveToSnapshot() bool {
+	if p.snapshotEntries == nil {
+		for frameTs, keyToAcc := range p.tsToKeyToAcc {
+			for key, acc := range keyToAcc {
+				p.snapshotEntries = append(p.snapshotEntries, MapEntry{key: key, value: NewTuple2(frameTs, acc)})
+			}
+		}
+		lateUpdatedWindows := make([]interface{}, 0, len(p.lateUpdatedWindows))
+		for winEnd := range p.lateUpdatedWindows {
+			lateUpdatedWindows = append(lateUpdatedWindows, winEnd)
+		}
+		p.snapshotEntries = append(p.snapshotEntries,
+			MapEntry{key: NewBroadcastKey(NEXT_WIN_TO_EMIT_KEY), value: p.nextWinToEmit},
+			MapEntry{key: NewBroadcastKey(CURRENT_WATERMARK_KEY), value: p.currentWatermark},
+			MapEntry{key: NewBroadcastKey(LATE_UPDATED_WINDOWS_KEY), value: lateUpdatedWindows})
+	}
+	for ; len(p.snapshotEntries) > 0; p.snapshotEntries = p.snapshotEntries[1:] {
+		if !p.outbox.offerToSnapshot(p.snapshotEntries[0].key, p.snapshotEntries[0].value) {
+			return false
+		}
+	}
+	p.snapshotEntries = nil
+	return true
+}
+
+// restoreFromSnapshotWithMapEntry the processors may have saved different next windows and watermarks, the earliest ones
+// are restored and the late updated windows of all of them
+func (p *SlidingWindowP) restoreFromSnapshotWithMapEntry(entry MapEntry) {
+	if key, ok := entry.key.(BroadcastKey); ok {
+		switch key.key {
+		case NEXT_WIN_TO_EMIT_KEY:
+			nextWinToEmit := entry.value.(int64)
+			if !p.nextWinRestored || nextWinToEmit < p.nextWinToEmit {
+				p.nextWinToEmit = nextWinToEmit
+			}
+			p.nextWinRestored = true
+		case CURRENT_WATERMARK_KEY:
+			watermark := entry.value.(int64)
+			if !p.watermarkRestored || watermark < p.currentWatermark {
+				p.currentWatermark = watermark
+			}
+			p.watermarkRestored = true
+		case LATE_UPDATED_WINDOWS_KEY:
+			for _, winEnd := range entry.value.([]interface{}) {
+				p.lateUpdatedWindows[winEnd.(int64)] = true
+			}
+		}
+		return
+	}
+	frame := entry.value.(Tuple2)
+	frameTs := frame.f0.(int64)
+	if keyToAcc, ok := p.tsToKeyToAcc[frameTs]; ok {
+		if acc, ok := keyToAcc[entry.key]; ok && p.aggrOp.getCombineFn() != nil {
+			p.aggrOp.getCombineFn()(acc, frame.f1)
+			return
+		}
+	}
+	p.frameAcc(frameTs, entry.key)
+	p.tsToKeyToAcc[frameTs][entry.key] = frame.f1
+}
+
+// finishSnapshotRestore the sliding window holds the frames of the last emitted window, but the one it deducted
+func (p *SlidingWindowP) finishSnapshotRestore() bool {
+	if p.slidingWindow == nil {
+		return true
+	}
+	lastEmitted := SubtractClamped(p.nextWinToEmit, p.winPolicy.frameSize)
+	for frameTs, keyToAcc := range p.tsToKeyToAcc {
+		if frameTs <= lastEmitted && frameTs > SubtractClamped(lastEmitted, p.winPolicy.windowSize-p.winPolicy.frameSize) {
+			p.addToSlidingWindow(keyToAcc)
+		}
+	}
+	return true
+}
+
+// session the accumulator of the items of a key in [start, end), end is the timestamp of the latest item plus the timeout.
+// an emitted session is kept for the allowed lateness, a late item it gets emits it again
+type session struct {
+	start   int64
+	end     int64
+	acc     interface{}
+	emitted bool
+}
+
+// SessionWindowP aggregates the items by key in sessions. an item opens the session [timestamp, timestamp + sessionTimeout),
+// the sessions of a key it overlaps are merged into one by combining their accumulators. a session is emitted once the
+// watermark passes its latest item by sessionTimeout and kept for the allowed lateness, the items behind the watermark
+// by more than that are late. with an early results period the open sessions emit partial results
+type SessionWindowP struct {
+	*AbstractProcessor
+	sessionTimeout int64
+	keyFns         []ApplyFn
+	timestampFns   []ApplyAsLongFn
+	aggrOp         AggregateOperation
+	mapToOutputFn  KeyedWindowResultFn
+	output         windowOutput
+	// keyToSessions the sessions of each key, ordered by start
+	keyToSessions map[interface{}][]*session
+	// deadlineToKeys the keys by the times their sessions are emitted or removed, a key may stay at a deadline its
+	// sessions don't have anymore
+	deadlineToKeys    *treemap.Map
+	currentWatermark  int64
+	watermarkRestored bool
+	flushTraverser    Traverser
+	snapshotEntries   []MapEntry
+	earlyResults      earlyResultsTimer
+	earlyTraverser    Traverser
+}
+
+func NewSessionWindowP(sessionTimeout int64, keyFns []ApplyFn, timestampFns []ApplyAsLongFn, earlyResultsPeriod int64, lateness WindowLateness, aggrOp AggregateOperation, mapToOutputFn KeyedWindowResultFn) *SessionWindowP {
+	if aggrOp.getCombineFn() == nil {
+		panic("a session window requires an aggregate operation with combineFn")
+	}
+	p := &SessionWindowP{
+		sessionTimeout:   sessionTimeout,
+		keyFns:           keyFns,
+		timestampFns:     timestampFns,
+		aggrOp:           aggrOp,
+		mapToOutputFn:    mapToOutputFn,
+		output:           windowOutput{lateness: lateness},
+		keyToSessions:    make(map[interface{}][]*session),
+		deadlineToKeys:   treemap.NewWith(utils.Int64Comparator),
+		currentWatermark: Min_Value,
+		earlyResults:     newEarlyResultsTimer(earlyResultsPeriod, aggrOp),
+	}
+	p.AbstractProcessor = NewAbstractProcessor(p)
+	return p
+}
+
+func (p *SessionWindowP) init(ctx context.Context, outbox Outbox) {
+	p.AbstractProcessor.init(ctx, outbox)
+	p.output.init(ctx, p.AbstractProcessor, outbox)
+}
+
+func (p *SessionWindowP) tryProcess(ordinal int, item interface{}) bool {
+	timestamp := p.timestampFns[ordinal](item)
+	if addClamped(timestamp, p.output.lateness.allowedLateness) < p.currentWatermark {
+		return p.output.tryEmitLateEvent(item, p.currentWatermark)
+	}
+	s := p.mergeSession(p.keyFns[ordinal](item), timestamp, addClamped(timestamp, p.sessionTimeout))
+	p.aggrOp.accumulateFn(ordinal)(s.acc, item)
+	return true
+}
+
+// mergeSession returns the session of the key that covers [start, end), the overlapping sessions are merged into it.
+// the session is emitted again even if all of them were emitted
+func (p *SessionWindowP) mergeSession(key interface{}, start, end int64) *session {
+	sessions := p.keyToSessions[key]
+	first := sort.Search(len(sessions), func(i int) bool {
+		return sessions[i].end > start
+	})
+	last := first
+	for last < len(sessions) && sessions[last].start < end {
+		last++
+	}
+	if first == last {
+		merged := &session{start: start, end: end, acc: p.aggrOp.getCreateFn()()}
+		sessions = append(sessions, nil)
+		copy(sessions[first+1:], sessions[first:])
+		sessions[first] = merged
+		p.keyToSessions[key] = sessions
+		p.addDeadline(end, key)
+		return merged
+	}
+	merged := sessions[first]
+	for _, other := range sessions[first+1 : last] {
+		p.aggrOp.getCombineFn()(merged.acc, other.acc)
+		merged.end = other.end
+	}
+	if start < merged.start {
+		merged.start = start
+	}
+	if end > merged.end {
+		merged.end = end
+	}
+	merged.emitted = false
+	p.keyToSessions[key] = append(sessions[:first+1], sessions[last:]...)
+	p.addDeadline(merged.end, key)
+	return merged
+}
+
+func (p *SessionWindowP) addDeadline(deadline int64, key interface{}) {
+	keys, ok := p.deadlineToKeys.Get(deadline)
+	if !ok {
+		keys = hashset.New()
+		p.deadlineToKeys.Put(deadline, keys)
+	}
+	keys.(*hashset.Set).Add(key)
+}
+
+func (p *SessionWindowP) tryProcessWatermark(watermark Watermark) bool {
+	if p.flushTraverser == nil {
+		p.currentWatermark = watermark.timestamp
+		p.flushTraverser = p.closeSessions(watermark.timestamp)
+	}
+	if !p.output.emitResults(p.flushTraverser) || !p.tryEmit(-1, NewWatermark(watermark.timestamp)) {
+		return false
+	}
+	p.flushTraverser = nil
+	return true
+}
+
+// complete emits the open sessions, no watermark will close them
+func (p *SessionWindowP) complete() bool {
+	if p.flushTraverser == nil {
+		if p.deadlineToKeys.Empty() {
+			return true
+		}
+		p.flushTraverser = p.closeSessions(Max_Value)
+	}
+	if !p.output.emitResults(p.flushTraverser) {
+		return false
+	}
+	p.flushTraverser = nil
+	return true
+}
+
+// closeSessions returns the results of the sessions that end at or before the timestamp and removes the sessions it
+// passed by the allowed lateness
+func (p *SessionWindowP) closeSessions(timestamp int64) Traverser {
+	results := NewAbstractTraverser()
+	for !p.deadlineToKeys.Empty() {
+		deadline, keys := p.deadlineToKeys.Min()
+		if deadline.(int64) > timestamp {
+			break
+		}
+		p.deadlineToKeys.Remove(deadline)
+		for _, key := range keys.(*hashset.Set).Values() {
+			p.closeSessionsOfKey(key, timestamp, results)
+		}
+	}
+	return results
+}
+
+func (p *SessionWindowP) closeSessionsOfKey(key interface{}, timestamp int64, results Traverser) {
+	var kept []*session
+	for _, s := range p.keyToSessions[key] {
+		if !s.emitted && s.end <= timestamp {
+			results.append(p.mapToOutputFn(s.start, s.end, key, p.exportFn()(s.acc), false))
+			s.emitted = true
+			if removeAt := addClamped(s.end, p.output.lateness.allowedLateness); removeAt > timestamp {
+				p.addDeadline(removeAt, key)
+			}
+		}
+		if !s.emitted || addClamped(s.end, p.output.lateness.allowedLateness) > timestamp {
+			kept = append(kept, s)
+		}
+	}
+	if kept == nil {
+		delete(p.keyToSessions, key)
+	} else {
+		p.keyToSessions[key] = kept
+	}
+}
+
+// exportFn the accumulator of a session stays for the allowed lateness after its result
+func (p *SessionWindowP) exportFn() ApplyFn {
+	if exportFn := p.aggrOp.getExportFn(); exportFn != nil && p.output.lateness.allowedLateness > 0 {
+		return exportFn
+	}
+	return p.aggrOp.getFinishFn()
+}
+
+func (p *SessionWindowP) tryProcessIdle() bool {
+	return p.tryEmitEarlyResults(time.Now().UnixMilli())
+}
+
+// tryEmitEarlyResults emits the partial results of the open sessions once the early results period elapsed
+func (p *SessionWindowP) tryEmitEarlyResults(nowMs int64) bool {
+	if p.earlyTraverser == nil {
+		if !p.earlyResults.isDue(nowMs) {
+			return true
+		}
+		results := NewAbstractTraverser()
+		for key, sessions := range p.keyToSessions {
+			for _, s := range sessions {
+				if !s.emitted {
+					results.append(p.mapToOutputFn(s.start, s.end, key, p.aggrOp.getExportFn()(s.acc), true))
+				}
+			}
+		}
+		p.earlyTraverser = results
+	}
+	if !p.output.emitResults(p.earlyTraverser) {
+		return false
+	}
+	p.earlyTraverser = nil
+	return true
+}
+
+// saveToSnapshot saves the sessions by key and the current watermark to all processors
+func (p *SessionWindowP) saveToSnapshot() bool {
+	if p.snapshotEntries == nil {
+		for key, sessions := range p.keyToSessions {
+			for _, s := range sessions {
+				p.snapshotEntries = append(p.snapshotEntries, MapEntry{key: key, value: NewTuple3(NewTuple2(s.start, s.end), s.acc, s.emitted)})
+			}
+		}
+		p.snapshotEntries = append(p.snapshotEntries, MapEntry{key: NewBroadcastKey(CURRENT_WATERMARK_KEY), value: p.currentWatermark})
+	}
+	for ; len(p.snapshotEntries) > 0; p.snapshotEntries = p.snapshotEntries[1:] {
+		if !p.outbox.offerToSnapshot(p.snapshotEntries[0].key, p.snapshotEntries[0].value) {
+			return false
+		}
+	}
+	p.snapshotEntries = nil
+	return true
+}
+
+// restoreFromSnapshotWithMapEntry the processors may have received different watermarks, the earliest one is restored
+func (p *SessionWindowP) restoreFromSnapshotWithMapEntry(entry MapEntry) {
+	if _, ok := entry.key.(BroadcastKey); ok {
+		watermark := entry.value.(int64)
+		if !p.watermarkRestored || watermark < p.currentWatermark {
+			p.currentWatermark = watermark
+		}
+		p.watermarkRestored = true
+		return
+	}
+	saved := entry.value.(Tuple3)
+	bounds := saved.f0.(Tuple2)
+	s := p.mergeSession(entry.key, bounds.f0.(int64), bounds.f1.(int64))
+	p.aggrOp.getCombineFn()(s.acc, saved.f1)
+	if saved.f2.(bool) {
+		s.emitted = true
+		p.addDeadline(addClamped(s.end, p.output.lateness.allowedLateness), entry.key)
+	}
+}
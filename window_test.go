@@ -1,6 +1,7 @@
 package stream_processing
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -132,3 +133,331 @@ func TestSlidingWindowPolicy_withOffset(t *testing.T) {
 	assert.Equal(t, int64(10), wt.definition.frameOffset)
 }
 
+// newSlidingWindowP returns a processor of the definition whose items are Tuple2s of a key and a timestamp
+func (w *WindowTest) newSlidingWindowP(earlyResultsPeriod int64, lateness WindowLateness, aggrOp AggregateOperation) (*SlidingWindowP, *TestOutbox) {
+	p := NewSlidingWindowP([]ApplyFn{func(t interface{}) interface{} {
+		return t.(Tuple2).f0
+	}}, []ApplyAsLongFn{func(t interface{}) int64 {
+		return t.(Tuple2).f1.(int64)
+	}}, w.definition, earlyResultsPeriod, lateness, aggrOp, func(start, end int64, key, result interface{}, isEarly bool) interface{} {
+		return NewKeyedWindowResult(start, end, key, result, isEarly)
+	})
+	capacities := []int{100}
+	if lateness.lateEventsOrdinal >= 0 {
+		capacities = append(capacities, 100)
+	}
+	outbox := NewTestOutbox(capacities...)
+	p.init(context.Background(), outbox)
+	return p, outbox
+}
+
+// storeAndLoad stores the entries the processor saved to a local dir store and loads them back like a restarted job
+func (w *WindowTest) storeAndLoad(t *testing.T, entries []MapEntry) []MapEntry {
+	store := NewLocalDirSnapshotStore(t.TempDir(), DEFAULT_RETAINED_SNAPSHOT_COUNT)
+	dag := NewDAG()
+	dag.newVertex("window", nil)
+	snapshot := NewSnapshot(1)
+	snapshot.addState("window", entries)
+	assert.NoError(t, storeSnapshot(store, "word-count", snapshot))
+	loaded, err := loadSnapshot(store, "word-count", dag)
+	assert.NoError(t, err)
+	return loaded.getState("window")
+}
+
+// processAndDrain processes the items, then the watermark and returns the emitted items
+func (w *WindowTest) processAndDrain(t *testing.T, p *SlidingWindowP, outbox *TestOutbox, wm int64, items ...Tuple2) []interface{} {
+	for _, item := range items {
+		assert.True(t, p.tryProcess(0, item))
+	}
+	assert.True(t, p.tryProcessWatermark(*NewWatermark(wm)))
+	return outbox.drainQueueAndReset(0)
+}
+
+func TestSlidingWindowP_when_tumbling_then_frameEmittedOnWatermarkAndLateItemDropped(t *testing.T) {
+	teardownTest, wt := WindowTestSetup(t)
+	defer teardownTest(t)
+	wt.definition = NewTumblingWithPolicy(4)
+	p, outbox := wt.newSlidingWindowP(0, NO_LATENESS, counting())
+
+	assert.ElementsMatch(t, []interface{}{
+		NewKeyedWindowResult(0, 4, "a", int64(2), false), NewKeyedWindowResult(0, 4, "b", int64(1), false), NewWatermark(4),
+	}, wt.processAndDrain(t, p, outbox, 4, NewTuple2("a", int64(0)), NewTuple2("a", int64(3)), NewTuple2("b", int64(2)), NewTuple2("a", int64(5))))
+	assert.Equal(t, []interface{}{NewKeyedWindowResult(4, 8, "a", int64(1), false), NewWatermark(8)},
+		wt.processAndDrain(t, p, outbox, 8, NewTuple2("a", int64(1))))
+	assert.Equal(t, []interface{}{NewWatermark(12)}, wt.processAndDrain(t, p, outbox, 12))
+}
+
+func TestSlidingWindowP_when_deductFnMissing_then_sameResultsAsSlidingByDeduct(t *testing.T) {
+	teardownTest, wt := WindowTestSetup(t)
+	defer teardownTest(t)
+	wt.definition = NewSlidingWithPolicy(4, 2)
+	withoutDeduct := NewAggregateOperationBuilder(func() interface{} {
+		return NewLongAccumulator()
+	}).andAccumulate(func(acc, item interface{}) {
+		acc.(*LongAccumulator).addAllowingOverflow(1)
+	}).andCombine(func(acc, other interface{}) {
+		acc.(*LongAccumulator).addAllowingOverflowWithAnother(other.(*LongAccumulator))
+	}).andExportFinish(func(acc interface{}) interface{} {
+		return acc.(*LongAccumulator).get()
+	})
+	deducting, deductingOutbox := wt.newSlidingWindowP(0, NO_LATENESS, counting())
+	combining, combiningOutbox := wt.newSlidingWindowP(0, NO_LATENESS, withoutDeduct)
+
+	items := map[int64][]Tuple2{
+		2:  {NewTuple2("a", int64(0)), NewTuple2("a", int64(1)), NewTuple2("b", int64(2)), NewTuple2("a", int64(3))},
+		6:  {NewTuple2("a", int64(6))},
+		10: {NewTuple2("b", int64(9))},
+	}
+	expected := map[int64][]interface{}{
+		2:  {NewKeyedWindowResult(-2, 2, "a", int64(2), false)},
+		4:  {NewKeyedWindowResult(0, 4, "a", int64(3), false), NewKeyedWindowResult(0, 4, "b", int64(1), false)},
+		6:  {NewKeyedWindowResult(2, 6, "a", int64(1), false), NewKeyedWindowResult(2, 6, "b", int64(1), false)},
+		8:  {NewKeyedWindowResult(4, 8, "a", int64(1), false)},
+		10: {NewKeyedWindowResult(6, 10, "a", int64(1), false), NewKeyedWindowResult(6, 10, "b", int64(1), false)},
+		12: {NewKeyedWindowResult(8, 12, "b", int64(1), false)},
+		14: {},
+	}
+	for wm := int64(2); wm <= 14; wm += 2 {
+		want := append(expected[wm], NewWatermark(wm))
+		assert.ElementsMatch(t, want, wt.processAndDrain(t, deducting, deductingOutbox, wm, items[wm]...), "wm %d", wm)
+		assert.ElementsMatch(t, want, wt.processAndDrain(t, combining, combiningOutbox, wm, items[wm]...), "wm %d", wm)
+	}
+}
+
+func TestSlidingWindowP_when_keyAccumulatorEmptyButFramesLeft_then_keyStaysInWindow(t *testing.T) {
+	teardownTest, wt := WindowTestSetup(t)
+	defer teardownTest(t)
+	wt.definition = NewSlidingWithPolicy(4, 2)
+	// the sum of the odd timestamps, an item with an even timestamp leaves the accumulator as it was
+	p, outbox := wt.newSlidingWindowP(0, NO_LATENESS, summingLong(func(t interface{}) int64 {
+		return t.(Tuple2).f1.(int64) % 2
+	}))
+
+	assert.ElementsMatch(t, []interface{}{
+		NewKeyedWindowResult(-2, 2, "a", int64(1), false), NewKeyedWindowResult(0, 4, "a", int64(1), false), NewWatermark(4),
+	}, wt.processAndDrain(t, p, outbox, 4, NewTuple2("a", int64(1)), NewTuple2("a", int64(2))))
+	assert.ElementsMatch(t, []interface{}{
+		NewKeyedWindowResult(2, 6, "a", int64(0), false), NewKeyedWindowResult(2, 6, "b", int64(0), false), NewWatermark(6),
+	}, wt.processAndDrain(t, p, outbox, 6, NewTuple2("b", int64(4))))
+	assert.Equal(t, []interface{}{NewKeyedWindowResult(4, 8, "b", int64(0), false), NewWatermark(8)},
+		wt.processAndDrain(t, p, outbox, 8))
+	assert.Equal(t, []interface{}{NewWatermark(10)}, wt.processAndDrain(t, p, outbox, 10))
+}
+
+func TestSlidingWindowP_when_restoredFromSnapshot_then_windowsContinue(t *testing.T) {
+	teardownTest, wt := WindowTestSetup(t)
+	defer teardownTest(t)
+	wt.definition = NewSlidingWithPolicy(4, 2)
+	p, outbox := wt.newSlidingWindowP(0, NO_LATENESS, counting())
+	wt.processAndDrain(t, p, outbox, 4, NewTuple2("a", int64(1)), NewTuple2("a", int64(3)), NewTuple2("a", int64(4)))
+	assert.True(t, p.saveToSnapshot())
+
+	restored, restoredOutbox := wt.newSlidingWindowP(0, NO_LATENESS, counting())
+	for _, entry := range wt.storeAndLoad(t, outbox.takeSnapshotEntries()) {
+		restored.restoreFromSnapshotWithMapEntry(entry)
+	}
+	assert.True(t, restored.finishSnapshotRestore())
+
+	assert.Equal(t, []interface{}{NewKeyedWindowResult(2, 6, "a", int64(2), false), NewWatermark(6)},
+		wt.processAndDrain(t, restored, restoredOutbox, 6, NewTuple2("a", int64(1))))
+	assert.True(t, restored.complete())
+	assert.Equal(t, []interface{}{NewKeyedWindowResult(4, 8, "a", int64(1), false)}, restoredOutbox.drainQueueAndReset(0))
+}
+
+func TestSessionWindowP_when_itemsOutOfOrder_then_overlappingSessionsMerged(t *testing.T) {
+	teardownTest, wt := WindowTestSetup(t)
+	defer teardownTest(t)
+	newSessionWindowP := func() (*SessionWindowP, *TestOutbox) {
+		p := NewSessionWindowP(5, []ApplyFn{func(t interface{}) interface{} {
+			return t.(Tuple2).f0
+		}}, []ApplyAsLongFn{func(t interface{}) int64 {
+			return t.(Tuple2).f1.(int64)
+		}}, 0, NO_LATENESS, counting(), func(start, end int64, key, result interface{}, isEarly bool) interface{} {
+			return NewKeyedWindowResult(start, end, key, result, isEarly)
+		})
+		outbox := NewTestOutbox(100)
+		p.init(context.Background(), outbox)
+		return p, outbox
+	}
+	p, outbox := newSessionWindowP()
+	for _, item := range []Tuple2{NewTuple2("a", int64(10)), NewTuple2("a", int64(20)), NewTuple2("a", int64(14)), NewTuple2("b", int64(12))} {
+		assert.True(t, p.tryProcess(0, item))
+	}
+	assert.True(t, p.tryProcessWatermark(*NewWatermark(17)))
+	assert.Equal(t, []interface{}{NewKeyedWindowResult(12, 17, "b", int64(1), false), NewWatermark(17)}, outbox.drainQueueAndReset(0))
+	assert.True(t, p.saveToSnapshot())
+
+	restored, restoredOutbox := newSessionWindowP()
+	for _, entry := range wt.storeAndLoad(t, outbox.takeSnapshotEntries()) {
+		restored.restoreFromSnapshotWithMapEntry(entry)
+	}
+	assert.True(t, restored.tryProcess(0, NewTuple2("a", int64(17))))
+	assert.True(t, restored.tryProcess(0, NewTuple2("a", int64(16))))
+	assert.True(t, restored.tryProcessWatermark(*NewWatermark(24)))
+	assert.Equal(t, []interface{}{NewWatermark(24)}, restoredOutbox.drainQueueAndReset(0))
+	assert.True(t, restored.tryProcessWatermark(*NewWatermark(25)))
+	assert.Equal(t, []interface{}{NewKeyedWindowResult(10, 25, "a", int64(4), false), NewWatermark(25)}, restoredOutbox.drainQueueAndReset(0))
+	assert.True(t, restored.complete())
+	assert.Empty(t, restoredOutbox.drainQueueAndReset(0))
+}
+
+func TestSlidingWindowP_when_earlyResultsPeriodElapsed_then_openWindowsExportedAndKeptIntact(t *testing.T) {
+	teardownTest, wt := WindowTestSetup(t)
+	defer teardownTest(t)
+	wt.definition = NewSlidingWithPolicy(4, 2)
+	p, outbox := wt.newSlidingWindowP(10, NO_LATENESS, counting())
+
+	assert.True(t, p.tryEmitEarlyResults(100))
+	assert.True(t, p.tryProcess(0, NewTuple2("a", int64(1))))
+	assert.True(t, p.tryProcess(0, NewTuple2("a", int64(2))))
+	assert.True(t, p.tryEmitEarlyResults(109))
+	assert.Empty(t, outbox.drainQueueAndReset(0))
+	assert.True(t, p.tryEmitEarlyResults(110))
+	assert.ElementsMatch(t, []interface{}{
+		NewKeyedWindowResult(-2, 2, "a", int64(1), true), NewKeyedWindowResult(0, 4, "a", int64(2), true), NewKeyedWindowResult(2, 6, "a", int64(1), true),
+	}, outbox.drainQueueAndReset(0))
+
+	assert.Equal(t, []interface{}{NewKeyedWindowResult(-2, 2, "a", int64(1), false), NewWatermark(2)}, wt.processAndDrain(t, p, outbox, 2))
+	assert.True(t, p.tryEmitEarlyResults(120))
+	assert.ElementsMatch(t, []interface{}{
+		NewKeyedWindowResult(0, 4, "a", int64(2), true), NewKeyedWindowResult(2, 6, "a", int64(1), true),
+	}, outbox.drainQueueAndReset(0))
+}
+
+func TestSessionWindowP_when_earlyResultsPeriodElapsed_then_openSessionsExported(t *testing.T) {
+	teardownTest, _ := WindowTestSetup(t)
+	defer teardownTest(t)
+	p := NewSessionWindowP(5, []ApplyFn{func(t interface{}) interface{} {
+		return t
+	}}, []ApplyAsLongFn{func(t interface{}) int64 {
+		return 10
+	}}, 10, NO_LATENESS, counting(), func(start, end int64, key, result interface{}, isEarly bool) interface{} {
+		return NewKeyedWindowResult(start, end, key, result, isEarly)
+	})
+	outbox := NewTestOutbox(100)
+	p.init(context.Background(), outbox)
+
+	assert.True(t, p.tryEmitEarlyResults(0))
+	assert.True(t, p.tryProcess(0, "a"))
+	assert.True(t, p.tryEmitEarlyResults(10))
+	assert.Equal(t, []interface{}{NewKeyedWindowResult(10, 15, "a", int64(1), true)}, outbox.drainQueueAndReset(0))
+	assert.True(t, p.tryProcess(0, "a"))
+	assert.True(t, p.tryProcessWatermark(*NewWatermark(15)))
+	assert.Equal(t, []interface{}{NewKeyedWindowResult(10, 15, "a", int64(2), false), NewWatermark(15)}, outbox.drainQueueAndReset(0))
+	assert.Panics(t, func() {
+		withoutExport := NewAggregateOperationBuilder(func() interface{} {
+			return NewLongAccumulator()
+		}).andAccumulate(func(acc, item interface{}) {
+		}).andCombine(func(acc, other interface{}) {
+		}).andFinish(func(acc interface{}) interface{} {
+			return acc
+		})
+		NewSessionWindowP(5, nil, nil, 10, NO_LATENESS, withoutExport, nil)
+	})
+}
+
+func TestSlidingWindowP_when_itemWithinAllowedLateness_then_windowsEmittedAgainAndLaterItemsRouted(t *testing.T) {
+	teardownTest, wt := WindowTestSetup(t)
+	defer teardownTest(t)
+	wt.definition = NewSlidingWithPolicy(4, 2)
+	p, outbox := wt.newSlidingWindowP(0, NewWindowLateness(4, 1), counting())
+
+	assert.ElementsMatch(t, []interface{}{
+		NewKeyedWindowResult(-2, 2, "a", int64(1), false), NewKeyedWindowResult(0, 4, "a", int64(2), false), NewWatermark(4),
+	}, wt.processAndDrain(t, p, outbox, 4, NewTuple2("a", int64(1)), NewTuple2("a", int64(3))))
+	assert.ElementsMatch(t, []interface{}{
+		NewKeyedWindowResult(-2, 2, "a", int64(2), false), NewKeyedWindowResult(0, 4, "a", int64(3), false),
+		NewKeyedWindowResult(2, 6, "a", int64(2), false), NewWatermark(6),
+	}, wt.processAndDrain(t, p, outbox, 6, NewTuple2("a", int64(0)), NewTuple2("a", int64(5))))
+	assert.Equal(t, []interface{}{NewKeyedWindowResult(4, 8, "a", int64(1), false), NewWatermark(8)}, wt.processAndDrain(t, p, outbox, 8))
+	assert.True(t, p.saveToSnapshot())
+
+	restored, restoredOutbox := wt.newSlidingWindowP(0, NewWindowLateness(4, 1), counting())
+	for _, entry := range wt.storeAndLoad(t, outbox.takeSnapshotEntries()) {
+		restored.restoreFromSnapshotWithMapEntry(entry)
+	}
+	assert.True(t, restored.finishSnapshotRestore())
+	assert.ElementsMatch(t, []interface{}{
+		NewKeyedWindowResult(2, 6, "a", int64(3), false), NewKeyedWindowResult(4, 8, "a", int64(2), false),
+		NewKeyedWindowResult(6, 10, "a", int64(1), false), NewKeyedWindowResult(8, 12, "a", int64(1), false), NewWatermark(12),
+	}, wt.processAndDrain(t, restored, restoredOutbox, 12, NewTuple2("a", int64(1)), NewTuple2("a", int64(4)), NewTuple2("a", int64(9))))
+	assert.Equal(t, []interface{}{NewTuple2("a", int64(1)), NewWatermark(12)}, restoredOutbox.drainQueueAndReset(1))
+	assert.Equal(t, []interface{}{NewWatermark(4), NewWatermark(6), NewWatermark(8)}, outbox.drainQueueAndReset(1))
+}
+
+func TestSessionWindowP_when_itemWithinAllowedLateness_then_sessionEmittedAgainAndLaterItemsRouted(t *testing.T) {
+	teardownTest, wt := WindowTestSetup(t)
+	defer teardownTest(t)
+	newSessionWindowP := func() (*SessionWindowP, *TestOutbox) {
+		p := NewSessionWindowP(5, []ApplyFn{func(t interface{}) interface{} {
+			return t.(Tuple2).f0
+		}}, []ApplyAsLongFn{func(t interface{}) int64 {
+			return t.(Tuple2).f1.(int64)
+		}}, 0, NewWindowLateness(10, 1), counting(), func(start, end int64, key, result interface{}, isEarly bool) interface{} {
+			return NewKeyedWindowResult(start, end, key, result, isEarly)
+		})
+		outbox := NewTestOutbox(100, 100)
+		p.init(context.Background(), outbox)
+		return p, outbox
+	}
+	p, outbox := newSessionWindowP()
+	assert.True(t, p.tryProcess(0, NewTuple2("a", int64(10))))
+	assert.True(t, p.tryProcessWatermark(*NewWatermark(15)))
+	assert.Equal(t, []interface{}{NewKeyedWindowResult(10, 15, "a", int64(1), false), NewWatermark(15)}, outbox.drainQueueAndReset(0))
+	assert.True(t, p.tryProcess(0, NewTuple2("a", int64(12))))
+	assert.True(t, p.tryProcessWatermark(*NewWatermark(17)))
+	assert.Equal(t, []interface{}{NewKeyedWindowResult(10, 17, "a", int64(2), false), NewWatermark(17)}, outbox.drainQueueAndReset(0))
+	assert.True(t, p.saveToSnapshot())
+
+	restored, restoredOutbox := newSessionWindowP()
+	for _, entry := range wt.storeAndLoad(t, outbox.takeSnapshotEntries()) {
+		restored.restoreFromSnapshotWithMapEntry(entry)
+	}
+	assert.True(t, restored.tryProcess(0, NewTuple2("a", int64(3))))
+	assert.True(t, restored.tryProcessWatermark(*NewWatermark(20)))
+	assert.Equal(t, []interface{}{NewWatermark(20)}, restoredOutbox.drainQueueAndReset(0))
+	assert.True(t, restored.tryProcess(0, NewTuple2("a", int64(16))))
+	assert.True(t, restored.tryProcessWatermark(*NewWatermark(31)))
+	assert.Equal(t, []interface{}{NewKeyedWindowResult(10, 21, "a", int64(3), false), NewWatermark(31)}, restoredOutbox.drainQueueAndReset(0))
+	assert.Equal(t, []interface{}{NewTuple2("a", int64(3)), NewWatermark(20), NewWatermark(31)}, restoredOutbox.drainQueueAndReset(1))
+	assert.True(t, restored.complete())
+	assert.Empty(t, restoredOutbox.drainQueueAndReset(0))
+}
+
+func TestWindowP_when_snapshotEntriesStoredInLocalDir_then_readBack(t *testing.T) {
+	teardownTest, wt := WindowTestSetup(t)
+	defer teardownTest(t)
+	wt.definition = NewTumblingWithPolicy(4)
+	sliding, slidingOutbox := wt.newSlidingWindowP(0, NO_LATENESS, counting())
+	wt.processAndDrain(t, sliding, slidingOutbox, 4, NewTuple2("a", int64(1)), NewTuple2("a", int64(5)), NewTuple2("b", int64(6)))
+	assert.True(t, sliding.saveToSnapshot())
+
+	session := NewSessionWindowP(5, []ApplyFn{func(t interface{}) interface{} {
+		return t.(Tuple2).f0
+	}}, []ApplyAsLongFn{func(t interface{}) int64 {
+		return t.(Tuple2).f1.(int64)
+	}}, 0, NO_LATENESS, counting(), func(start, end int64, key, result interface{}, isEarly bool) interface{} {
+		return NewKeyedWindowResult(start, end, key, result, isEarly)
+	})
+	sessionOutbox := NewTestOutbox(100)
+	session.init(context.Background(), sessionOutbox)
+	assert.True(t, session.tryProcess(0, NewTuple2("a", int64(10))))
+	assert.True(t, session.tryProcess(0, NewTuple2("b", int64(12))))
+	assert.True(t, session.tryProcessWatermark(*NewWatermark(11)))
+	assert.True(t, session.saveToSnapshot())
+
+	store := NewLocalDirSnapshotStore(t.TempDir(), DEFAULT_RETAINED_SNAPSHOT_COUNT)
+	expected := map[string][]MapEntry{"sliding": slidingOutbox.takeSnapshotEntries(), "session": sessionOutbox.takeSnapshotEntries()}
+	for vertexName, entries := range expected {
+		assert.NotEmpty(t, entries, vertexName)
+		for _, entry := range entries {
+			assert.NoError(t, store.put("word-count", 1, vertexName, entry.key, entry.value), vertexName)
+		}
+	}
+	assert.NoError(t, store.complete("word-count", 1))
+	for vertexName, entries := range expected {
+		stored, err := store.entries("word-count", 1, vertexName)
+		assert.NoError(t, err, vertexName)
+		assert.ElementsMatch(t, entries, stored, vertexName)
+	}
+}